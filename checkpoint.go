@@ -0,0 +1,64 @@
+package jstream
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// ErrMidValue is returned by Checkpoint when the decoder is within a
+// top-level value
+var ErrMidValue = errors.New("jstream: checkpoint within a value")
+
+// checkpoint is the decoder state serialized by Checkpoint
+type checkpoint struct {
+	Pos       int64 `json:"pos"`       // offset in the reader following the last document
+	Line      int   `json:"line"`      // line number at Pos, from 0
+	LineStart int64 `json:"lineStart"` // offset of the start of that line
+	Documents int64 `json:"documents"` // top-level documents decoded
+}
+
+// Checkpoint serializes the state of the decoder between top-level
+// documents, from which RestoreDecoder resumes decoding with the next
+// document. It must be called from the decoding goroutine, such as from
+// the function passed to Walk on receiving a top-level value, between
+// calls to DecodeNext, or once decoding has completed. ErrMidValue is
+// returned if the decoder is within a document.
+func (d *Decoder) Checkpoint() ([]byte, error) {
+	if d.depth > 0 || len(d.frames) > 0 {
+		return nil, ErrMidValue
+	}
+
+	pos, end := d.Pos, d.end()
+	if d.EOF() {
+		pos, end = d.Pos-1, d.offset() // exclude the virtual NUL
+	}
+	return json.Marshal(checkpoint{
+		Pos:       end,
+		Line:      d.lineNo,
+		LineStart: end - (pos - d.lineStart),
+		Documents: atomic.LoadInt64(&d.documents),
+	})
+}
+
+// RestoreDecoder creates a Decoder resuming decoding of r from a
+// checkpoint returned by Checkpoint for an earlier Decoder over the same
+// input, such that it emits values at emitDepth beginning with the
+// document following the checkpoint. Offsets, Line numbers and the count
+// of Documents in Stats continue from those of the earlier Decoder.
+func RestoreDecoder(r io.ReadSeeker, state []byte, emitDepth int) (*Decoder, error) {
+	var cp checkpoint
+	if err := json.Unmarshal(state, &cp); err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(cp.Pos, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	d := newDecoder(r, cp.Pos, emitDepth)
+	d.lineNo = cp.Line
+	d.lineStart = cp.LineStart
+	d.documents = cp.Documents
+	return d, nil
+}
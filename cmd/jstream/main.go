@@ -59,7 +59,7 @@ func main() {
 	}
 
 	if *verboseFlag {
-		fmt.Println("depth\tstart\tend\ttype   | value\n")
+		fmt.Print("depth\tstart\tend\ttype   | value\n\n")
 	}
 
 	decoder := jstream.NewDecoder(os.Stdin, *depthFlag)
@@ -0,0 +1,42 @@
+package jstream
+
+import "github.com/xenking/jstream/internal"
+
+// AllowComments enables // line comments and /* */ block comments
+// anywhere whitespace is allowed, as in JSONC
+func (d *Decoder) AllowComments() *Decoder {
+	d.comments = true
+	return d
+}
+
+// skipComment consumes a comment following the '/' at the current
+// position, reporting false if the '/' does not begin a comment
+func (d *Decoder) skipComment() bool {
+	switch d.Peek() {
+	case '/':
+		for c := d.Next(); c != '\n'; c = d.Next() {
+			if c == 0 && d.EOF() {
+				return true
+			}
+		}
+		d.lineStart = d.Pos
+		d.lineNo++
+		return true
+	case '*':
+		d.Next()
+		for c := d.Next(); ; c = d.Next() {
+			switch {
+			case c == '*' && d.Peek() == '/':
+				d.Next()
+				return true
+			case c == '\n':
+				d.lineStart = d.Pos
+				d.lineNo++
+			case c == 0 && d.EOF():
+				d.spaceErr = d.mkError(internal.ErrUnexpectedEOF, "in block comment")
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,17 +2,71 @@ package jstream
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"math"
+	"math/big"
+	"regexp"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
+	"unicode"
 	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/xenking/jstream/internal"
 	"github.com/xenking/jstream/internal/scanner"
 	data "github.com/xenking/jstream/internal/scratch"
 )
 
+const (
+	scratchSize   = 1024
+	scratchRetain = 1 << 16 // max scratch space retained between documents
+	defaultBuffer = 128     // capacity of the Stream channel
+	snippetSize   = 40      // bytes of input either side of a syntax error quoted by it
+	maxSizeHint   = 256     // max members allocated for an object ahead of decoding it
+)
+
+// ErrClosed is the error reported by a Decoder aborted by Close
+var ErrClosed = errors.New("jstream: decoder closed")
+
+// errStop stops decoding once the values allowed by Limit are emitted,
+// or a value satisfying StopWhen
+var errStop = errors.New("jstream: decoding stopped")
+
+// ErrNotSeekable is returned by SeekTo for readers not implementing
+// io.Seeker
+var ErrNotSeekable = errors.New("jstream: reader is not seekable")
+
+// SyntaxError is the type of the errors reported for malformed input,
+// which may be extracted with errors.As to find where decoding failed;
+// Err reports it unwrapped, such that it may also be type asserted. Its
+// position, the byte found there and the context are exported fields.
+// Offset is counted as for MetaValue.Offset. For an error at the end of
+// input, the position is that following its last byte.
+type SyntaxError = internal.SyntaxError
+
+// ErrSyntax is the syntax error reported, as determined by errors.Is, for
+// an invalid character in the input
+var ErrSyntax error = internal.ErrSyntax
+
+// ErrUnexpectedEOF is the syntax error reported, as determined by
+// errors.Is, for input ending within a value, positioned at the end of
+// input. It wraps io.ErrUnexpectedEOF. Empty and whitespace-only input
+// holds no values, and is not an error.
+var ErrUnexpectedEOF error = internal.ErrUnexpectedEOF
+
+// ErrNumberTooLong is the syntax error reported, as determined by
+// errors.Is, for numeric literals longer than allowed by MaxNumberLen
+var ErrNumberTooLong error = internal.ErrNumberTooLong
+
+// ErrTrailingData is the syntax error reported, as determined by
+// errors.Is, for input following the document with SingleDocument
+var ErrTrailingData error = internal.ErrTrailingData
+
 // ValueType - defines the type of each JSON value
 type ValueType int
 
@@ -30,56 +84,183 @@ const (
 // MetaValue wraps a decoded interface value with the document
 // position and depth at which the value was parsed
 type MetaValue struct {
-	Offset    int
-	Length    int
-	Depth     int
-	Keys      []string
-	Value     interface{}
-	ValueType ValueType
+	// Offset is the byte offset of the first byte of the value, counted
+	// from the start of the reader across all documents in the stream;
+	// for gzip input decoded by NewDecoderAuto, from the start of the
+	// decompressed input. For UTF-16 and UTF-32 input, Offset and Length
+	// are in bytes of the encoded input, not of its UTF-8 transcoding.
+	Offset int64
+	// Length is the number of bytes spanned by the value itself, never
+	// including surrounding whitespace or document separators
+	Length int64
+	// Line is the line number, starting at 1, of the first byte of the
+	// value
+	Line int
+	// Depth is the number of containers enclosing the value; top-level
+	// values are at depth 0
+	Depth int
+	// Keys holds one segment per enclosing container: the member key for
+	// objects, and for arrays either "" or, with IndexedKeys, the decimal
+	// element index. e.g. with IndexedKeys the 6 in [[1,2,3],[4,5,6]] has
+	// Keys ["1", "2"]. With IndexedKeys, Keys address the value within its
+	// document in every emit mode: the elements of a container have the
+	// Keys of the container followed by their own key or index. See
+	// FormatPath and FilterPath.
+	Keys []string
+	// Index is the position of the value within its enclosing array, or
+	// -1 if the value is not an array element
+	Index int
+	// ParentOffset is the Offset of the array or object enclosing the
+	// value, or -1 for top-level values. With Recursive, it links each
+	// value to its container, allowing the tree to be rebuilt.
+	ParentOffset int64
+	Value        interface{}
+	ValueType    ValueType
+	// Err is set, in NDJSON mode only, on values reporting a line that
+	// failed to decode; Value is then nil and Offset and Length span the
+	// line's content
+	Err error
+	// Source is the index of the reader the value was decoded from, for
+	// values emitted by a MultiDecoder, and 0 otherwise
+	Source int
+	// Raw holds the bytes of the value as they appear in the input, with
+	// EmitBoth; for a KV, those of the member's value
+	Raw []byte
 }
 
 // KV contains a key and value pair parsed from a decoded object
 type KV struct {
 	Key   string      `json:"key"`
 	Value interface{} `json:"value"`
+	// ValueType and Length, the number of bytes spanned by the value, are
+	// set on KVs emitted with EmitKV, but not on the members of a KVS
+	ValueType ValueType `json:"-"`
+	Length    int64     `json:"-"`
 }
 
 // KVS - represents key values in an JSON object
 type KVS []KV
 
 // MarshalJSON - implements converting a KVS datastructure into a JSON
-// object with multiple keys and values.
-func (kvs KVS) MarshalJSON() ([]byte, error) {
-	b := new(bytes.Buffer)
-	b.Write([]byte("{"))
-	for i, kv := range kvs {
-		b.Write([]byte("\"" + kv.Key + "\"" + ":"))
-		valBuf, err := json.Marshal(kv.Value)
-		if err != nil {
-			return nil, err
-		}
-		b.Write(valBuf)
-		if i < len(kvs)-1 {
-			b.Write([]byte(","))
-		}
-	}
-	b.Write([]byte("}"))
-	return b.Bytes(), nil
-}
+// object with multiple keys and values. HTML characters are not escaped
+// within it, leaving that to the encoding of the enclosing value.
+func (kvs KVS) MarshalJSON() ([]byte, error) { return marshal(kvs) }
 
 // Decoder wraps an io.Reader to provide incremental decoding of
 // JSON values
 type Decoder struct {
 	*scanner.Scanner
-	emitDepth     int
-	emitKV        bool
-	emitRecursive bool
-	objectAsKVS   bool
-
-	depth   int
-	scratch *data.Scratch
-	metaCh  chan *MetaValue
-	err     error
+	emitDepth      int
+	emitKV         bool
+	emitKeys       bool // with EmitKeysSeparately
+	emitBoth       bool
+	subStreams     bool
+	async          bool // values are received on another goroutine, from Stream
+	emitRecursive  bool
+	emitMax        int // deepest depth emitted when recursive
+	objectAsKVS    bool
+	indexedKeys    bool
+	validateUTF8   bool
+	replaceUTF8    bool
+	strictUnicode  bool
+	strict         bool
+	lenient        bool
+	strictEscapes  bool
+	relaxed        bool
+	rawStrings     bool
+	stringsAsBytes bool
+	unsafeStrings  bool
+	comments       bool
+	trailingComma  bool
+	nonFinite      bool
+	ndjson         bool
+	singleDoc      bool
+	singleValue    bool // set by NewDecoderAt
+	jsonSeq        bool
+	skipInvalid    bool
+	ordered        bool // with StreamParallel
+	poolValues     bool
+
+	// optional filters for object keys at emit depth
+	filterKeys map[string]struct{}
+	filterRe   *regexp.Regexp
+	filterPath []string
+	skipFn     func(keys []string) bool
+
+	// emitting the children of the values of object members by key, with
+	// EmitUnder
+	under       bool
+	underKey    string
+	underNested bool
+	underDepth  int // emit depth of the outermost such value being decoded, or 0
+
+	numberFn    func(raw []byte, isFloat bool) (interface{}, error)
+	bigInt      bool
+	maxNumLen   int
+	interned    map[string]string // object keys, with InternKeys
+	raw         bool              // emit the bytes of values, for WriteTo
+	offsetsOnly bool
+	hooks       []hook
+
+	input    *transcoder
+	readerAt io.ReaderAt // set by NewDecoderReaderAt and NewDecoderAt
+	depth    int
+	parents  []int64 // offsets of the containers being decoded
+	sizes    []int   // members of the last object stored at each depth
+	scratch  *data.Scratch
+	metaCh   chan *MetaValue
+	emitFn   func(*MetaValue) error
+	err      error
+
+	// keys of the value being decoded, for CurrentPath with TrackPath
+	trackPath bool
+	pathMu    sync.Mutex
+	path      []string
+
+	// aborting decoding from another goroutine
+	done      chan struct{}
+	finished  chan struct{}
+	abortErr  error
+	abortOnce sync.Once
+	aborting  int32 // set atomically by abort, before done is closed
+
+	// dropping repeated documents
+	dedup      *dedupWindow
+	dedupExact bool
+	held       []*MetaValue // values of the current document
+	duplicates int64
+	documents  int64 // top-level documents begun
+
+	stats *statCounters // counters enabled by CollectStats
+
+	onWarning func(error)
+	onEmit    func(*MetaValue) *MetaValue
+	tee       io.Writer
+
+	// delivering values to subscribers
+	subscribers []chan *MetaValue
+	slowPolicy  SlowSubscriberPolicy
+	dropped     int64
+
+	// reporting progress
+	progressFn    func(bytesRead, valuesEmitted int64)
+	progressEvery int64
+	progressNext  int64 // bytes consumed at which to next report
+	emitted       int64
+	limit         int64 // values to emit before stopping, if > 0
+	stopFn        func(*MetaValue) bool
+	skipValues    int64 // values at emit depth left to discard
+
+	// counts published once decoding completes, for Stats
+	values  int64
+	elapsed int64
+
+	// containers above the emit depth opened by DecodeNext
+	frames []*SubStream
+
+	// error found while skipping whitespace, reported in place of any
+	// error caused by the truncated input
+	spaceErr error
 
 	// follow line position to add context to errors
 	lineNo    int
@@ -89,12 +270,42 @@ type Decoder struct {
 // NewDecoder creates new Decoder to read JSON values at the provided
 // emitDepth from the provider io.Reader.
 // If emitDepth is < 0, values at every depth will be emitted.
+// UTF-16 and UTF-32 input, with or without a byte order mark, is detected
+// from its first bytes and transcoded to UTF-8 before decoding.
+// Top-level values, scalars included, are at depth 0, and the elements
+// of a top-level container at depth 1: a document holding only a scalar
+// such as 42 emits it at depth 0 and nothing at any greater depth.
 func NewDecoder(r io.Reader, emitDepth int) *Decoder {
+	return newDecoder(r, 0, emitDepth)
+}
+
+// NewDecoderAt creates a Decoder reading the single JSON value beginning
+// at offset in r, such as the Offset of a value emitted by an earlier
+// Decoder, and emitting values at emitDepth within it. Decoding stops
+// after that value, without reading the remainder of r. Offsets of values
+// are relative to the start of r, while Depth, Keys and Line are relative
+// to the value.
+func NewDecoderAt(r io.ReaderAt, offset int64, emitDepth int) *Decoder {
+	d := newDecoder(io.NewSectionReader(r, offset, math.MaxInt64-offset), offset, emitDepth)
+	d.singleValue = true
+	d.readerAt = r
+	return d
+}
+
+// newDecoder creates a Decoder for r, which begins at the given offset of
+// its input
+func newDecoder(r io.Reader, offset int64, emitDepth int) *Decoder {
+	tc := newTranscoder(r, offset)
 	d := &Decoder{
-		Scanner:   scanner.New(r),
+		input:     tc,
+		Scanner:   scanner.NewAt(tc, scanner.DefaultLookback, offset),
+		lineStart: offset,
 		emitDepth: emitDepth,
-		scratch:   &data.Scratch{Data: make([]byte, 1024)},
-		metaCh:    make(chan *MetaValue, 128),
+		emitMax:   math.MaxInt,
+		scratch:   &data.Scratch{Data: make([]byte, scratchSize)},
+		metaCh:    make(chan *MetaValue, defaultBuffer),
+		done:      make(chan struct{}),
+		finished:  make(chan struct{}),
 	}
 	if emitDepth < 0 {
 		d.emitDepth = 0
@@ -103,10 +314,237 @@ func NewDecoder(r io.Reader, emitDepth int) *Decoder {
 	return d
 }
 
+// SeekTo repositions decoding at offset in the underlying reader, which
+// must implement io.Seeker, such as to resume decoding from the Offset of
+// a top-level value emitted by an earlier Decoder. It must be called
+// before decoding begins. Offsets of values remain relative to the start
+// of the reader, while Line numbers count from the line at offset. The
+// Decoder must not be used if seeking fails.
+func (d *Decoder) SeekTo(offset int64) error {
+	seeker, ok := d.input.r.(io.Seeker)
+	if !ok {
+		return ErrNotSeekable
+	}
+	d.Scanner.Stop() // the scanner reads ahead from the reader
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	d.input = newTranscoder(d.input.r, offset)
+	d.Scanner = scanner.NewAt(d.input, d.Lookback(), offset)
+	if d.tee != nil {
+		d.Scanner.Tee(d.tee)
+	}
+	if d.progressFn != nil {
+		d.Scanner.OnRefill(d.progress)
+	}
+	if d.stopFn != nil {
+		d.Scanner.ReadOnDemand()
+	}
+	d.depth = 0
+	d.parents = d.parents[:0]
+	d.lineNo = 0
+	d.lineStart = offset
+	return nil
+}
+
+// Tee mirrors the input consumed by the decoder to w, including any
+// whitespace, in order and once each: unlike with io.TeeReader, input
+// the scanner has read ahead but not yet reached is not written. Input is
+// written in chunks as decoding proceeds, and in full by the time Stream
+// or Walk complete, through the position reported by BytesConsumed. UTF-16
+// and UTF-32 input is written as transcoded to UTF-8. The first error
+// returned by w, after which nothing more is written, is reported by Err
+// if decoding otherwise succeeds.
+func (d *Decoder) Tee(w io.Writer) *Decoder {
+	d.tee = w
+	d.Scanner.Tee(w)
+	return d
+}
+
+// OnProgress sets a function called, on the decoding goroutine, with the
+// number of bytes consumed from the reader and of values emitted so far.
+// It is called at most once per everyNBytes consumed, as input is read and
+// values are emitted, and a final time once decoding completes; both
+// counts increase monotonically. It panics if everyNBytes is less than 1.
+func (d *Decoder) OnProgress(fn func(bytesRead, valuesEmitted int64), everyNBytes int64) *Decoder {
+	if everyNBytes < 1 {
+		panic("jstream: invalid OnProgress interval")
+	}
+	d.progressFn = fn
+	d.progressEvery = everyNBytes
+	d.progressNext = everyNBytes
+	d.Scanner.OnRefill(d.progress)
+	return d
+}
+
+// OnEmit sets a function called, on the decoding goroutine, with each
+// value about to be emitted, such as to redact or reshape values before
+// they reach the consumer: fn may modify mv, return a replacement to emit
+// in its place, or return nil to drop it. Dropped values are not counted
+// by Limit or OnProgress. With StreamParallel, fn is called on the
+// goroutine delivering elements.
+func (d *Decoder) OnEmit(fn func(mv *MetaValue) *MetaValue) *Decoder {
+	d.onEmit = fn
+	return d
+}
+
+// progress reports progress if at least the configured interval has
+// been consumed since it was last reported
+func (d *Decoder) progress() {
+	if n := d.BytesConsumed(); n >= d.progressNext {
+		d.progressFn(n, d.emitted)
+		d.progressNext = n + d.progressEvery
+	}
+}
+
+// send passes mv on to the consumer of the decoder
+func (d *Decoder) send(mv *MetaValue) error {
+	d.Publish()
+	if d.onEmit != nil {
+		if mv = d.onEmit(mv); mv == nil {
+			return nil
+		}
+	}
+	stop := d.stopFn != nil && d.stopFn(mv)
+	if err := d.emitFn(mv); err != nil {
+		return err
+	}
+	if d.subscribers != nil {
+		if err := d.publish(mv); err != nil {
+			return err
+		}
+	}
+	d.emitted++
+	if d.progressFn != nil {
+		d.progress()
+	}
+	if d.emitted == d.limit || stop {
+		return errStop
+	}
+	return nil
+}
+
+// Limit stops decoding once n values have been emitted, as when sampling
+// the head of a large input: Stream's channel is then closed, and Walk
+// returns, with Err reporting nil, and no more input is read. A limit of
+// 0, the default, emits every value; n must not be negative.
+func (d *Decoder) Limit(n int) *Decoder {
+	if n < 0 {
+		panic("jstream: negative Limit")
+	}
+	d.limit = int64(n)
+	return d
+}
+
+// StopWhen stops decoding once a value for which fn reports true has been
+// emitted, as Limit does, such as on finding a record of interest within
+// a stream: fn is called on the decoding goroutine with each value before
+// it is emitted. The input is then no longer read ahead of decoding, such
+// that no more of the reader is consumed than the values decoded and the
+// remainder of the last read, reported by Buffered, and the reader may
+// continue to be read from BytesConsumed once Stream or Walk complete.
+func (d *Decoder) StopWhen(fn func(mv *MetaValue) bool) *Decoder {
+	d.stopFn = fn
+	d.Scanner.ReadOnDemand()
+	return d
+}
+
+// Buffered returns a reader of the input read from the underlying reader
+// but not consumed by decoding, through which reading may continue past
+// where decoding stopped, as with StopWhen. It is valid once decoding has
+// completed, and for UTF-8 input only; without StopWhen, input read ahead
+// of decoding is lost.
+func (d *Decoder) Buffered() io.Reader {
+	return bytes.NewReader(d.Scanner.Buffered())
+}
+
+// SkipValues discards the first n values at the emit depth, scanning them
+// without decoding, such that emission begins with the value following
+// them, with its usual position and Keys; with Limit, this selects a
+// window of the values of a large input. Values rejected by key filters
+// or SkipIf are not counted. It panics if n is negative.
+func (d *Decoder) SkipValues(n int) *Decoder {
+	if n < 0 {
+		panic("jstream: negative SkipValues")
+	}
+	d.skipValues = int64(n)
+	return d
+}
+
+// skipping reports whether the value with keys, beginning at the current
+// position, is to be discarded by SkipValues, counting it if so
+func (d *Decoder) skipping(keys []string) bool {
+	if d.skipValues == 0 || d.depth != d.emitDepth || d.skipIf(keys) {
+		return false
+	}
+	d.skipValues--
+	return true
+}
+
+// NumberFunc sets a function decoding numeric literals in place of
+// strconv, such as to arbitrary precision: fn is passed the literal's
+// bytes, including any minus sign, and whether it has a fraction or
+// exponent, and returns the value to decode it as. The bytes are only
+// valid for the duration of the call.
+func (d *Decoder) NumberFunc(fn func(raw []byte, isFloat bool) (interface{}, error)) *Decoder {
+	d.numberFn = fn
+	return d
+}
+
+// UseBigInt decodes integer literals beyond the range of an int64 as
+// *big.Int, rather than failing with a range error; integers within range
+// remain int64
+func (d *Decoder) UseBigInt() *Decoder {
+	d.bigInt = true
+	return d
+}
+
+// MaxNumberLen limits numeric literals, including any sign, to n bytes,
+// beyond which decoding fails with ErrNumberTooLong rather than buffering
+// the literal in full. A limit of 0, the default, leaves numbers
+// unlimited; n must not be negative.
+func (d *Decoder) MaxNumberLen(n int) *Decoder {
+	if n < 0 {
+		panic("jstream: negative MaxNumberLen")
+	}
+	d.maxNumLen = n
+	return d
+}
+
+// ChannelBuffer sets the capacity of the channel returned by Stream,
+// which is 128 by default. Larger buffers reduce switching between the
+// decoding and consuming goroutines, while smaller ones bound the memory
+// held by decoded values awaiting the consumer. It must be called before
+// Stream, and panics if n is negative.
+func (d *Decoder) ChannelBuffer(n int) *Decoder {
+	if n < 0 {
+		panic("jstream: negative ChannelBuffer size")
+	}
+	d.metaCh = make(chan *MetaValue, n)
+	return d
+}
+
+// EmitRange enables emitting values at every depth from min through max
+// inclusive, in the order of Recursive. Deeper values are still decoded
+// as part of the containers holding them, but are not emitted. It panics
+// if min is negative or greater than max.
+func (d *Decoder) EmitRange(min, max int) *Decoder {
+	if min < 0 || min > max {
+		panic("jstream: invalid EmitRange")
+	}
+	d.emitDepth = min
+	d.emitMax = max
+	d.emitRecursive = true
+	return d
+}
+
 // ObjectAsKVS - by default JSON returns map[string]interface{} this
 // is usually fine in most cases, but when you need to preserve the
 // input order its not a right data structure. To preserve input
-// order please use this option.
+// order please use this option. It applies at every depth: objects
+// nested within a KVS, or within arrays, are decoded as KVS too, such
+// that MarshalJSON reproduces the order of all members.
 func (d *Decoder) ObjectAsKVS() *Decoder {
 	d.objectAsKVS = true
 	return d
@@ -120,130 +558,781 @@ func (d *Decoder) EmitKV() *Decoder {
 	return d
 }
 
+// EmitKeysSeparately emits the key of each object member at emit depth as
+// a MetaValue of its own, of ValueType String and spanning the quoted key,
+// immediately before the MetaValue of the member's value, for consumers
+// tracking keys as events rather than by Keys. It has no effect with
+// EmitKV, whose KVs carry the key.
+func (d *Decoder) EmitKeysSeparately() *Decoder {
+	d.emitKeys = true
+	return d
+}
+
+// EmitBoth sets the Raw field of each MetaValue emitted to the bytes of
+// its value as they appear in the input, besides decoding it to Value,
+// such as to route values by their contents while forwarding them intact.
+// With UTF-16 and UTF-32 input, Raw holds the UTF-8 transcoding. Keys
+// emitted by EmitKeysSeparately have no Raw.
+func (d *Decoder) EmitBoth() *Decoder {
+	d.emitBoth = true
+	return d
+}
+
 // Recursive enables emitting all values at a depth higher than the
 // configured emit depth; e.g. if an array is found at emit depth, all
 // values within the array are emitted to the stream, then the array
-// containing those values is emitted.
+// containing those values is emitted. An empty container is emitted
+// alone, as an empty, non-nil slice, map or KVS.
 func (d *Decoder) Recursive() *Decoder {
 	d.emitRecursive = true
 	return d
 }
 
+// OffsetsOnly emits values without decoding them: the Value of each
+// MetaValue is nil, or with EmitKV a KV with a nil Value, while position,
+// Keys and ValueType are reported as usual, such as to index the input
+// for later use with DecodeValueAt. Values within those emitted are
+// skipped unless emitted themselves, with Recursive.
+func (d *Decoder) OffsetsOnly() *Decoder {
+	d.offsetsOnly = true
+	return d
+}
+
+// IndexedKeys enables recording the element index, rather than "", as
+// the Keys segment of values within arrays. This allows addressing
+// values nested in arrays, at the cost of allocating Keys per element.
+func (d *Decoder) IndexedKeys() *Decoder {
+	d.indexedKeys = true
+	return d
+}
+
+// Strict rejects input that is accepted by default for compatibility but
+// is not valid JSON as defined by RFC 8259, such as the \' string escape;
+// it implies StrictEscapes and disables Lenient. A syntax error at Unicode
+// whitespace other than the space, tab, carriage return and line feed of
+// JSON names the character, as in "U+00A0 not allowed as whitespace".
+func (d *Decoder) Strict() *Decoder {
+	d.strict = true
+	d.strictEscapes = true
+	return d
+}
+
+// Lenient accepts the no-break space U+00A0 and the byte order mark
+// U+FEFF as whitespace between tokens, as found in text pasted from
+// documents or concatenated from files, besides the space, tab, carriage
+// return and line feed of JSON. It has no effect with Strict.
+func (d *Decoder) Lenient() *Decoder {
+	d.lenient = true
+	return d
+}
+
+// StrictEscapes rejects string escapes, in values and object keys alike,
+// other than those defined by RFC 8259, with a syntax error "in string
+// escape code" at the escaped character. The \' escape, otherwise
+// accepted for compatibility, is then an error, except within the single
+// quoted strings of Relaxed. Escapes undefined by any grammar, such as
+// \x, are always rejected.
+func (d *Decoder) StrictEscapes() *Decoder {
+	d.strictEscapes = true
+	return d
+}
+
+// SingleDocument requires the input to hold exactly one JSON value, as
+// when validating a payload: any data other than whitespace following it
+// is an ErrTrailingData syntax error at the first such byte, reported
+// once the value has been emitted. By default, concatenated values are
+// decoded in turn.
+func (d *Decoder) SingleDocument() *Decoder {
+	d.singleDoc = true
+	return d
+}
+
+// RawStrings disables unescaping of strings: string values and object
+// keys are decoded as their source bytes between the quotes, with escape
+// sequences such as \n and \u00e9 left as written. Escapes are still
+// checked to be well-formed. Key filters match keys in this raw form.
+func (d *Decoder) RawStrings() *Decoder {
+	d.rawStrings = true
+	return d
+}
+
+// StringsAsBytes decodes string values, though not object keys, as
+// []byte rather than string, with ValueType still String. Each slice is
+// a copy owned by the consumer, and safe to retain and modify.
+func (d *Decoder) StringsAsBytes() *Decoder {
+	d.stringsAsBytes = true
+	return d
+}
+
+// UnsafeStrings is like StringsAsBytes, but avoids copying the string
+// values emitted with Walk: the slices of those not stored in an
+// enclosing container alias the Decoder's internal buffer, and are only
+// valid until the callback returns, after which they are overwritten. A
+// slice must be copied to be retained. Strings within emitted containers,
+// and all strings with Stream, ReadAll and options holding values until
+// their document is complete, are copied as with StringsAsBytes.
+func (d *Decoder) UnsafeStrings() *Decoder {
+	d.stringsAsBytes = true
+	d.unsafeStrings = true
+	return d
+}
+
+// AllowTrailingCommas accepts a single comma following the last element
+// of an array or member of an object, as in [1,2,3,] and {"a":1,}
+func (d *Decoder) AllowTrailingCommas() *Decoder {
+	d.trailingComma = true
+	return d
+}
+
+// AllowNonFiniteNumbers accepts the literals NaN, Infinity and -Infinity,
+// as written by e.g. Python's json module, decoding them as the
+// corresponding float64 values
+func (d *Decoder) AllowNonFiniteNumbers() *Decoder {
+	d.nonFinite = true
+	return d
+}
+
+// StrictUnicode makes unpaired UTF-16 surrogates in \u escapes a syntax
+// error at the offending escape. By default, as in encoding/json, each is
+// replaced with the Unicode replacement character U+FFFD.
+func (d *Decoder) StrictUnicode() *Decoder {
+	d.strictUnicode = true
+	return d
+}
+
+// StrictUTF8 rejects strings that would not decode to valid UTF-8, due to
+// either invalid byte sequences or unpaired surrogate escapes, with a
+// syntax error at the offending bytes. It combines ValidateUTF8(false)
+// and StrictUnicode.
+func (d *Decoder) StrictUTF8() *Decoder {
+	return d.ValidateUTF8(false).StrictUnicode()
+}
+
+// ValidateUTF8 enables validation of the UTF-8 encoding of strings. If
+// replace is true, each byte of an invalid sequence is replaced with the
+// Unicode replacement character U+FFFD, matching encoding/json; otherwise
+// decoding fails with a syntax error at the invalid sequence.
+func (d *Decoder) ValidateUTF8(replace bool) *Decoder {
+	d.validateUTF8 = true
+	d.replaceUTF8 = replace
+	return d
+}
+
+// FilterKeys restricts the object members decoded at the configured
+// emit depth to those with one of the given keys. Values of all other
+// keys are skipped without being decoded. May be combined with
+// FilterKeysRegexp, in which case a key matching either is accepted.
+func (d *Decoder) FilterKeys(keys ...string) *Decoder {
+	if d.filterKeys == nil {
+		d.filterKeys = make(map[string]struct{}, len(keys))
+	}
+	for _, k := range keys {
+		d.filterKeys[k] = struct{}{}
+	}
+	return d
+}
+
+// FilterKeysRegexp restricts the object members decoded at the configured
+// emit depth to those with a key matching re. Values of all other keys
+// are skipped without being decoded.
+func (d *Decoder) FilterKeysRegexp(re *regexp.Regexp) *Decoder {
+	d.filterRe = re
+	return d
+}
+
+// SkipIf skips the values at the configured emit depth for which fn
+// returns true, given the value's Keys: each is advanced past, checking
+// only its structure, without being decoded or emitted. The keys must not
+// be retained by fn. Array elements are only distinguished by their Keys
+// with IndexedKeys.
+func (d *Decoder) SkipIf(fn func(keys []string) bool) *Decoder {
+	d.skipFn = fn
+	return d
+}
+
+// skipIf reports whether the value with the given Keys, at the current
+// depth, is to be skipped as set by SkipIf
+func (d *Decoder) skipIf(keys []string) bool {
+	return d.skipFn != nil && d.depth == d.emitDepth && d.skipFn(keys)
+}
+
 // Stream begins decoding from the underlying reader and returns a
 // streaming MetaValue channel for JSON values at the configured emitDepth.
+// The channel is closed once decoding ends, after Err is set: Err may be
+// called as soon as a receive reports the channel closed.
 func (d *Decoder) Stream() chan *MetaValue {
-	go d.decode()
+	d.unsafeStrings = false // values outlive the emit
+	d.async = true
+	d.emitFn = func(mv *MetaValue) error {
+		select {
+		case d.metaCh <- mv:
+			return nil
+		case <-d.done:
+			return d.abortErr
+		}
+	}
+	go func() {
+		d.err = d.run()
+		d.closeSubscribers()
+		close(d.metaCh)
+		close(d.finished)
+	}()
 	return d.metaCh
 }
 
-// Pos returns the number of bytes consumed from the underlying reader
-func (d *Decoder) GetPos() int { return int(d.Pos) }
+// StreamContext is like Stream, but decoding is aborted as by Close when
+// ctx is done, with Err reporting the context's error.
+func (d *Decoder) StreamContext(ctx context.Context) chan *MetaValue {
+	go func() {
+		select {
+		case <-ctx.Done():
+			d.abort(ctx.Err())
+		case <-d.finished:
+		}
+	}()
+	return d.Stream()
+}
+
+// Walk decodes from the underlying reader synchronously, calling fn for
+// each JSON value at the configured emitDepth, as an alternative to
+// Stream; the two must not be combined on the same Decoder. Decoding
+// stops at the first error returned by fn, which Walk then returns.
+func (d *Decoder) Walk(fn func(*MetaValue) error) error {
+	d.emitFn = fn
+	d.err = d.run()
+	d.closeSubscribers()
+	close(d.finished)
+	return d.err
+}
+
+// ReadAll decodes the input synchronously, as by Walk, returning every
+// value emitted along with Err. On error, the values emitted before it
+// are returned.
+func (d *Decoder) ReadAll() ([]*MetaValue, error) {
+	d.unsafeStrings = false // values outlive the emit
+	var values []*MetaValue
+	err := d.Walk(func(mv *MetaValue) error {
+		values = append(values, mv)
+		return nil
+	})
+	return values, err
+}
+
+// Close aborts decoding from any goroutine, even in the middle of a large
+// value: Stream's channel is closed and Walk returns promptly, with Err
+// reporting ErrClosed. Values already buffered in the channel may still
+// be received. It is safe to call more than once.
+func (d *Decoder) Close() error {
+	d.abort(ErrClosed)
+	return nil
+}
+
+// abort stops decoding with err, unless already aborted
+func (d *Decoder) abort(err error) {
+	d.abortOnce.Do(func() {
+		d.abortErr = err
+		atomic.StoreInt32(&d.aborting, 1)
+		close(d.done)
+		d.Scanner.Close()
+	})
+}
+
+// aborted reports whether decoding was aborted, by Close or the context
+// of StreamContext, such that the decoding loops stop with abortErr
+// rather than run until the closed scanner reports the end of input. It
+// is checked for each element, so loads a flag rather than selecting on
+// done.
+func (d *Decoder) aborted() bool { return atomic.LoadInt32(&d.aborting) != 0 }
+
+// readErr returns the error of the underlying reader on which the input
+// ended, if any, in place of err, which then reports the input ending
+func (d *Decoder) readErr(err error) error {
+	if rerr := d.ReadErr(); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// run decodes the input until exhausted or aborted, then stops the scanner
+func (d *Decoder) run() error {
+	start := time.Now()
+	err := d.readErr(d.decode())
+	d.FlushTee()
+	d.Publish()
+	d.Scanner.Close()
+	if err == nil {
+		err = d.TeeErr()
+	}
+	if d.progressFn != nil {
+		d.progressFn(d.BytesConsumed(), d.emitted)
+	}
+	atomic.StoreInt64(&d.values, d.emitted)
+	atomic.StoreInt64(&d.elapsed, int64(time.Since(start)))
+
+	select {
+	case <-d.done:
+		return d.abortErr
+	default:
+	}
+	if err == errStop {
+		return nil
+	}
+	return err
+}
+
+// StreamRows begins decoding from the underlying reader and returns a
+// channel of rows for homogeneous numeric matrices such as
+// [[1,2,3],[4,5,6]]: each array at the configured emitDepth is delivered
+// as a []float64. Decoding stops with an error if a value at emitDepth is
+// not an array of numbers. The channel is closed once decoding ends, as
+// for Stream, after Err is set to report the error, or ErrClosed should
+// the consumer stop receiving and call Close.
+func (d *Decoder) StreamRows() <-chan []float64 {
+	rows := make(chan []float64, cap(d.metaCh))
+	go func() {
+		d.Walk(func(mv *MetaValue) error {
+			v := mv.Value
+			if kv, ok := v.(KV); ok {
+				v = kv.Value
+			}
+			arr, ok := v.([]interface{})
+			if !ok {
+				return fmt.Errorf("jstream: value at offset %d is not an array", mv.Offset)
+			}
+			row := make([]float64, len(arr))
+			for i, n := range arr {
+				switch n := n.(type) {
+				case int64:
+					row[i] = float64(n)
+				case float64:
+					row[i] = n
+				default:
+					return fmt.Errorf("jstream: array at offset %d has non-numeric element %d", mv.Offset, i)
+				}
+			}
+			select {
+			case rows <- row:
+				return nil
+			case <-d.done:
+				return d.abortErr
+			}
+		})
+		close(rows)
+	}()
+	return rows
+}
+
+// GetPos returns the number of bytes consumed from the underlying reader;
+// see BytesConsumed.
+//
+// Deprecated: the count may overflow on 32-bit platforms; use
+// BytesConsumed instead.
+func (d *Decoder) GetPos() int { return int(d.BytesConsumed()) }
+
+// BytesConsumed returns the number of bytes consumed from the underlying
+// reader. It is safe to call concurrently with decoding: the count is
+// exact as of the end of the most recently emitted value, and otherwise
+// lags decoding by at most one buffer fill.
+func (d *Decoder) BytesConsumed() int64 { return d.input.source(d.Consumed()) }
+
+// TrackPath records the keys of the value being decoded, for CurrentPath.
+// It is off by default, as recording them for each value slows decoding.
+func (d *Decoder) TrackPath() *Decoder {
+	d.trackPath = true
+	return d
+}
+
+// CurrentPath returns the keys of the value being decoded by Stream or
+// Walk with TrackPath, as in its MetaValue: from a Walk callback, those
+// of the value passed to it, unless held until its document is complete
+// as with NDJSON. It is safe to call concurrently with decoding, when the
+// result reflects the position reached by the decoder, which may be ahead
+// of the values received from Stream. It is empty at the top level, and
+// once decoding fails reports the keys of the value at fault. Without
+// TrackPath, it is always empty.
+func (d *Decoder) CurrentPath() []string {
+	d.pathMu.Lock()
+	defer d.pathMu.Unlock()
+	return append([]string(nil), d.path...)
+}
+
+// setPath records the keys of the value being decoded, with TrackPath
+func (d *Decoder) setPath(keys []string) {
+	if !d.trackPath {
+		return
+	}
+	d.pathMu.Lock()
+	d.path = keys
+	d.pathMu.Unlock()
+}
+
+// offset returns the offset in the input of the byte at the current
+// position, before any transcoding
+func (d *Decoder) offset() int64 { return d.input.source(d.Pos - 1) }
+
+// end returns the offset in the input following the byte at the current
+// position, before any transcoding
+func (d *Decoder) end() int64 { return d.input.source(d.Pos) }
 
 // Err returns the most recent decoder error if any, or nil
 func (d *Decoder) Err() error { return d.err }
 
-// Decode parses the JSON-encoded data and returns an interface value
-func (d *Decoder) decode() {
-	defer close(d.metaCh)
-	d.skipSpaces()
-	for d.Pos < atomic.LoadInt64(&d.End) {
-		_, err := d.emitAny([]string{})
-		if err != nil {
-			d.err = err
-			break
+// Done returns a channel closed once decoding by Stream, Walk or the
+// methods based on them ends, such as for consumers to select on along
+// with other events. Err is set, and the channels of Stream and any
+// subscribers closed, before Done is closed.
+func (d *Decoder) Done() <-chan struct{} { return d.finished }
+
+// EmitDepth returns the depth at which values are emitted, or from which
+// they are emitted with Recursive. A negative depth passed to NewDecoder
+// is reported as 0, with IsRecursive true.
+func (d *Decoder) EmitDepth() int { return d.emitDepth }
+
+// IsRecursive reports whether Recursive is enabled
+func (d *Decoder) IsRecursive() bool { return d.emitRecursive }
+
+// IsEmitKV reports whether EmitKV is enabled
+func (d *Decoder) IsEmitKV() bool { return d.emitKV }
+
+// IsObjectAsKVS reports whether ObjectAsKVS is enabled
+func (d *Decoder) IsObjectAsKVS() bool { return d.objectAsKVS }
+
+// Stats holds counters describing the input decoded so far
+type Stats struct {
+	// Documents is the number of top-level documents decoded, including
+	// any dropped as duplicates or invalid
+	Documents int
+	// Duplicates is the number of documents dropped by DedupWindow
+	Duplicates int
+	// Dropped is the number of deliveries of values to subscribers skipped
+	// by DropSlowSubscribers
+	Dropped int
+
+	// Counts of values decoded by type, and the greatest Depth of any
+	// value decoded; these are only collected with CollectStats. Object
+	// keys are not counted as strings, and values skipped by key and
+	// path filters are not counted.
+	Objects  int
+	Arrays   int
+	Strings  int
+	Numbers  int
+	Booleans int
+	Nulls    int
+	MaxDepth int
+
+	// Bytes is the number of bytes consumed from the reader; see
+	// BytesConsumed
+	Bytes int64
+
+	// Values is the number of values emitted, and Duration the time spent
+	// decoding by Stream or Walk; both are set once decoding completes
+	Values   int
+	Duration time.Duration
+}
+
+// statCounters holds the counters enabled by CollectStats, updated
+// atomically such that Stats may be called during decoding
+type statCounters struct {
+	values   [Object + 1]int64 // indexed by ValueType
+	maxDepth int64
+}
+
+func (c *statCounters) count(t ValueType, depth int) {
+	atomic.AddInt64(&c.values[t], 1)
+	if int64(depth) > atomic.LoadInt64(&c.maxDepth) {
+		atomic.StoreInt64(&c.maxDepth, int64(depth))
+	}
+}
+
+// CollectStats enables counting the values decoded by type, as reported
+// by Stats. Counting is disabled by default to avoid its cost.
+func (d *Decoder) CollectStats() *Decoder {
+	d.stats = &statCounters{}
+	return d
+}
+
+// Stats returns the decoder's counters; it is safe to call while a
+// Stream is being decoded
+func (d *Decoder) Stats() Stats {
+	s := Stats{
+		Documents:  int(atomic.LoadInt64(&d.documents)),
+		Duplicates: int(atomic.LoadInt64(&d.duplicates)),
+		Dropped:    int(atomic.LoadInt64(&d.dropped)),
+		Bytes:      d.BytesConsumed(),
+		Values:     int(atomic.LoadInt64(&d.values)),
+		Duration:   time.Duration(atomic.LoadInt64(&d.elapsed)),
+	}
+	if c := d.stats; c != nil {
+		s.Objects = int(atomic.LoadInt64(&c.values[Object]))
+		s.Arrays = int(atomic.LoadInt64(&c.values[Array]))
+		s.Strings = int(atomic.LoadInt64(&c.values[String]))
+		s.Numbers = int(atomic.LoadInt64(&c.values[Number]))
+		s.Booleans = int(atomic.LoadInt64(&c.values[Boolean]))
+		s.Nulls = int(atomic.LoadInt64(&c.values[Null]))
+		s.MaxDepth = int(atomic.LoadInt64(&c.maxDepth))
+	}
+	return s
+}
+
+// decode parses JSON values until the underlying reader is exhausted,
+// or decoding is aborted
+func (d *Decoder) decode() error {
+	for decoded := false; ; decoded = true {
+		if d.aborted() {
+			return d.abortErr
+		}
+		c := d.skipDocSpaces()
+		if c == 0 && d.EOF() {
+			if d.singleDoc && d.spaceErr == nil {
+				return d.mkError(internal.ErrUnexpectedEOF) // no document
+			}
+			return d.spaceErr
+		}
+		if decoded && !d.ndjson && !d.jsonSeq && !d.valueStart(c) {
+			// neither whitespace nor another document follows a value
+			return d.mkError(internal.ErrSyntax, "after top-level value")
+		}
+		atomic.AddInt64(&d.documents, 1)
+		if d.holdsDocuments() {
+			if err := d.emitDocument(); err != nil {
+				return err
+			}
+		} else if _, err := d.emitAny([]string{}, -1); err != nil {
+			return err
+		}
+		// release scratch space grown by an unusually large value
+		d.scratch.ResetCap(scratchRetain)
+
+		if d.singleValue {
+			return nil
+		}
+		if d.singleDoc {
+			if c := d.skipSpaces(); c != 0 || !d.EOF() {
+				return d.mkError(internal.ErrTrailingData)
+			}
+			return d.spaceErr
 		}
-		d.skipSpaces()
 	}
 }
 
-func (d *Decoder) emitAny(pKeys []string) (interface{}, error) {
-	if d.Pos >= atomic.LoadInt64(&d.End) {
+func (d *Decoder) emitAny(pKeys []string, index int) (interface{}, error) {
+	if d.EOF() {
 		return nil, d.mkError(internal.ErrUnexpectedEOF)
 	}
-	offset := d.Pos - 1
-	i, t, err := d.any(pKeys)
-	if d.willEmit() {
-		d.metaCh <- &MetaValue{
-			Offset:    int(offset),
-			Length:    int(d.Pos - offset),
-			Depth:     d.depth,
-			Keys:      pKeys,
-			Value:     i,
-			ValueType: t,
-		}
+	if d.skipIf(pKeys) || d.skipping(pKeys) {
+		return nil, d.skip()
+	}
+	if d.emitsSubStream() {
+		return nil, d.emitSubStream(pKeys, index)
+	}
+	offset, line := d.offset(), d.lineNo+1
+	capture := d.emitBoth && d.willEmit()
+	if capture {
+		d.StartCapture()
+	}
+	i, t, err := d.emitValue(pKeys)
+	var raw []byte
+	if capture {
+		raw = append([]byte(nil), d.Captured()...)
+	}
+	if err == nil && d.willEmit() {
+		err = d.emit(d.newMetaValue(MetaValue{
+			Offset:       offset,
+			Length:       d.end() - offset,
+			Line:         line,
+			Depth:        d.depth,
+			Keys:         pKeys,
+			Index:        index,
+			ParentOffset: d.parent(),
+			Value:        i,
+			ValueType:    t,
+			Raw:          raw,
+		}))
 	}
 	return i, err
 }
 
+// emit passes mv on to the consumer of the decoder, if any
+func (d *Decoder) emit(mv *MetaValue) error {
+	if d.emitFn == nil {
+		return nil
+	}
+	if d.holdsDocuments() {
+		d.held = append(d.held, mv)
+		return nil
+	}
+	return d.send(mv)
+}
+
+// emitKey emits the key k of an object member as a value of its own, as
+// with EmitKeysSeparately
+func (d *Decoder) emitKey(k string, keys []string, offset, length int64, line int) error {
+	return d.emit(d.newMetaValue(MetaValue{
+		Offset:       offset,
+		Length:       length,
+		Line:         line,
+		Depth:        d.depth,
+		Keys:         keys,
+		Index:        -1,
+		ParentOffset: d.parent(),
+		Value:        k,
+		ValueType:    String,
+	}))
+}
+
+// parent returns the offset of the innermost container being decoded, or
+// -1 at the top level
+func (d *Decoder) parent() int64 {
+	if len(d.parents) == 0 {
+		return -1
+	}
+	return d.parents[len(d.parents)-1]
+}
+
+// holdsDocuments reports whether emitted values are held until their
+// document is complete, as by emitDocument
+func (d *Decoder) holdsDocuments() bool {
+	return d.dedup != nil || d.ndjson || d.jsonSeq
+}
+
 // return whether, at the current depth, the value being decoded will
 // be emitted to stream
 func (d *Decoder) willEmit() bool {
 	if d.emitRecursive {
-		return d.depth >= d.emitDepth
+		return d.depth >= d.emitDepth && d.depth <= d.emitMax
 	}
 	return d.depth == d.emitDepth
 }
 
+// usesKeys reports whether the Keys of values at the current depth are
+// used, by values emitted at or within them, by EmitUnder, which may
+// emit the children of any value, or by hooks and TrackPath. Otherwise,
+// values are passed the Keys of their container, to avoid allocating
+// their own.
+func (d *Decoder) usesKeys() bool {
+	return !d.stores() || d.emitRecursive && d.depth <= d.emitMax ||
+		d.under || d.hooks != nil || d.trackPath
+}
+
+// stores reports whether values at the current depth are stored in their
+// container, which is emitted or stored itself
+func (d *Decoder) stores() bool {
+	return d.depth > d.emitDepth || d.underDepth != 0 && d.depth > d.underDepth
+}
+
+// emitValue decodes the value beginning at the current position only as
+// far as required: emitted values are reduced to their bytes in WriteTo's
+// raw mode, and to nothing with OffsetsOnly, while scalars neither emitted
+// nor stored in an enclosing container are skipped
+func (d *Decoder) emitValue(pKeys []string) (interface{}, ValueType, error) {
+	c := d.Cur()
+	scalar := c != '[' && c != '{'
+	switch {
+	case d.willEmit() && d.raw:
+		return d.rawValue()
+	case d.willEmit() && d.offsetsOnly:
+		if scalar || !d.emitRecursive {
+			t, err := d.skipValue()
+			return nil, t, err
+		}
+		_, t, err := d.any(pKeys) // values within it are emitted
+		return nil, t, err
+	case !d.willEmit() && scalar && !d.stores() && (d.depth > 0 || !d.jsonSeq):
+		// top-level numbers of a JSON text sequence are checked by endRecord
+		t, err := d.skipValue()
+		return nil, t, err
+	}
+	return d.any(pKeys)
+}
+
+// skipValue advances past the value beginning at the current position
+// without decoding it, returning its type
+func (d *Decoder) skipValue() (ValueType, error) {
+	t := rawType(d.Cur())
+	err := d.skip()
+	if d.stats != nil && err == nil {
+		d.stats.count(t, d.depth)
+	}
+	return t, err
+}
+
 // any used to decode any valid JSON value, and returns an
 // interface{} that holds the actual data
 func (d *Decoder) any(pKeys []string) (interface{}, ValueType, error) {
+	var (
+		i      interface{}
+		t      ValueType
+		hooked bool
+		err    error
+	)
+	if d.hooks != nil {
+		i, t, hooked, err = d.hookValue(pKeys)
+	}
+	if !hooked {
+		i, t, err = d.value(pKeys)
+	}
+	if d.stats != nil && err == nil {
+		d.stats.count(t, d.depth)
+	}
+	return i, t, err
+}
+
+// value decodes the JSON value beginning at the current position
+func (d *Decoder) value(pKeys []string) (interface{}, ValueType, error) {
 	c := d.Cur()
 
 	switch c {
 	case '"':
 		i, err := d.string()
 		return i, String, err
+	case '\'':
+		if !d.relaxed {
+			break
+		}
+		i, err := d.string()
+		return i, String, err
 	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		ii, err := d.number()
+		n, err := d.number(false)
 		if err != nil {
 			return nil, Unknown, err
 		}
-		switch v := ii.(type) {
-		case int64, float64:
-			return v, Number, nil
-		default:
-			return nil, Number, d.mkError(internal.ErrSyntax, "invalid number type")
-		}
+		return n, Number, nil
 	case '-':
-		if c = d.Next(); c < '0' && c > '9' {
+		if c = d.Next(); c == 'I' && d.nonFinite {
+			f, err := d.nonFiniteNumber()
+			return -f, Number, err
+		}
+		if c < '0' || c > '9' {
 			return nil, Unknown, d.mkError(internal.ErrSyntax, "in negative numeric literal")
 		}
-		ni, err := d.number()
+		n, err := d.number(true)
 		if err != nil {
 			return nil, Unknown, err
 		}
-		switch n := ni.(type) {
-		case int64:
-			return -n, Number, nil
-		case float64:
-			return -n, Number, nil
-		default:
-			return nil, Number, d.mkError(internal.ErrSyntax, "invalid number type")
-		}
+		return n, Number, nil
+	// literals truncated by the end of input fail on the virtual NUL
+	// following it, reported by mkError as ErrUnexpectedEOF
 	case 'f':
-		if d.Remaining() < 4 {
-			return nil, Unknown, d.mkError(internal.ErrUnexpectedEOF)
-		}
 		if d.Next() == 'a' && d.Next() == 'l' && d.Next() == 's' && d.Next() == 'e' {
 			return false, Boolean, nil
 		}
 		return nil, Unknown, d.mkError(internal.ErrSyntax, "in literal false")
 	case 't':
-		if d.Remaining() < 3 {
-			return nil, Unknown, d.mkError(internal.ErrUnexpectedEOF)
-		}
 		if d.Next() == 'r' && d.Next() == 'u' && d.Next() == 'e' {
 			return true, Boolean, nil
 		}
 		return nil, Unknown, d.mkError(internal.ErrSyntax, "in literal true")
 	case 'n':
-		if d.Remaining() < 3 {
-			return nil, Unknown, d.mkError(internal.ErrUnexpectedEOF)
-		}
 		if d.Next() == 'u' && d.Next() == 'l' && d.Next() == 'l' {
 			return nil, Null, nil
 		}
 		return nil, Unknown, d.mkError(internal.ErrSyntax, "in literal null")
+	case 'N', 'I':
+		if !d.nonFinite {
+			break
+		}
+		f, err := d.nonFiniteNumber()
+		return f, Number, err
 	case '[':
 		i, err := d.array(pKeys)
 		return i, Array, err
@@ -256,42 +1345,83 @@ func (d *Decoder) any(pKeys []string) (interface{}, ValueType, error) {
 			i, err = d.object(pKeys)
 		}
 		return i, Object, err
-	default:
-		return nil, Unknown, d.mkError(internal.ErrSyntax, "looking for beginning of value")
 	}
+	return nil, Unknown, d.mkError(internal.ErrSyntax, "looking for beginning of value")
 }
 
-// string called by `any` or `object`(for map keys) after reading `"`
-func (d *Decoder) string() (string, error) {
+// valueStart reports whether c may begin a value
+func (d *Decoder) valueStart(c byte) bool {
+	switch c {
+	case '"', '-', '[', '{', 't', 'f', 'n':
+		return true
+	case '\'':
+		return d.relaxed
+	case 'N', 'I':
+		return d.nonFinite
+	}
+	return c >= '0' && c <= '9'
+}
+
+// string called by `any` after reading `"`
+func (d *Decoder) string() (interface{}, error) {
+	if err := d.scanString(); err != nil {
+		return "", err
+	}
+	b := d.scratch.Bytes()
+	switch {
+	case d.unsafeStrings && !d.stores() && !d.holdsDocuments():
+		return b, nil // neither stored in a container nor held
+	case d.stringsAsBytes:
+		return append([]byte(nil), b...), nil
+	}
+	return string(b), nil
+}
+
+// scanString reads a string literal after `"` and writes its unescaped
+// contents to the scratch buffer
+func (d *Decoder) scanString() error {
+	if d.rawStrings {
+		return d.scanRawString()
+	}
 	d.scratch.Reset()
 
 	var (
-		c = d.Next()
+		quote  = d.Cur() // ' in relaxed mode
+		c      = d.Next()
+		escPos int64 // position of the current escape
+		err    error
 	)
 
 scan:
 	for {
 		switch {
-		case c == '"':
-			return string(d.scratch.Bytes()), nil
+		case c == quote:
+			return nil
 		case c == '\\':
+			escPos = d.Pos
 			c = d.Next()
 			goto scanEsc
 		case c < 0x20:
-			return "", d.mkError(internal.ErrSyntax, "in string literal")
-		// Coerce to well-formed UTF-8.
+			return d.mkError(internal.ErrSyntax, "in string literal")
+		// Coerce to well-formed UTF-8, if enabled.
+		case c >= utf8.RuneSelf && d.validateUTF8:
+			if c, err = d.scanUTF8(c); err != nil {
+				return err
+			}
 		default:
 			d.scratch.Add(c)
-			if d.Remaining() == 0 {
-				return "", d.mkError(internal.ErrSyntax, "in string literal")
-			}
 			c = d.Next()
 		}
 	}
 
 scanEsc:
 	switch c {
-	case '"', '\\', '/', '\'':
+	case '"', '\\', '/':
+		d.scratch.Add(c)
+	case '\'':
+		if d.strictEscapes && quote == '"' {
+			return d.mkError(internal.ErrSyntax, `in string escape code \'`)
+		}
 		d.scratch.Add(c)
 	case 'u':
 		goto scanU
@@ -306,37 +1436,168 @@ scanEsc:
 	case 't':
 		d.scratch.Add('\t')
 	default:
-		return "", d.mkError(internal.ErrSyntax, "in string escape code")
+		return d.mkError(internal.ErrSyntax, "in string escape code")
+	}
+	c = d.Next()
+	goto scan
+
+scanU:
+	r := d.u4()
+	if r < 0 {
+		return d.mkError(internal.ErrSyntax, "in unicode escape sequence")
+	}
+
+scanRune:
+	if !utf16.IsSurrogate(r) {
+		d.scratch.AddRune(r)
+		c = d.Next()
+		goto scan
+	}
+	if r >= 0xdc00 { // low surrogate without a preceding high surrogate
+		if err = d.loneSurrogate(escPos); err != nil {
+			return err
+		}
+		c = d.Next()
+		goto scan
+	}
+
+	// check for proceeding low surrogate
+	if c = d.Next(); c != '\\' {
+		if err = d.loneSurrogate(escPos); err != nil {
+			return err
+		}
+		goto scan
+	}
+	pairPos := d.Pos
+	if c = d.Next(); c != 'u' {
+		if err = d.loneSurrogate(escPos); err != nil {
+			return err
+		}
+		escPos = pairPos
+		goto scanEsc
+	}
+
+	r2 := d.u4()
+	if r2 < 0 {
+		return d.mkError(internal.ErrSyntax, "in unicode escape sequence")
+	}
+
+	// write surrogate pair
+	if dec := utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+		d.scratch.AddRune(dec)
+		c = d.Next()
+		goto scan
+	}
+
+	// the following escape is not a low surrogate, but may begin a pair
+	if err = d.loneSurrogate(escPos); err != nil {
+		return err
+	}
+	escPos, r = pairPos, r2
+	goto scanRune
+}
+
+// scanRawString reads a string literal after its opening quote, writing
+// its contents to the scratch buffer without unescaping them
+func (d *Decoder) scanRawString() error {
+	d.scratch.Reset()
+
+	quote := d.Cur()
+	for c := d.Next(); c != quote; c = d.Next() {
+		switch {
+		case c < 0x20:
+			return d.mkError(internal.ErrSyntax, "in string literal")
+		case c == '\\':
+			d.scratch.Add(c)
+			switch c = d.Next(); c {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case '\'':
+				if d.strictEscapes && quote == '"' {
+					return d.mkError(internal.ErrSyntax, `in string escape code \'`)
+				}
+			case 'u':
+				for i := 0; i < 4; i++ {
+					d.scratch.Add(c)
+					if c = d.Next(); !isHex(c) {
+						return d.mkError(internal.ErrSyntax, "in unicode escape sequence")
+					}
+				}
+			default:
+				return d.mkError(internal.ErrSyntax, "in string escape code")
+			}
+		}
+		d.scratch.Add(c)
 	}
-	c = d.Next()
-	goto scan
+	return nil
+}
 
-scanU:
-	r := d.u4()
-	if r < 0 {
-		return "", d.mkError(internal.ErrSyntax, "in unicode escape sequence")
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// loneSurrogate handles an unpaired surrogate escaped at escPos, either
+// writing the replacement character or, with StrictUnicode, returning an
+// error positioned at the escape
+func (d *Decoder) loneSurrogate(escPos int64) error {
+	if d.strictUnicode {
+		// an escaped pair spans at most 12 bytes, within the scanner's lookback
+		d.BackN(int(d.Pos - escPos))
+		return d.mkError(internal.ErrSyntax, "in unicode escape sequence (unpaired surrogate)")
 	}
+	d.scratch.AddRune(utf8.RuneError)
+	return nil
+}
 
-	// check for proceeding surrogate pair
-	c = d.Next()
-	if !utf16.IsSurrogate(r) || c != '\\' {
-		d.scratch.AddRune(r)
-		goto scan
+// scanUTF8 validates the multi-byte UTF-8 sequence beginning with c and
+// writes it to the scratch buffer, replacing each invalid byte with
+// U+FFFD as encoding/json does if enabled. It returns the next byte
+// following the sequence.
+func (d *Decoder) scanUTF8(c byte) (byte, error) {
+	var (
+		seq  = [utf8.UTFMax]byte{c}
+		n    = 1
+		need = 1
+	)
+	switch {
+	case c&0xE0 == 0xC0:
+		need = 2
+	case c&0xF0 == 0xE0:
+		need = 3
+	case c&0xF8 == 0xF0:
+		need = 4
 	}
-	if c = d.Next(); c != 'u' {
-		d.scratch.AddRune(r)
-		goto scanEsc
+	for n < need {
+		if c = d.Next(); c&0xC0 != 0x80 {
+			break
+		}
+		seq[n] = c
+		n++
 	}
 
-	r2 := d.u4()
-	if r2 < 0 {
-		return "", d.mkError(internal.ErrSyntax, "in unicode escape sequence")
+	if n == need && utf8.Valid(seq[:n]) {
+		for _, b := range seq[:n] {
+			d.scratch.Add(b)
+		}
+		return d.Next(), nil
+	}
+	if !d.replaceUTF8 {
+		// position the error at the first byte of the sequence
+		if n < need {
+			d.BackN(n)
+		} else {
+			d.BackN(n - 1)
+		}
+		return 0, d.mkError(internal.ErrSyntax, "invalid UTF-8 in string literal")
+	}
+	for i := 0; i < n; i++ {
+		d.scratch.AddRune(utf8.RuneError)
 	}
 
-	// write surrogate pair
-	d.scratch.AddRune(utf16.DecodeRune(r, r2))
-	c = d.Next()
-	goto scan
+	// a truncated sequence ends at a byte which has already been read
+	if n < need {
+		return c, nil
+	}
+	return d.Next(), nil
 }
 
 // u4 reads four bytes following a \u escape
@@ -361,8 +1622,41 @@ func (d *Decoder) u4() rune {
 }
 
 // number called by `any` after reading number between 0 to 9
-func (d *Decoder) number() (interface{}, error) {
+func (d *Decoder) number(neg bool) (interface{}, error) {
+	isFloat, err := d.scanNumber(neg)
+	if err != nil {
+		return 0, err
+	}
+
+	if d.numberFn != nil {
+		return d.numberFn(d.scratch.Bytes(), isFloat)
+	}
+	// parsed from the scratch bytes, as the conversions do not escape
+	b := d.scratch.Bytes()
+	if isFloat {
+		return strconv.ParseFloat(string(b), 64)
+	}
+	base := 10
+	if hex := bytes.TrimPrefix(b, []byte("-")); len(hex) > 1 && hex[1] == 'x' {
+		base = 0 // the 0x prefix selects base 16, after the sign
+	}
+	n, err := strconv.ParseInt(string(b), base, 64)
+	if err != nil && d.bigInt && errors.Is(err, strconv.ErrRange) {
+		// the literal is known to be well-formed, sign included
+		i, _ := new(big.Int).SetString(string(b), base)
+		return i, nil
+	}
+	return n, err
+}
+
+// scanNumber reads a numeric literal starting at the current position
+// into the scratch buffer, preceded by a minus sign if neg, reporting
+// whether it is a float
+func (d *Decoder) scanNumber(neg bool) (bool, error) {
 	d.scratch.Reset()
+	if neg {
+		d.scratch.Add('-')
+	}
 
 	var (
 		c       = d.Cur()
@@ -373,10 +1667,14 @@ func (d *Decoder) number() (interface{}, error) {
 	switch {
 	case c == '0':
 		d.scratch.Add(c)
-		c = d.Next()
+		if c = d.Next(); (c == 'x' || c == 'X') && d.relaxed {
+			return false, d.scanHex()
+		}
 	case '1' <= c && c <= '9':
 		for ; c >= '0' && c <= '9'; c = d.Next() {
-			d.scratch.Add(c)
+			if err := d.addDigit(c); err != nil {
+				return false, err
+			}
 		}
 	}
 
@@ -386,19 +1684,16 @@ func (d *Decoder) number() (interface{}, error) {
 		d.scratch.Add(c)
 
 		// first char following must be digit
-		if c = d.Next(); c < '0' && c > '9' {
-			return 0, d.mkError(internal.ErrSyntax, "after decimal point in numeric literal")
-		}
-		d.scratch.Add(c)
-
-		for {
-			if d.Remaining() == 0 {
-				return 0, d.mkError(internal.ErrUnexpectedEOF)
+		if c = d.Next(); c < '0' || c > '9' {
+			if c == 0 && d.EOF() {
+				return false, d.mkError(internal.ErrUnexpectedEOF)
 			}
-			if c = d.Next(); c < '0' || c > '9' {
-				break
+			return false, d.mkError(internal.ErrSyntax, "after decimal point in numeric literal")
+		}
+		for ; c >= '0' && c <= '9'; c = d.Next() {
+			if err := d.addDigit(c); err != nil {
+				return false, err
 			}
-			d.scratch.Add(c)
 		}
 	}
 
@@ -410,63 +1705,99 @@ func (d *Decoder) number() (interface{}, error) {
 
 		if c = d.Next(); c == '+' || c == '-' {
 			d.scratch.Add(c)
-			if c = d.Next(); c < '0' || c > '9' {
-				return 0, d.mkError(internal.ErrSyntax, "in exponent of numeric literal")
-			}
-			d.scratch.Add(c)
+			c = d.Next()
+		}
+		if c < '0' || c > '9' {
+			return false, d.mkError(internal.ErrSyntax, "in exponent of numeric literal")
 		}
 		for ; c >= '0' && c <= '9'; c = d.Next() {
-			d.scratch.Add(c)
+			if err := d.addDigit(c); err != nil {
+				return false, err
+			}
 		}
 	}
 
 	d.Back()
 
-	if isFloat {
-		var (
-			err error
-			n   float64
-		)
-		sn := string(d.scratch.Bytes())
-		if n, err = strconv.ParseFloat(sn, 64); err != nil {
-			return 0, err
-		}
-		return n, err
+	return isFloat, nil
+}
+
+// addDigit appends a digit of a numeric literal to the scratch buffer,
+// failing once the literal exceeds MaxNumberLen
+func (d *Decoder) addDigit(c byte) error {
+	d.scratch.Add(c)
+	if d.maxNumLen > 0 && len(d.scratch.Bytes()) > d.maxNumLen {
+		return d.mkError(internal.ErrNumberTooLong, strconv.Itoa(d.maxNumLen)+" bytes")
 	}
+	return nil
+}
 
-	sn := string(d.scratch.Bytes())
-	return strconv.ParseInt(sn, 10, 64)
+// nonFiniteNumber reads the literal NaN or Infinity beginning at the
+// current position
+func (d *Decoder) nonFiniteNumber() (float64, error) {
+	lit, f := "Infinity", math.Inf(1)
+	if d.Cur() == 'N' {
+		lit, f = "NaN", math.NaN()
+	}
+	for i := 1; i < len(lit); i++ {
+		if d.Next() != lit[i] {
+			return 0, d.mkError(internal.ErrSyntax, "in literal "+lit)
+		}
+	}
+	return f, nil
 }
 
 // array accept valid JSON array value
 func (d *Decoder) array(pKeys []string) ([]interface{}, error) {
 	d.depth++
-	parentKeys := append(pKeys, "")
+	d.parents = append(d.parents, d.offset())
 	var (
-		c     byte
-		v     interface{}
-		err   error
-		array = make([]interface{}, 0)
+		c        byte
+		v        interface{}
+		i        int
+		err      error
+		array    = make([]interface{}, 0)
+		keys     = pKeys // of the elements, once they are used
+		usesKeys = d.usesKeys()
 	)
+	if usesKeys {
+		keys = append(pKeys[:len(pKeys):len(pKeys)], "")
+	}
 
 	// look ahead for ] - if the array is empty.
 	if c = d.skipSpaces(); c == ']' {
 		goto out
 	}
+	d.setPath(keys)
 
 scan:
-	if v, err = d.emitAny(parentKeys); err != nil {
+	if usesKeys && d.indexedKeys {
+		keys = append(pKeys[:len(pKeys):len(pKeys)], strconv.Itoa(i))
+		d.setPath(keys)
+	}
+	if usesKeys && !d.onPath(keys[len(keys)-1]) {
+		if err = d.skip(); err != nil {
+			goto out
+		}
+	} else if v, err = d.emitAny(keys, i); err != nil {
 		goto out
 	}
+	i++
 
-	if d.depth > d.emitDepth { // skip alloc for array if it won't be emitted
+	if d.stores() { // skip alloc for array if it won't be emitted
 		array = append(array, v)
 	}
+	if d.aborted() {
+		err = d.abortErr
+		goto out
+	}
 
 	// next token must be ',' or ']'
 	switch c = d.skipSpaces(); c {
 	case ',':
-		d.skipSpaces()
+		if c = d.skipSpaces(); c == ']' && d.trailingComma {
+			goto out
+		}
 		goto scan
 	case ']':
 		goto out
@@ -476,207 +1807,496 @@ scan:
 
 out:
 	d.depth--
+	d.parents = d.parents[:len(d.parents)-1]
+	if err == nil {
+		d.setPath(pKeys)
+	}
 	return array, err
 }
 
-// object accept valid JSON array value
+// object accept valid JSON object value
 func (d *Decoder) object(pKeys []string) (map[string]interface{}, error) {
 	d.depth++
+	d.parents = append(d.parents, d.offset())
 
 	var (
-		c   byte
-		k   string
-		v   interface{}
-		t   ValueType
-		err error
 		obj map[string]interface{}
+		err error
 	)
-
 	// skip allocating map if it will not be emitted
-	if d.depth > d.emitDepth {
-		obj = make(map[string]interface{})
+	if d.stores() {
+		obj = make(map[string]interface{}, d.objectSize())
+		err = d.members(pKeys, func(k string, v interface{}) { obj[k] = v })
+		if err == nil {
+			d.setObjectSize(len(obj))
+		}
+	} else {
+		err = d.members(pKeys, nil)
+	}
+
+	d.depth--
+	d.parents = d.parents[:len(d.parents)-1]
+	return obj, err
+}
+
+// object (ordered) accept valid JSON object value
+func (d *Decoder) objectOrdered(pKeys []string) (KVS, error) {
+	d.depth++
+	d.parents = append(d.parents, d.offset())
+
+	var (
+		obj KVS
+		err error
+	)
+	// skip allocating KVS if it will not be emitted
+	if d.stores() {
+		obj = make(KVS, 0, d.objectSize())
+		err = d.members(pKeys, func(k string, v interface{}) { obj = append(obj, KV{Key: k, Value: v}) })
+		if err == nil {
+			d.setObjectSize(len(obj))
+		}
+	} else {
+		err = d.members(pKeys, nil)
 	}
 
+	d.depth--
+	d.parents = d.parents[:len(d.parents)-1]
+	return obj, err
+}
+
+// members reads the members of the object whose opening brace is at the
+// current position, emitting them as configured, and calls store, unless
+// nil, with the key and value of each member accepted by the key filter
+func (d *Decoder) members(pKeys []string, store func(k string, v interface{})) error {
+	var (
+		c     byte
+		k     string
+		v     interface{}
+		t     ValueType
+		err   error
+		under = -1 // emit depth to restore, with EmitUnder
+
+		usesKeys = d.usesKeys()
+	)
+
 	// if the object has no keys
 	if c = d.skipSpaces(); c == '}' {
-		goto out
+		return nil
 	}
 
 scan:
 	for {
-		offset := d.Pos - 1
+		offset, line := d.offset(), d.lineNo+1
 
 		// read string key
-		if c != '"' {
-			err = d.mkError(internal.ErrSyntax, "looking for beginning of object key string")
-			break
-		}
-		if k, err = d.string(); err != nil {
+		if err = d.scanKey(); err != nil {
 			break
 		}
+		keyLength := d.end() - offset
 
 		// read colon before value
 		if c = d.skipSpaces(); c != ':' {
 			err = d.mkError(internal.ErrSyntax, "after object key")
 			break
 		}
-
-		// read value
 		d.skipSpaces()
-		keys := append(pKeys, k)
-		if d.emitKV {
-			if v, t, err = d.any(keys); err != nil {
+
+		// skip values of keys rejected by the key filter without decoding them
+		if !d.acceptKey() {
+			k = ""
+			if err = d.skip(); err != nil {
 				break
 			}
-			if d.willEmit() {
-				d.metaCh <- &MetaValue{
-					Offset:    int(offset),
-					Length:    int(d.Pos - offset),
-					Depth:     d.depth,
-					Keys:      keys,
-					Value:     KV{k, v},
-					ValueType: t,
+		} else {
+			// read value
+			k = d.key()
+			keys := pKeys
+			if usesKeys {
+				keys = append(pKeys[:len(pKeys):len(pKeys)], k)
+			}
+			d.setPath(keys)
+			if d.under {
+				under = d.enterUnder(k)
+			}
+			if d.emitKV && d.skipIf(keys) || d.skipping(keys) {
+				if err = d.skip(); err != nil {
+					break
+				}
+			} else if d.emitKV {
+				valueOffset := d.offset()
+				capture := d.emitBoth && d.willEmit()
+				if capture {
+					d.StartCapture()
+				}
+				v, t, err = d.emitValue(keys)
+				var raw []byte
+				if capture {
+					raw = append([]byte(nil), d.Captured()...)
+				}
+				if err != nil {
+					break
+				}
+				if d.willEmit() {
+					err = d.emit(d.newMetaValue(MetaValue{
+						Offset:       offset,
+						Length:       d.end() - offset,
+						Line:         line,
+						Depth:        d.depth,
+						Keys:         keys,
+						Index:        -1,
+						ParentOffset: d.parent(),
+						Value:        KV{Key: k, Value: v, ValueType: t, Length: d.end() - valueOffset},
+						ValueType:    t,
+						Raw:          raw,
+					}))
+					if err != nil {
+						break
+					}
+				}
+			} else {
+				if d.emitKeys && d.willEmit() && !d.skipIf(keys) {
+					if err = d.emitKey(k, keys, offset, keyLength, line); err != nil {
+						break
+					}
+				}
+				if v, err = d.emitAny(keys, -1); err != nil {
+					break
 				}
 			}
-		} else {
-			if v, err = d.emitAny(keys); err != nil {
-				break
+
+			if under >= 0 {
+				d.exitUnder(under)
+				under = -1
+			}
+			if store != nil {
+				store(k, v)
 			}
+			d.setPath(pKeys)
 		}
-
-		if obj != nil {
-			obj[k] = v
+		if d.aborted() {
+			err = d.abortErr
+			break
 		}
 
 		// next token must be ',' or '}'
 		switch c = d.skipSpaces(); c {
 		case '}':
-			goto out
+			break scan
 		case ',':
-			c = d.skipSpaces()
-			goto scan
+			if c = d.skipSpaces(); c == '}' && d.trailingComma {
+				break scan
+			}
 		default:
-			err = d.mkError(internal.ErrSyntax, "after object key:value pair")
-			goto out
+			err = d.mkError(internal.ErrSyntax, pairContext(k))
+			break scan
 		}
 	}
 
-out:
-	d.depth--
-	return obj, err
+	if under >= 0 {
+		d.exitUnder(under)
+	}
+	return err
 }
 
-// object (ordered) accept valid JSON array value
-func (d *Decoder) objectOrdered(pKeys []string) (KVS, error) {
-	d.depth++
-
-	var (
-		c   byte
-		k   string
-		v   interface{}
-		t   ValueType
-		err error
-		obj KVS
-	)
+// objectSize returns the number of members to allocate for an object at
+// the current depth: that of the last object stored at the same depth, as
+// the objects at a depth are often alike
+func (d *Decoder) objectSize() int {
+	if d.depth < len(d.sizes) {
+		return d.sizes[d.depth]
+	}
+	return 0
+}
 
-	// skip allocating map if it will not be emitted
-	if d.depth > d.emitDepth {
-		obj = make(KVS, 0)
+// setObjectSize records the number of members of an object stored at the
+// current depth, for objectSize
+func (d *Decoder) setObjectSize(n int) {
+	for len(d.sizes) <= d.depth {
+		d.sizes = append(d.sizes, 0)
+	}
+	if n > maxSizeHint {
+		n = maxSizeHint
 	}
+	d.sizes[d.depth] = n
+}
 
-	// if the object has no keys
-	if c = d.skipSpaces(); c == '}' {
-		goto out
+// pairContext returns the context of a syntax error following the object
+// member with key k, or an unknown key if k is ""
+func pairContext(k string) string {
+	if k == "" {
+		return "after object key:value pair"
 	}
+	return "after object key:value pair for key " + strconv.Quote(k)
+}
 
-scan:
-	for {
-		offset := d.Pos - 1
+// acceptKey reports whether the object key held in the scratch buffer
+// passes the configured key filters. Key filters apply at emit depth
+// only, and the path filter at each depth along the path.
+func (d *Decoder) acceptKey() bool {
+	if d.filterPath != nil && d.depth <= len(d.filterPath) && d.filterPath[d.depth-1] != string(d.scratch.Bytes()) {
+		return false
+	}
+	if d.depth != d.emitDepth || (d.filterKeys == nil && d.filterRe == nil) {
+		return true
+	}
+	if _, ok := d.filterKeys[string(d.scratch.Bytes())]; ok {
+		return true
+	}
+	return d.filterRe != nil && d.filterRe.Match(d.scratch.Bytes())
+}
 
-		// read string key
-		if c != '"' {
-			err = d.mkError(internal.ErrSyntax, "looking for beginning of object key string")
-			break
+// skip advances past the JSON value beginning at the current position,
+// validating its structure without building a value for it
+func (d *Decoder) skip() error {
+	switch c := d.Cur(); c {
+	case '"':
+		return d.scanString()
+	case '\'':
+		if d.relaxed {
+			return d.scanString()
 		}
-		if k, err = d.string(); err != nil {
-			break
+		return d.mkError(internal.ErrSyntax, "looking for beginning of value")
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		_, err := d.scanNumber(false)
+		return err
+	case '-':
+		if c = d.Next(); c == 'I' && d.nonFinite {
+			_, err := d.nonFiniteNumber()
+			return err
 		}
-
-		// read colon before value
-		if c = d.skipSpaces(); c != ':' {
-			err = d.mkError(internal.ErrSyntax, "after object key")
-			break
+		if c < '0' || c > '9' {
+			return d.mkError(internal.ErrSyntax, "in negative numeric literal")
 		}
-
-		// read value
-		d.skipSpaces()
-		keys := append(pKeys, k)
-		if d.emitKV {
-			if v, t, err = d.any(keys); err != nil {
-				break
+		_, err := d.scanNumber(true)
+		return err
+	case '[':
+		if c = d.skipSpaces(); c == ']' {
+			return nil
+		}
+		for {
+			if err := d.skip(); err != nil {
+				return err
 			}
-			if d.willEmit() {
-				d.metaCh <- &MetaValue{
-					Offset:    int(offset),
-					Length:    int(d.Pos - offset),
-					Depth:     d.depth,
-					Keys:      keys,
-					Value:     KV{k, v},
-					ValueType: t,
+			switch c = d.skipSpaces(); c {
+			case ',':
+				if c = d.skipSpaces(); c == ']' && d.trailingComma {
+					return nil
 				}
-			}
-		} else {
-			if v, err = d.emitAny(keys); err != nil {
-				break
+			case ']':
+				return nil
+			default:
+				return d.mkError(internal.ErrSyntax, "after array element")
 			}
 		}
-
-		if obj != nil {
-			obj = append(obj, KV{k, v})
+	case '{':
+		if c = d.skipSpaces(); c == '}' {
+			return nil
+		}
+		if err := d.scanKey(); err != nil {
+			return err
 		}
+		return d.skipMembers()
+	default:
+		// literals true, false and null are not allocated
+		_, _, err := d.value(nil)
+		return err
+	}
+}
 
-		// next token must be ',' or '}'
-		switch c = d.skipSpaces(); c {
-		case '}':
-			goto out
+// skipMembers advances past the members of an object without decoding
+// them, from the last byte of the first member's key through the closing
+// brace
+func (d *Decoder) skipMembers() error {
+	for {
+		if c := d.skipSpaces(); c != ':' {
+			return d.mkError(internal.ErrSyntax, "after object key")
+		}
+		d.skipSpaces()
+		if err := d.skip(); err != nil {
+			return err
+		}
+		switch c := d.skipSpaces(); c {
 		case ',':
-			c = d.skipSpaces()
-			goto scan
+			if c = d.skipSpaces(); c == '}' && d.trailingComma {
+				return nil
+			}
+		case '}':
+			return nil
 		default:
-			err = d.mkError(internal.ErrSyntax, "after object key:value pair")
-			goto out
+			return d.mkError(internal.ErrSyntax, "after object key:value pair")
+		}
+		if err := d.scanKey(); err != nil {
+			return err
 		}
 	}
-
-out:
-	d.depth--
-	return obj, err
 }
 
-// returns the next char after white spaces
+// returns the next char after white spaces, counting lines ended by
+// \n, \r\n or a lone \r
 func (d *Decoder) skipSpaces() byte {
-	for d.Pos < atomic.LoadInt64(&d.End) {
+	for {
 		switch c := d.Next(); c {
 		case '\n':
+			if d.ndjson && d.depth > 0 {
+				return c // documents may not span lines
+			}
 			d.lineStart = d.Pos
 			d.lineNo++
 			continue
-		case ' ', '\t', '\r':
+		case '\r':
+			if d.Peek() != '\n' { // a lone carriage return breaks the line
+				d.lineStart = d.Pos
+				d.lineNo++
+			}
+			continue
+		case ' ', '\t':
 			continue
+		case '/':
+			if d.comments && d.skipComment() {
+				continue
+			}
+			return c
+		case 0xC2, 0xEF:
+			if d.lenient && !d.strict && d.lenientSpace(c) {
+				continue
+			}
+			return c
+		default:
+			return c
+		}
+	}
+}
+
+// skipDocSpaces skips whitespace preceding a top-level value, along with
+// any UTF-8 byte order marks, and record separators with JSONSeq
+func (d *Decoder) skipDocSpaces() byte {
+	for {
+		c := d.skipSpaces()
+		if c == recordSeparator && d.jsonSeq {
+			continue
+		}
+		if c != 0xEF || !d.lenientSpace(c) {
+			return c
+		}
+	}
+}
+
+// lenientSpace reports whether the byte c just read begins a no-break
+// space or byte order mark, advancing to its last byte if so
+func (d *Decoder) lenientSpace(c byte) bool {
+	switch c {
+	case 0xC2:
+		if d.Peek() == 0xA0 {
+			d.Next()
+			return true
+		}
+	case 0xEF:
+		if d.Peek() != 0xBB {
+			return false
+		}
+		d.Next()
+		if d.Peek() == 0xBF {
+			d.Next()
+			return true
+		}
+		d.Back()
+	}
+	return false
+}
+
+// unicodeSpace reports whether r is whitespace other than that of JSON
+func unicodeSpace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\r', '\n':
+		return false
+	case '\uFEFF':
+		return true
+	}
+	return unicode.IsSpace(r)
+}
+
+// curRune decodes the character beginning at the current position,
+// without advancing past it
+func (d *Decoder) curRune() rune {
+	b := []byte{d.Cur()}
+	for len(b) < utf8.UTFMax && !utf8.FullRune(b) {
+		c := d.Next()
+		if d.EOF() {
+			d.Back()
+			break
+		}
+		b = append(b, c)
+	}
+	d.BackN(len(b) - 1)
+	r, _ := utf8.DecodeRune(b)
+	return r
+}
+
+// peekNonSpace skips whitespace and returns the following byte without
+// consuming it, such that the next call to Next returns it
+func (d *Decoder) peekNonSpace() byte {
+	for {
+		switch c := d.Peek(); c {
+		case '\n':
+			if d.ndjson && d.depth > 0 {
+				return c
+			}
+			d.Next()
+			d.lineStart = d.Pos
+			d.lineNo++
+		case '\r':
+			if d.Next(); d.Peek() != '\n' {
+				d.lineStart = d.Pos
+				d.lineNo++
+			}
+		case ' ', '\t':
+			d.Next()
+		case '/':
+			if !d.comments {
+				return c
+			}
+			if d.Next(); !d.skipComment() {
+				d.Back()
+				return c
+			}
+		case 0xC2, 0xEF:
+			if !d.lenient || d.strict {
+				return c
+			}
+			if d.Next(); !d.lenientSpace(c) {
+				d.Back()
+				return c
+			}
 		default:
 			return c
 		}
 	}
-	return 0
 }
 
 // create syntax errors at current position, with optional context
 func (d *Decoder) mkError(err internal.SyntaxError, context ...string) error {
+	if d.spaceErr != nil {
+		// the input ended within a comment
+		return d.spaceErr
+	}
+	if d.EOF() && err.Is(internal.ErrSyntax) {
+		// the input ended within a value
+		err = internal.ErrUnexpectedEOF
+	}
 	if len(context) > 0 {
 		err.Context = context[0]
 	}
 	err.AtChar = d.Cur()
-	err.Pos[0] = d.lineNo + 1
-	err.Pos[1] = int(d.Pos - d.lineStart)
+	err.Line = d.lineNo + 1
+	err.Column = int(d.Pos - d.lineStart)
+	err.Offset = d.offset()
+	snippet, at := d.Window(snippetSize, snippetSize)
+	err.Snippet = append([]byte(nil), snippet...)
+	err.SnippetPos = at
+	if d.strict && err.Is(internal.ErrSyntax) {
+		if r := d.curRune(); unicodeSpace(r) {
+			err.Context = fmt.Sprintf("%U not allowed as whitespace", r)
+		}
+	}
 	return err
 }
@@ -0,0 +1,165 @@
+package jstream
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// DuplicateError is reported to the OnWarning callback for each document
+// dropped by DedupWindow
+type DuplicateError struct {
+	Offset int64 // byte offset of the dropped document
+	Length int64
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("jstream: dropped duplicate document at offset %d", e.Offset)
+}
+
+// dedupWindow remembers the hashes of the most recent top-level documents
+type dedupWindow struct {
+	h     hash.Hash64
+	exact bool
+	sums  []uint64 // ring of document hashes
+	raws  [][]byte // ring of document bytes, if exact
+	next  int      // ring index of the next document
+	count map[uint64]int
+}
+
+func newDedupWindow(n int, h hash.Hash64) *dedupWindow {
+	return &dedupWindow{
+		h:     h,
+		sums:  make([]uint64, 0, n),
+		count: make(map[uint64]int, n),
+	}
+}
+
+// seen reports whether raw repeats a document within the window, adding
+// it to the window otherwise
+func (w *dedupWindow) seen(raw []byte) bool {
+	w.h.Reset()
+	w.h.Write(raw)
+	sum := w.h.Sum64()
+
+	if w.count[sum] > 0 {
+		if !w.exact {
+			return true
+		}
+		for i, s := range w.sums {
+			if s == sum && bytes.Equal(w.raws[i], raw) {
+				return true
+			}
+		}
+	}
+
+	if len(w.sums) < cap(w.sums) {
+		w.sums = append(w.sums, sum)
+		if w.exact {
+			w.raws = append(w.raws, append([]byte(nil), raw...))
+		}
+	} else {
+		old := w.sums[w.next]
+		if w.count[old]--; w.count[old] == 0 {
+			delete(w.count, old)
+		}
+		w.sums[w.next] = sum
+		if w.exact {
+			w.raws[w.next] = append(w.raws[w.next][:0], raw...)
+		}
+		w.next = (w.next + 1) % len(w.sums)
+	}
+	w.count[sum]++
+	return false
+}
+
+// DedupWindow drops top-level documents that are byte-for-byte repeats of
+// one of the previous n documents, after trimming surrounding whitespace.
+// Documents are compared by their hash as returned by h, or FNV-1a if h
+// is nil, such that a hash collision may drop a distinct document; use
+// DedupExact to confirm matches against the document bytes.
+//
+// Values of a document are held back until the whole document has been
+// read. Dropped documents are counted in Stats and reported to the
+// OnWarning callback as a *DuplicateError. DedupWindow applies to Stream
+// and Walk.
+func (d *Decoder) DedupWindow(n int, h func() hash.Hash64) *Decoder {
+	if n < 1 {
+		panic("jstream: DedupWindow size must be positive")
+	}
+	if h == nil {
+		h = fnv.New64a
+	}
+	d.dedup = newDedupWindow(n, h())
+	d.dedup.exact = d.dedupExact
+	return d
+}
+
+// DedupExact makes DedupWindow compare the bytes of documents with equal
+// hashes, retaining a copy of each document in the window
+func (d *Decoder) DedupExact() *Decoder {
+	d.dedupExact = true
+	if d.dedup != nil {
+		d.dedup.exact = true
+	}
+	return d
+}
+
+// OnWarning sets a function called, on the decoding goroutine, with
+// non-fatal conditions encountered while decoding
+func (d *Decoder) OnWarning(fn func(error)) *Decoder {
+	d.onWarning = fn
+	return d
+}
+
+// emitDocument decodes the next top-level document, holding its values
+// until it is complete: the document is dropped if it repeats a document
+// within the dedup window, in NDJSON mode if its line is malformed, and
+// in JSONSeq mode if its record is invalid and skipped
+func (d *Decoder) emitDocument() error {
+	offset, line := d.offset(), d.lineNo+1
+	if d.dedup != nil {
+		d.StartCapture()
+	}
+	d.held = d.held[:0]
+
+	v, err := d.emitAny([]string{}, -1)
+	var raw []byte
+	if d.dedup != nil {
+		raw = d.Captured()
+	}
+	end := d.end()
+	switch {
+	case err != nil:
+	case d.ndjson:
+		err = d.endLine()
+	case d.jsonSeq:
+		err = d.endRecord(v)
+	}
+	if err != nil {
+		switch {
+		case d.ndjson:
+			return d.lineError(offset, line, err)
+		case d.jsonSeq && d.skipInvalid:
+			d.skipRecord(offset, err)
+			return nil
+		}
+		return err
+	}
+
+	if d.dedup != nil && d.dedup.seen(raw) {
+		atomic.AddInt64(&d.duplicates, 1)
+		if d.onWarning != nil {
+			d.onWarning(&DuplicateError{Offset: offset, Length: end - offset})
+		}
+		return nil
+	}
+	for _, mv := range d.held {
+		if err := d.send(mv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package jstream
+
+import "encoding/json"
+
+// DecodeEach decodes each value emitted by d into a T, as by
+// json.Unmarshal, and calls fn with it. Values are unmarshaled from their
+// original bytes, rather than through an intermediate interface{} value,
+// except with Recursive or DedupWindow: values are then passed through if
+// already of type T, or else unmarshaled as written by Encoder. With
+// EmitKV, the value of each member is unmarshaled. Decoding stops at the
+// first error, from either unmarshaling or fn, which is returned.
+func DecodeEach[T any](d *Decoder, fn func(T) error) error {
+	return decodeEach(d, func(_ *MetaValue, v T, err error) error {
+		if err != nil {
+			return err
+		}
+		return fn(v)
+	})
+}
+
+// decodeEach walks d, calling fn with each value emitted decoded into a
+// T as described for DecodeEach, or with the error unmarshaling it
+func decodeEach[T any](d *Decoder, fn func(mv *MetaValue, v T, err error) error) error {
+	d.raw = !d.emitRecursive && d.dedup == nil
+	return d.Walk(func(mv *MetaValue) error {
+		v := mv.Value
+		if kv, ok := v.(KV); ok {
+			v = kv.Value
+		}
+		raw, ok := v.(json.RawMessage)
+		if !ok {
+			if t, ok := v.(T); ok {
+				return fn(mv, t, nil)
+			}
+			var err error
+			if raw, err = marshal(v); err != nil {
+				var t T
+				return fn(mv, t, err)
+			}
+		}
+		var t T
+		err := json.Unmarshal(raw, &t)
+		return fn(mv, t, err)
+	})
+}
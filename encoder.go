@@ -0,0 +1,380 @@
+package jstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+const encodeFlush = 4096 // buffered output written before a value is complete
+
+var (
+	// ErrEncoderClosed is returned by Encode once an Encoder has been closed
+	ErrEncoderClosed = errors.New("jstream: encoder closed")
+
+	errArrayOpen   = errors.New("jstream: EncodeArrayStart called within an array")
+	errArrayClosed = errors.New("jstream: EncodeArrayEnd called outside an array")
+)
+
+// Encoder writes values, such as those emitted by a Decoder, as JSON to
+// an io.Writer. By default each value is written on its own line, as
+// newline-delimited JSON; values encoded between EncodeArrayStart and
+// EncodeArrayEnd are instead written as the elements of an array.
+//
+// Values are written as they are encoded, through a small reusable
+// buffer, such that large values need never be held in memory in full.
+type Encoder struct {
+	w       io.Writer
+	s       encodeState
+	array   bool // begin an array with the first value
+	started bool // an array has been started
+	open    bool // an array is open
+	n       int  // number of values written to the open array
+	err     error
+	closed  bool
+}
+
+// NewEncoder creates a new Encoder writing to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, s: encodeState{w: w, floats: true}}
+}
+
+// Array writes the values as the elements of a single JSON array, which
+// is completed by Close; it is equivalent to calling EncodeArrayStart
+// before the first value, and EncodeArrayEnd at Close
+func (e *Encoder) Array() *Encoder {
+	e.array = true
+	return e
+}
+
+// EncodeArrayStart begins a JSON array, the elements of which are the
+// values encoded until EncodeArrayEnd. Arrays may not be nested.
+func (e *Encoder) EncodeArrayStart() error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	if e.open {
+		return errArrayOpen
+	}
+	e.started, e.open, e.n = true, true, 0
+	return e.write("[")
+}
+
+// EncodeArrayEnd completes the array begun by EncodeArrayStart
+func (e *Encoder) EncodeArrayEnd() error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	if !e.open {
+		return errArrayClosed
+	}
+	e.open = false
+	return e.write("]\n")
+}
+
+// Encode writes the JSON encoding of v, preserving the order of the
+// members of KVS objects at any depth. A *MetaValue or MetaValue is
+// written as its Value, and a KV, as emitted with EmitKV, as an object
+// with "key" and "value" members. A []byte, as decoded with
+// StringsAsBytes, is written as a string. Whole float64 values keep a
+// fraction, as in 3.0, so as to decode again as float64 rather than int64.
+// Values of types not produced by a Decoder are encoded as by json.Marshal,
+// though without escaping HTML.
+//
+// Should encoding fail once part of a value has been written, the output
+// is left incomplete and the error is returned by all further calls.
+func (e *Encoder) Encode(v interface{}) error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	if e.array && !e.started {
+		if err := e.EncodeArrayStart(); err != nil {
+			return err
+		}
+	}
+	switch mv := v.(type) {
+	case *MetaValue:
+		v = mv.Value
+	case MetaValue:
+		v = mv.Value
+	}
+
+	s := &e.s
+	s.reset()
+	if e.open && e.n > 0 {
+		s.buf = append(s.buf, ',')
+	}
+	if err := s.value(v); err != nil {
+		if s.written {
+			e.err = err
+		}
+		return err
+	}
+	if !e.open {
+		s.buf = append(s.buf, '\n')
+	}
+	if err := s.flush(); err != nil {
+		e.err = err
+		return err
+	}
+	if e.open {
+		e.n++
+	}
+	return nil
+}
+
+// Close completes any array left open, or for an Array Encoder writes an
+// empty array if no values were encoded, after which Encode may not be
+// called. It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.closed || e.err != nil {
+		return e.err
+	}
+	if e.array && !e.started {
+		if err := e.EncodeArrayStart(); err != nil {
+			return err
+		}
+	}
+	if e.open {
+		if err := e.EncodeArrayEnd(); err != nil {
+			return err
+		}
+	}
+	e.closed = true
+	return nil
+}
+
+// check returns the error, if any, preventing further output
+func (e *Encoder) check() error {
+	if e.closed {
+		return ErrEncoderClosed
+	}
+	return e.err
+}
+
+func (e *Encoder) write(s string) error {
+	_, e.err = io.WriteString(e.w, s)
+	return e.err
+}
+
+// marshal returns the encoding of v as written by Encoder, but for whole
+// floats written without a fraction, as by json.Marshal
+func marshal(v interface{}) ([]byte, error) {
+	var s encodeState
+	err := s.value(v)
+	return s.buf, err
+}
+
+// encodeState appends the JSON encoding of values to buf, writing it out
+// to w, if set, whenever it grows beyond encodeFlush bytes
+type encodeState struct {
+	w       io.Writer
+	buf     []byte
+	written bool // part of the current value has been written to w
+	floats  bool // floats keep a fraction or exponent, to decode as float64
+
+	// encoding values of other types
+	ext    bytes.Buffer
+	extEnc *json.Encoder
+}
+
+func (s *encodeState) reset() {
+	s.buf = s.buf[:0]
+	s.written = false
+}
+
+// flush writes out the buffered output
+func (s *encodeState) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	s.written = true
+	_, err := s.w.Write(s.buf)
+	s.buf = s.buf[:0]
+	return err
+}
+
+func (s *encodeState) value(v interface{}) error {
+	if s.w != nil && len(s.buf) >= encodeFlush {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		s.buf = append(s.buf, "null"...)
+	case bool:
+		s.buf = strconv.AppendBool(s.buf, v)
+	case string:
+		s.buf = appendString(s.buf, v)
+	case []byte: // decoded with StringsAsBytes
+		s.buf = appendString(s.buf, string(v))
+	case int64:
+		s.buf = strconv.AppendInt(s.buf, v, 10)
+	case int:
+		s.buf = strconv.AppendInt(s.buf, int64(v), 10)
+	case float64:
+		return s.float(v)
+	case *big.Int:
+		if v == nil {
+			s.buf = append(s.buf, "null"...)
+		} else {
+			s.buf = v.Append(s.buf, 10)
+		}
+	case []interface{}:
+		if v == nil {
+			s.buf = append(s.buf, "null"...)
+			break
+		}
+		s.buf = append(s.buf, '[')
+		for i, elem := range v {
+			if i > 0 {
+				s.buf = append(s.buf, ',')
+			}
+			if err := s.value(elem); err != nil {
+				return err
+			}
+		}
+		s.buf = append(s.buf, ']')
+	case KVS:
+		if v == nil {
+			s.buf = append(s.buf, "null"...)
+			break
+		}
+		s.buf = append(s.buf, '{')
+		for i, kv := range v {
+			if i > 0 {
+				s.buf = append(s.buf, ',')
+			}
+			s.buf = appendString(s.buf, kv.Key)
+			s.buf = append(s.buf, ':')
+			if err := s.value(kv.Value); err != nil {
+				return err
+			}
+		}
+		s.buf = append(s.buf, '}')
+	case KV:
+		s.buf = append(s.buf, `{"key":`...)
+		s.buf = appendString(s.buf, v.Key)
+		s.buf = append(s.buf, `,"value":`...)
+		if err := s.value(v.Value); err != nil {
+			return err
+		}
+		s.buf = append(s.buf, '}')
+	case map[string]interface{}:
+		if v == nil {
+			s.buf = append(s.buf, "null"...)
+			break
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		s.buf = append(s.buf, '{')
+		for i, k := range keys {
+			if i > 0 {
+				s.buf = append(s.buf, ',')
+			}
+			s.buf = appendString(s.buf, k)
+			s.buf = append(s.buf, ':')
+			if err := s.value(v[k]); err != nil {
+				return err
+			}
+		}
+		s.buf = append(s.buf, '}')
+	default:
+		if s.extEnc == nil {
+			s.extEnc = json.NewEncoder(&s.ext)
+			s.extEnc.SetEscapeHTML(false)
+		}
+		s.ext.Reset()
+		if err := s.extEnc.Encode(v); err != nil {
+			return err
+		}
+		s.buf = append(s.buf, bytes.TrimSuffix(s.ext.Bytes(), []byte("\n"))...)
+	}
+	return nil
+}
+
+// float appends f formatted as by encoding/json
+func (s *encodeState) float(f float64) error {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return &json.UnsupportedValueError{Value: reflect.ValueOf(f), Str: strconv.FormatFloat(f, 'g', -1, 64)}
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b := strconv.AppendFloat(s.buf, f, format, -1, 64)
+	if n := len(b); format == 'e' && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+		// clean up e-09 to e-9
+		b[n-2] = b[n-1]
+		b = b[:n-1]
+	}
+	if s.floats && format == 'f' && bytes.IndexByte(b[len(s.buf):], '.') < 0 {
+		b = append(b, ".0"...)
+	}
+	s.buf = b
+	return nil
+}
+
+// appendString appends s as a JSON string, escaped as by encoding/json
+// without HTML escaping
+func appendString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+		case r == '\u2028' || r == '\u2029':
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hex[r&0xf])
+		default:
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
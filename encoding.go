@@ -0,0 +1,291 @@
+package jstream
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Input encodings, as detected from the first bytes of input per RFC 4627
+const (
+	encUnknown int32 = iota
+	encUTF8
+	encUTF16LE
+	encUTF16BE
+	encUTF32LE
+	encUTF32BE
+)
+
+const (
+	transcodeChunk  = 4096
+	transcodeWindow = 1 << 16 // transcoded bytes for which source offsets are retained
+)
+
+// offsetMark records that transcoded offset dst corresponds to source
+// offset src. Between marks, each transcoded byte is an ASCII character
+// of one code unit in the source.
+type offsetMark struct {
+	dst, src int64
+}
+
+// transcoder wraps the reader of a Decoder, detecting the encoding of its
+// input on the first read and transcoding UTF-16 and UTF-32 to UTF-8.
+// UTF-8 input is passed through as is.
+type transcoder struct {
+	r    io.Reader
+	enc  int32 // accessed atomically, as detection happens on the reading goroutine
+	unit int64 // bytes per code unit
+
+	src  []byte // source bytes read but not yet transcoded
+	out  []byte // transcoded bytes not yet returned
+	rbuf []byte
+	eof  bool
+
+	// mapping of transcoded to source offsets for recent input
+	mu      sync.Mutex
+	marks   []offsetMark
+	pruneAt int // number of marks at which to next prune
+	dstPos  int64
+	srcPos  int64
+}
+
+// newTranscoder returns a transcoder for r, which begins at the given
+// offset of its input. Transcoded offsets are numbered from that offset.
+func newTranscoder(r io.Reader, offset int64) *transcoder {
+	return &transcoder{r: r, dstPos: offset, srcPos: offset}
+}
+
+func (t *transcoder) Read(p []byte) (int, error) {
+	switch atomic.LoadInt32(&t.enc) {
+	case encUTF8:
+		if len(t.src) == 0 {
+			return t.r.Read(p)
+		}
+		n := copy(p, t.src) // replay bytes read during detection
+		t.src = t.src[n:]
+		return n, nil
+	case encUnknown:
+		if err := t.detect(); err != nil {
+			return 0, err
+		}
+		return t.Read(p)
+	}
+
+	for len(t.out) == 0 {
+		if t.eof {
+			return 0, io.EOF
+		}
+		if err := t.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, t.out)
+	t.out = t.out[n:]
+	return n, nil
+}
+
+// Unwrap returns the source reader once detection has found UTF-8 input
+// and the bytes read while detecting have been replayed, after which the
+// scanner reads from the source directly; otherwise it returns nil
+func (t *transcoder) Unwrap() io.Reader {
+	if atomic.LoadInt32(&t.enc) == encUTF8 && len(t.src) == 0 {
+		return t.r
+	}
+	return nil
+}
+
+// detect reads enough of the input to determine its encoding
+func (t *transcoder) detect() error {
+	buf := make([]byte, 4)
+	var n int
+	for n < 4 {
+		m, err := t.r.Read(buf[n:])
+		n += m
+		if err == io.EOF {
+			t.eof = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// common case: neither a byte order mark nor a NUL byte
+		if n >= 2 && buf[0] != 0 && buf[1] != 0 && buf[0] != 0xFE && buf[0] != 0xFF {
+			break
+		}
+	}
+	b := buf[:n]
+
+	enc, bom := encUTF8, 0
+	switch {
+	case n >= 4 && b[0] == 0 && b[1] == 0 && b[2] == 0xFE && b[3] == 0xFF:
+		enc, bom = encUTF32BE, 4
+	case n >= 4 && b[0] == 0xFF && b[1] == 0xFE && b[2] == 0 && b[3] == 0:
+		enc, bom = encUTF32LE, 4
+	case n >= 2 && b[0] == 0xFE && b[1] == 0xFF:
+		enc, bom = encUTF16BE, 2
+	case n >= 2 && b[0] == 0xFF && b[1] == 0xFE:
+		enc, bom = encUTF16LE, 2
+	case n >= 4 && b[0] == 0 && b[1] == 0 && b[2] == 0:
+		enc = encUTF32BE
+	case n >= 4 && b[1] == 0 && b[2] == 0 && b[3] == 0:
+		enc = encUTF32LE
+	case n >= 2 && b[0] == 0:
+		enc = encUTF16BE
+	case n >= 2 && b[1] == 0:
+		enc = encUTF16LE
+	}
+
+	t.src = b[bom:]
+	if enc != encUTF8 {
+		t.unit = 2
+		if enc == encUTF32LE || enc == encUTF32BE {
+			t.unit = 4
+		}
+		t.srcPos += int64(bom)
+		t.marks = []offsetMark{{t.dstPos, t.srcPos}}
+		t.pruneAt = 1024
+		t.rbuf = make([]byte, transcodeChunk)
+	} else {
+		t.eof = false // replayed bytes are followed by the remaining input
+		t.src = b
+	}
+	atomic.StoreInt32(&t.enc, enc)
+	return nil
+}
+
+// fill reads from the source and transcodes all complete characters
+func (t *transcoder) fill() error {
+	if !t.eof {
+		n, err := t.r.Read(t.rbuf)
+		t.src = append(t.src, t.rbuf[:n]...)
+		if err == io.EOF {
+			t.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var (
+		i   int
+		buf [utf8.UTFMax]byte
+	)
+	for {
+		r, size := t.decodeRune(t.src[i:])
+		if size == 0 {
+			break
+		}
+		i += size
+		n := utf8.EncodeRune(buf[:], r)
+		t.out = append(t.out, buf[:n]...)
+		t.dstPos += int64(n)
+		t.srcPos += int64(size)
+		if n != 1 || int64(size) != t.unit {
+			t.marks = append(t.marks, offsetMark{t.dstPos, t.srcPos})
+		}
+	}
+	t.src = append(t.src[:0], t.src[i:]...)
+	t.prune()
+	return nil
+}
+
+// decodeRune decodes the first character of b, returning a size of 0 if b
+// holds an incomplete character and more input may follow. Invalid
+// characters decode as U+FFFD.
+func (t *transcoder) decodeRune(b []byte) (rune, int) {
+	if int64(len(b)) < t.unit {
+		if t.eof && len(b) > 0 {
+			return utf8.RuneError, len(b) // trailing partial code unit
+		}
+		return 0, 0
+	}
+
+	switch t.enc {
+	case encUTF32LE, encUTF32BE:
+		r := rune(b[0]) | rune(b[1])<<8 | rune(b[2])<<16 | rune(b[3])<<24
+		if t.enc == encUTF32BE {
+			r = rune(b[3]) | rune(b[2])<<8 | rune(b[1])<<16 | rune(b[0])<<24
+		}
+		if !utf8.ValidRune(r) {
+			r = utf8.RuneError
+		}
+		return r, 4
+	}
+
+	r := t.unit16(b)
+	if !utf16.IsSurrogate(r) {
+		return r, 2
+	}
+	if r >= 0xDC00 { // low surrogate without a preceding high surrogate
+		return utf8.RuneError, 2
+	}
+	if len(b) < 4 {
+		if t.eof {
+			return utf8.RuneError, 2
+		}
+		return 0, 0
+	}
+	if dec := utf16.DecodeRune(r, t.unit16(b[2:])); dec != utf8.RuneError {
+		return dec, 4
+	}
+	return utf8.RuneError, 2
+}
+
+func (t *transcoder) unit16(b []byte) rune {
+	if t.enc == encUTF16BE {
+		return rune(b[0])<<8 | rune(b[1])
+	}
+	return rune(b[1])<<8 | rune(b[0])
+}
+
+// prune discards offset marks no longer needed to map recent offsets
+func (t *transcoder) prune() {
+	if len(t.marks) < t.pruneAt {
+		return
+	}
+	min := t.dstPos - transcodeWindow
+	i := 0
+	for i+1 < len(t.marks) && t.marks[i+1].dst <= min {
+		i++
+	}
+	t.marks = append(t.marks[:0], t.marks[i:]...)
+	if t.pruneAt = 2 * len(t.marks); t.pruneAt < 1024 {
+		t.pruneAt = 1024
+	}
+}
+
+// source maps an offset into the transcoded input to the corresponding
+// offset in the source. Offsets are only retained for recently read
+// input, which spans the data buffered by the scanner.
+func (t *transcoder) source(dst int64) int64 {
+	if atomic.LoadInt32(&t.enc) <= encUTF8 {
+		return dst // kept apart from mapSource to be inlined
+	}
+	return t.mapSource(dst)
+}
+
+// mapSource maps dst to a source offset, as by source, for transcoded input
+func (t *transcoder) mapSource(dst int64) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// find the last mark at or before dst
+	lo, hi := 0, len(t.marks)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if t.marks[mid].dst <= dst {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	m := t.marks[lo]
+	if dst < m.dst {
+		return m.src
+	}
+	return m.src + (dst-m.dst)*t.unit
+}
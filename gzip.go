@@ -0,0 +1,31 @@
+package jstream
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+)
+
+// NewDecoderAuto is like NewDecoder, but transparently decompresses gzip
+// input, as detected by its magic number 1F 8B; other input is decoded as
+// is. For compressed input, offsets of values and BytesConsumed refer to
+// the decompressed input. It returns an error if the gzip header of
+// compressed input is invalid, or reading it from r fails; errors
+// reading or decompressing the input after the header end decoding at
+// the last byte read, and are reported by Err. As r is buffered, the
+// Decoder does not support SeekTo.
+func NewDecoderAuto(r io.Reader, emitDepth int) (*Decoder, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return NewDecoder(br, emitDepth), nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return NewDecoder(zr, emitDepth), nil
+}
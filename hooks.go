@@ -0,0 +1,89 @@
+package jstream
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HookError is returned when a function registered with RegisterHook
+// fails to decode a value
+type HookError struct {
+	Offset int64    // byte offset of the value
+	Line   int      // line number of the value
+	Keys   []string // keys of the value
+	Err    error    // the error returned by the hook
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("jstream: hook for %s failed at offset %d, line %d: %v", FormatPath(e.Keys), e.Offset, e.Line, e.Err)
+}
+
+func (e *HookError) Unwrap() error { return e.Err }
+
+type hook struct {
+	pattern []string
+	fn      func(raw []byte, t ValueType) (interface{}, error)
+}
+
+// RegisterHook sets fn to decode each value whose Keys match pattern, in
+// place of the default decoding: fn is passed the value's bytes as they
+// appear in the input, valid only for the duration of the call, and its
+// JSON type, and returns the value to store and emit. The value's
+// contents are neither decoded nor emitted. An error returned by fn stops
+// decoding with a HookError.
+//
+// A pattern holds one segment per key, separated by dots: "*" matches any
+// single key, "**" any number of keys, and other segments a key exactly.
+// e.g. "**.timestamp" matches timestamp members at any depth, and
+// "items.*.price" the price of each element of the items array. The
+// empty pattern matches top-level values. Where several patterns match,
+// the first registered applies.
+func (d *Decoder) RegisterHook(pattern string, fn func(raw []byte, t ValueType) (interface{}, error)) *Decoder {
+	h := hook{pattern: []string{}, fn: fn}
+	if pattern != "" {
+		h.pattern = strings.Split(pattern, ".")
+	}
+	d.hooks = append(d.hooks, h)
+	return d
+}
+
+// hookValue decodes the value beginning at the current position with the
+// first hook matching keys, reporting false if none match
+func (d *Decoder) hookValue(keys []string) (interface{}, ValueType, bool, error) {
+	for _, h := range d.hooks {
+		if !matchKeys(h.pattern, keys) {
+			continue
+		}
+		offset, line, t := d.offset(), d.lineNo+1, rawType(d.Cur())
+		d.StartCapture()
+		err := d.skip()
+		raw := d.Captured()
+		if err != nil {
+			return nil, t, true, err
+		}
+		v, err := h.fn(raw, t)
+		if err != nil {
+			return nil, t, true, &HookError{Offset: offset, Line: line, Keys: keys, Err: err}
+		}
+		return v, t, true, nil
+	}
+	return nil, Unknown, false, nil
+}
+
+// matchKeys reports whether keys match the segments of a hook pattern
+func matchKeys(pattern, keys []string) bool {
+	for i, p := range pattern {
+		if p == "**" {
+			for j := i; j <= len(keys); j++ {
+				if matchKeys(pattern[i+1:], keys[j:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if i >= len(keys) || (p != "*" && p != keys[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(keys)
+}
@@ -0,0 +1,34 @@
+package jstream
+
+const (
+	maxInterned   = 4096 // number of distinct keys interned per Decoder
+	maxInternSize = 128  // longest key interned
+)
+
+// InternKeys reuses a single string for each distinct object key, rather
+// than allocating a new one each time the key is read, reducing garbage
+// when many objects share the same keys, as in NDJSON records. Keys are
+// compared once unescaped, so differently escaped forms of a key share a
+// string. Only the first 4096 distinct keys of up to 128 bytes are
+// interned, bounding the memory retained for inputs with many distinct
+// keys.
+func (d *Decoder) InternKeys() *Decoder {
+	d.interned = make(map[string]string)
+	return d
+}
+
+// key returns the object key read into the scratch buffer by scanKey
+func (d *Decoder) key() string {
+	b := d.scratch.Bytes()
+	if d.interned == nil || len(b) > maxInternSize {
+		return string(b)
+	}
+	if k, ok := d.interned[string(b)]; ok { // lookup does not allocate
+		return k
+	}
+	k := string(b)
+	if len(d.interned) < maxInterned {
+		d.interned[k] = k
+	}
+	return k
+}
@@ -2,27 +2,91 @@ package internal
 
 import (
 	"fmt"
+	"io"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // Predefined errors
 var (
 	ErrSyntax        = SyntaxError{msg: "invalid character"}
 	ErrUnexpectedEOF = SyntaxError{msg: "unexpected end of JSON input"}
+	ErrTrailingData  = SyntaxError{msg: "unexpected data after top-level value"}
+	ErrNumberTooLong = SyntaxError{msg: "numeric literal longer than"}
 )
 
-type errPos [2]int // line number, byte offset where error occurred
-
+// SyntaxError describes malformed input, and where it was found
 type SyntaxError struct {
 	msg     string // description of error
 	Context string // additional error context
-	Pos     errPos
-	AtChar  byte
+	Line    int    // line number where error occurred, from 1
+	Column  int    // byte offset within the line where error occurred, from 1
+	AtChar  byte   // byte at which error occurred, or 0 at the end of input
+	Offset  int64  // byte offset where error occurred
+
+	// input around the error, and the index of the offending byte within
+	// it, or its length if the error is at the end of input
+	Snippet    []byte
+	SnippetPos int
 }
 
 func (e SyntaxError) Error() string {
-	loc := fmt.Sprintf("%s [%d,%d]", quoteChar(e.AtChar), e.Pos[0], e.Pos[1])
-	return fmt.Sprintf("%s %s: %s", e.msg, e.Context, loc)
+	loc := fmt.Sprintf("%s [%d,%d] offset %d", quoteChar(e.AtChar), e.Line, e.Column, e.Offset)
+	msg := fmt.Sprintf("%s %s: %s", e.msg, e.Context, loc)
+	if len(e.Snippet) == 0 {
+		return msg
+	}
+	snippet, caret := formatSnippet(e.Snippet, e.SnippetPos)
+	return msg + "\n\t" + snippet + "\n\t" + strings.Repeat(" ", caret) + "^"
+}
+
+// Is reports whether target is one of the predefined errors, and e an
+// instance of it
+func (e SyntaxError) Is(target error) bool {
+	t, ok := target.(SyntaxError)
+	return ok && t.msg == e.msg
+}
+
+// Unwrap reports io.ErrUnexpectedEOF for input ending within a value
+func (e SyntaxError) Unwrap() error {
+	if e.msg == ErrUnexpectedEOF.msg {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// formatSnippet renders b on a single line, escaping control characters
+// and invalid UTF-8, and returns the column at which the byte at index at
+// is rendered
+func formatSnippet(b []byte, at int) (string, int) {
+	var (
+		sb    strings.Builder
+		caret int
+	)
+	for i := 0; i < len(b); {
+		if i <= at {
+			caret = utf8.RuneCountInString(sb.String())
+		}
+		r, n := utf8.DecodeRune(b[i:])
+		switch {
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f || r == utf8.RuneError && n == 1:
+			fmt.Fprintf(&sb, `\x%02x`, b[i])
+		default:
+			sb.Write(b[i : i+n])
+		}
+		i += n
+	}
+	if at >= len(b) {
+		caret = utf8.RuneCountInString(sb.String())
+	}
+	return sb.String(), caret
 }
 
 // quoteChar formats c as a quoted character literal
@@ -36,6 +100,6 @@ func quoteChar(c byte) string {
 	}
 
 	// use quoted string with different quotation marks
-	s := strconv.Quote(string(c))
+	s := strconv.Quote(string([]byte{c}))
 	return "'" + s[1:len(s)-1] + "'"
 }
@@ -2,55 +2,137 @@ package scanner
 
 import (
 	"io"
+	"sync"
 	"sync/atomic"
 )
 
 const (
-	chunk   = 4095 // ~4k
-	maxUint = ^uint(0)
-	maxInt  = int64(maxUint >> 1)
+	chunk = 4095 // ~4k
+	// DefaultLookback is the number of bytes a Scanner created by New
+	// can be rewound by with Back and BackN
+	DefaultLookback = 16
+	maxUint         = ^uint(0)
+	maxInt          = int64(maxUint >> 1)
 )
 
 type Scanner struct {
 	Pos       int64 // position in reader
 	End       int64
-	ipos      int64           // internal buffer position
-	ifill     int64           // internal buffer fill
-	buf       [chunk + 1]byte // internal buffer (with a lookback size of 1)
-	nbuf      [chunk]byte     // next internal buffer
+	base      int64       // position of the first byte of input
+	ipos      int64       // internal buffer position
+	ifill     int64       // internal buffer fill
+	buf       []byte      // internal buffer (lookback region, chunk and room for a trailing NUL)
+	lookback  int64       // size of the lookback region at the start of buf
+	nbuf      [chunk]byte // next internal buffer
 	fillReq   chan struct{}
 	fillReady chan int64
+	consumed  int64         // Pos as last published for other goroutines
+	onDemand  bool          // read only once the buffer is exhausted
+	requested bool          // a fill has been requested and not yet received
+	readErr   atomic.Value  // readError ending input, set before End
+	done      chan struct{} // closed to stop reading
+	stopped   chan struct{} // closed once reading has stopped
+	closeOnce sync.Once
+
+	onRefill func() // called after each buffer refill
+
+	// mirroring consumed bytes to a writer
+	tee      io.Writer
+	teeStart int64 // start of the bytes in buf not yet written to tee
+	teeErr   error
+
+	// capturing consumed bytes across buffer refills
+	capMarks []int64 // positions at which the captures in progress began
+	capPos   int64   // position of the first byte in capBuf
+	capStart int64   // start of the part of buf not yet in capBuf
+	capBuf   []byte  // bytes captured from capPos
 }
 
-func New(r io.Reader) *Scanner {
+// Unwrapper is implemented by readers which may come to pass the input of
+// an underlying reader through unchanged, such that the Scanner then reads
+// from it directly: Unwrap returns that reader, or nil until then. It is
+// called from the goroutine reading r.
+type Unwrapper interface {
+	Unwrap() io.Reader
+}
+
+func New(r io.Reader) *Scanner { return NewLookback(r, DefaultLookback) }
+
+// NewLookback returns a Scanner that can be rewound by up to n bytes,
+// regardless of where buffer refills occurred. n is at least 1.
+func NewLookback(r io.Reader, n int) *Scanner { return NewAt(r, n, 0) }
+
+// NewAt is like NewLookback, but numbers positions from pos rather than
+// 0, for a reader which begins at that offset of its input
+func NewAt(r io.Reader, n int, pos int64) *Scanner {
+	if n < 1 {
+		n = 1
+	}
 	sr := &Scanner{
+		Pos:       pos,
+		base:      pos,
+		consumed:  pos,
 		End:       maxInt,
+		buf:       make([]byte, n+chunk+1),
+		lookback:  int64(n),
+		teeStart:  int64(n),
+		ipos:      int64(n - 1),
+		ifill:     int64(n - 1),
 		fillReq:   make(chan struct{}),
 		fillReady: make(chan int64),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		requested: true,
 	}
 
 	go func() {
-		var rpos int64 // total bytes read into buffer
+		defer close(sr.stopped)
+		rpos := pos // total bytes read into buffer, from pos
+		u, _ := r.(Unwrapper)
+
+		for {
+			select {
+			case <-sr.fillReq:
+			case <-sr.done:
+				return
+			}
 
-		for range sr.fillReq {
 		scan:
+			if u != nil {
+				if ur := u.Unwrap(); ur != nil {
+					r, u = ur, nil // read from the underlying reader directly
+				}
+			}
 			n, err := r.Read(sr.nbuf[:])
 
 			if n == 0 {
 				switch err {
 				case io.EOF: // reader is exhausted
-					atomic.StoreInt64(&sr.End, rpos)
+					atomic.CompareAndSwapInt64(&sr.End, maxInt, rpos)
 					close(sr.fillReady)
 					return
 				case nil: // no data and no error, retry fill
 					goto scan
 				default:
-					panic(err)
+					select {
+					case <-sr.done: // the reader may be closed once reading is stopped
+						return
+					default:
+					}
+					// end input where reading failed, reporting err by ReadErr
+					sr.readErr.Store(readError{err})
+					atomic.CompareAndSwapInt64(&sr.End, maxInt, rpos)
+					close(sr.fillReady)
+					return
 				}
 			}
 
 			rpos += int64(n)
-			sr.fillReady <- int64(n)
+			select {
+			case sr.fillReady <- int64(n):
+			case <-sr.done:
+				return
+			}
 		}
 	}()
 
@@ -59,6 +141,36 @@ func New(r io.Reader) *Scanner {
 	return sr
 }
 
+// NewBytes returns a Scanner over b, numbering positions from pos as
+// NewAt does. Having all of its input, it reads nothing on another
+// goroutine, and can be reused for other input with Reset.
+func NewBytes(b []byte, pos int64) *Scanner {
+	sr := &Scanner{
+		buf:      make([]byte, DefaultLookback, DefaultLookback+len(b)+1),
+		lookback: DefaultLookback,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	close(sr.stopped)
+	sr.Reset(b, pos)
+	return sr
+}
+
+// Reset makes a Scanner created by NewBytes scan b from its beginning,
+// as if newly created, reusing the Scanner's buffer
+func (s *Scanner) Reset(b []byte, pos int64) {
+	for i := range s.buf[:s.lookback] {
+		s.buf[i] = 0
+	}
+	s.buf = append(append(s.buf[:s.lookback], b...), 0) // room for the virtual NUL
+	s.Pos, s.base, s.consumed = pos, pos, pos
+	s.End = pos + int64(len(b))
+	s.ipos = s.lookback - 1
+	s.ifill = s.lookback + int64(len(b)) - 1
+	s.teeStart = s.lookback
+	s.capMarks = s.capMarks[:0]
+}
+
 // remaining returns the number of unread bytes
 // if EOF for the underlying reader has not yet been found,
 // maximum possible integer value will be returned
@@ -72,22 +184,78 @@ func (s *Scanner) Remaining() int64 {
 // read byte at current position (without advancing)
 func (s *Scanner) Cur() byte { return s.buf[s.ipos] }
 
-// read next byte
+// Peek returns the next byte without advancing, reading ahead into the
+// next buffer fill if necessary. At the end of input it returns 0.
+func (s *Scanner) Peek() byte {
+	if s.ipos < s.ifill {
+		return s.buf[s.ipos+1]
+	}
+	if s.EOF() {
+		return 0
+	}
+	c := s.Next()
+	s.Back() // always within the lookback following a refill
+	return c
+}
+
+// read next byte. once the input is exhausted, the scanner advances
+// onto a single virtual NUL byte past the end of input; see EOF
 func (s *Scanner) Next() byte {
 	if s.Pos >= atomic.LoadInt64(&s.End) {
-		return byte(0)
+		return s.eof()
 	}
 	s.ipos++
 
 	if s.ipos > s.ifill { // internal buffer is exhausted
-		s.ifill = <-s.fillReady
-		s.buf[0] = s.buf[len(s.buf)-1] // copy current last item to guarantee lookback
-		copy(s.buf[1:], s.nbuf[:])     // copy contents of pre-filled next buffer
-		s.ipos = 1                     // move to beginning of internal buffer
+		var (
+			n  int64
+			ok bool
+		)
+		if !s.requested {
+			select {
+			case s.fillReq <- struct{}{}:
+			case <-s.done:
+			case <-s.stopped: // the reader was exhausted since checking End
+			}
+		}
+		s.requested = false
+		select {
+		case n, ok = <-s.fillReady:
+		case <-s.done:
+			// end input at the current position
+			atomic.CompareAndSwapInt64(&s.End, maxInt, s.Pos)
+		}
+		if !ok { // reader is exhausted or scanner closed
+			s.ipos--
+			return s.eof()
+		}
+		if len(s.capMarks) > 0 {
+			s.capBuf = append(s.capBuf, s.buf[s.capStart:s.ifill+1]...)
+			s.capStart = s.lookback
+		}
+		if s.tee != nil {
+			s.writeTee(s.ifill + 1)
+			s.teeStart = s.lookback
+		}
+
+		// copy the last bytes read to guarantee lookback
+		copy(s.buf[:s.lookback], s.buf[s.ifill+1-s.lookback:s.ifill+1])
+		copy(s.buf[s.lookback:], s.nbuf[:n]) // copy contents of pre-filled next buffer
+		s.ifill = s.lookback + n - 1
+		s.ipos = s.lookback // move to beginning of chunk
+
+		atomic.StoreInt64(&s.consumed, s.Pos)
+		if s.onRefill != nil {
+			s.onRefill()
+		}
 
 		// request next fill to be prepared
-		if s.End == maxInt {
-			s.fillReq <- struct{}{}
+		if !s.onDemand && atomic.LoadInt64(&s.End) == maxInt {
+			select {
+			case s.fillReq <- struct{}{}:
+				s.requested = true
+			case <-s.done:
+			}
 		}
 	}
 
@@ -95,13 +263,190 @@ func (s *Scanner) Next() byte {
 	return s.buf[s.ipos]
 }
 
-// back undoes a previous call to next(), moving backward one byte in the internal buffer.
-// as we only guarantee a lookback buffer size of one, any subsequent calls to back()
-// before calling next() may panic
-func (s *Scanner) Back() {
-	if s.ipos <= 0 {
+// StartCapture begins recording consumed input, starting with the byte
+// at the current position. Captures may be nested, each ended by a call
+// to Captured.
+func (s *Scanner) StartCapture() {
+	if len(s.capMarks) == 0 {
+		s.capPos = s.Pos
+		s.capStart = s.ipos
+		s.capBuf = s.capBuf[:0]
+	}
+	s.capMarks = append(s.capMarks, s.Pos)
+}
+
+// Captured returns the input consumed since the matching StartCapture,
+// through the byte at the current position, and ends that capture. The
+// returned slice is only valid until the next call to StartCapture
+// outside of any capture.
+func (s *Scanner) Captured() []byte {
+	n := int(s.Pos-s.capPos) + 1
+	if s.EOF() {
+		n-- // exclude the virtual NUL
+	}
+	if m := n - len(s.capBuf); m > 0 {
+		s.capBuf = append(s.capBuf, s.buf[s.capStart:s.capStart+int64(m)]...)
+		s.capStart += int64(m)
+	}
+	mark := s.capMarks[len(s.capMarks)-1]
+	s.capMarks = s.capMarks[:len(s.capMarks)-1]
+	return s.capBuf[mark-s.capPos : n]
+}
+
+// ReadOnDemand stops the scanner from reading ahead: rather than reading
+// the next chunk from the reader while the current one is consumed, it
+// reads it once the current chunk is exhausted. Input is then read no
+// further than required by the bytes consumed, besides the remainder of
+// the last chunk, reported by Buffered.
+func (s *Scanner) ReadOnDemand() { s.onDemand = true }
+
+// Buffered returns the bytes read from the reader following the current
+// position, excluding any chunk read ahead. The result is only valid
+// until the next call to Next.
+func (s *Scanner) Buffered() []byte {
+	if s.EOF() {
+		return nil
+	}
+	return s.buf[s.ipos+1 : s.ifill+1]
+}
+
+// ReadErr returns the error returned by the underlying reader, other than
+// io.EOF, once the scanner has reached the end of input at the position
+// where reading failed, or nil
+func (s *Scanner) ReadErr() error {
+	if e, ok := s.readErr.Load().(readError); ok && s.EOF() {
+		return e.err
+	}
+	return nil
+}
+
+// readError holds an error, as atomic.Value requires a consistent type
+type readError struct{ err error }
+
+// Close stops the scanner from reading further input: once the bytes
+// already buffered are consumed, the scanner behaves as if at EOF.
+// It is safe to call from any goroutine, and more than once.
+func (s *Scanner) Close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// OnRefill sets a function called by Next after each buffer refill, once
+// the bytes before the refill are reported by Consumed
+func (s *Scanner) OnRefill(fn func()) { s.onRefill = fn }
+
+// Tee mirrors the bytes consumed by the scanner to w, in order and once
+// each, regardless of rewinding: bytes are written on each buffer refill
+// and by FlushTee. The first error returned by w is reported by TeeErr,
+// after which nothing more is written.
+func (s *Scanner) Tee(w io.Writer) { s.tee = w }
+
+// FlushTee writes the bytes consumed through the current position and
+// not yet written to the writer set by Tee
+func (s *Scanner) FlushTee() {
+	if s.tee == nil {
+		return
+	}
+	end := s.ipos + 1
+	if s.EOF() {
+		end-- // the virtual NUL
+	}
+	if end > s.teeStart {
+		s.writeTee(end)
+		s.teeStart = end
+	}
+}
+
+// TeeErr returns the first error returned by the writer set by Tee
+func (s *Scanner) TeeErr() error { return s.teeErr }
+
+func (s *Scanner) writeTee(end int64) {
+	if s.teeErr == nil {
+		_, s.teeErr = s.tee.Write(s.buf[s.teeStart:end])
+	}
+}
+
+// Stop closes the scanner as by Close, then waits for any read from the
+// underlying reader in progress to return, after which the scanner no
+// longer accesses the reader
+func (s *Scanner) Stop() {
+	s.Close()
+	<-s.stopped
+}
+
+// Publish makes the current position visible to Consumed. Pos itself is
+// only safe to access from the goroutine driving the scanner, and is
+// otherwise published on each buffer refill.
+func (s *Scanner) Publish() {
+	n := s.Pos
+	if s.EOF() {
+		n-- // advanced onto the virtual NUL
+	}
+	atomic.StoreInt64(&s.consumed, n)
+}
+
+// Consumed returns the number of bytes of input consumed as of the last
+// call to Publish or buffer refill. It is safe to call from any goroutine.
+func (s *Scanner) Consumed() int64 { return atomic.LoadInt64(&s.consumed) }
+
+// EOF reports whether the scanner has advanced past the last byte of input
+func (s *Scanner) EOF() bool { return s.Pos > atomic.LoadInt64(&s.End) }
+
+// eof moves onto the virtual NUL byte following the last byte of input,
+// such that Cur returns 0 and Back returns to the last byte
+func (s *Scanner) eof() byte {
+	if s.Pos == atomic.LoadInt64(&s.End) {
+		s.ipos++
+		s.buf[s.ipos] = 0
+		s.Pos++
+	}
+	return byte(0)
+}
+
+// Window returns the input around the current position still held in the
+// buffer: up to before bytes preceding it, the byte at it and up to after
+// bytes following it which have already been read, along with the index
+// of the current byte within the result. At the end of input, the index
+// is the length of the result, following the last byte. The result is
+// only valid until the next call to Next.
+func (s *Scanner) Window(before, after int) ([]byte, int) {
+	cur := s.ipos
+	end := s.ifill + 1
+	if s.EOF() {
+		end = cur // exclude the virtual NUL
+	}
+	start := cur - int64(before)
+	if first := cur - (s.Pos - 1 - s.base); start < first {
+		start = first // before the beginning of input
+	}
+	if start < 0 {
+		start = 0
+	} else if start > cur {
+		start = cur
+	}
+	if e := cur + 1 + int64(after); end > e {
+		end = e
+	}
+	if end < cur {
+		end = cur
+	}
+	return s.buf[start:end], int(cur - start)
+}
+
+// Lookback returns the maximum number of bytes the scanner can be
+// rewound by with BackN
+func (s *Scanner) Lookback() int { return int(s.lookback) }
+
+// Back undoes a previous call to Next, moving backward one byte; it is
+// equivalent to BackN(1)
+func (s *Scanner) Back() { s.BackN(1) }
+
+// BackN undoes the previous n calls to Next. Rewinding is guaranteed to
+// succeed for up to Lookback bytes in total since the furthest position
+// reached; rewinding further, or before the beginning of input, panics
+func (s *Scanner) BackN(n int) {
+	if int64(n) > s.ipos || int64(n) > s.Pos {
 		panic("back buffer exhausted")
 	}
-	s.ipos--
-	s.Pos--
+	s.ipos -= int64(n)
+	s.Pos -= int64(n)
 }
@@ -12,6 +12,15 @@ type Scratch struct {
 // reset scratch buffer
 func (s *Scratch) Reset() { s.fill = 0 }
 
+// reset scratch buffer, replacing its backing array with one of size max
+// if it has grown beyond max
+func (s *Scratch) ResetCap(max int) {
+	s.fill = 0
+	if cap(s.Data) > max {
+		s.Data = make([]byte, max)
+	}
+}
+
 // bytes returns the written contents of scratch buffer
 func (s *Scratch) Bytes() []byte { return s.Data[0:s.fill] }
 
@@ -0,0 +1,68 @@
+package jstream
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Get returns the value of the first member of kvs with the given key
+func (kvs KVS) Get(key string) (interface{}, bool) {
+	for _, kv := range kvs {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Has reports whether kvs has a member with the given key
+func (kvs KVS) Has(key string) bool {
+	_, ok := kvs.Get(key)
+	return ok
+}
+
+// Set replaces the value of the first member of kvs with the given key,
+// keeping its position, or otherwise appends a member, returning the
+// updated KVS
+func (kvs KVS) Set(key string, v interface{}) KVS {
+	for i := range kvs {
+		if kvs[i].Key == key {
+			kvs[i].Value = v
+			return kvs
+		}
+	}
+	return append(kvs, KV{Key: key, Value: v})
+}
+
+// Delete removes every member of kvs with the given key, in place,
+// returning the updated KVS
+func (kvs KVS) Delete(key string) KVS {
+	out := kvs[:0]
+	for _, kv := range kvs {
+		if kv.Key != key {
+			out = append(out, kv)
+		}
+	}
+	for i := len(out); i < len(kvs); i++ {
+		kvs[i] = KV{} // release removed values
+	}
+	return out
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a JSON object into
+// kvs with its members in the order of the source, as with ObjectAsKVS.
+// Nested objects are decoded as KVS, and numbers as int64 or float64.
+func (kvs *KVS) UnmarshalJSON(b []byte) error {
+	d := NewDecoder(bytes.NewReader(b), 0).ObjectAsKVS().SingleDocument()
+	return d.Walk(func(mv *MetaValue) error {
+		switch v := mv.Value.(type) {
+		case KVS:
+			*kvs = v
+		case nil:
+			// null leaves kvs unchanged, as with encoding/json
+		default:
+			return fmt.Errorf("jstream: cannot unmarshal %T into KVS", v)
+		}
+		return nil
+	})
+}
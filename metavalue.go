@@ -0,0 +1,142 @@
+package jstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// metaValueJSON is the encoding of a MetaValue by MarshalJSON
+type metaValueJSON struct {
+	Offset       int64           `json:"offset"`
+	Length       int64           `json:"length"`
+	Line         int             `json:"line"`
+	Depth        int             `json:"depth"`
+	Keys         []string        `json:"keys"`
+	Index        int             `json:"index"`
+	ParentOffset int64           `json:"parentOffset"`
+	Type         ValueType       `json:"type"`
+	Value        json.RawMessage `json:"value"`
+	KV           *kvJSON         `json:"kv,omitempty"`  // for KV values, in place of Value
+	KVS          bool            `json:"kvs,omitempty"` // objects within the value are KVS
+	Source       int             `json:"source,omitempty"`
+	Err          string          `json:"err,omitempty"`
+	Raw          []byte          `json:"raw,omitempty"`
+}
+
+type kvJSON struct {
+	Key    string          `json:"key"`
+	Value  json.RawMessage `json:"value"`
+	Length int64           `json:"length"`
+}
+
+// MarshalJSON encodes mv as an object with its position and type, such
+// as to persist emitted values for later replay, from which UnmarshalJSON
+// restores it. Value is restored with the Go types a Decoder produces:
+// KV and KVS as emitted with EmitKV and ObjectAsKVS, int64, float64 and,
+// as with UseBigInt, *big.Int. A []byte from StringsAsBytes is restored
+// as a string, values of other types as decoded by a Decoder, and Err as
+// an error with the same message.
+func (mv MetaValue) MarshalJSON() ([]byte, error) {
+	j := metaValueJSON{
+		Offset:       mv.Offset,
+		Length:       mv.Length,
+		Line:         mv.Line,
+		Depth:        mv.Depth,
+		Keys:         mv.Keys,
+		Index:        mv.Index,
+		ParentOffset: mv.ParentOffset,
+		Type:         mv.ValueType,
+		KVS:          containsKVS(mv.Value),
+		Source:       mv.Source,
+		Raw:          mv.Raw,
+	}
+	if mv.Err != nil {
+		j.Err = mv.Err.Error()
+	}
+
+	s := encodeState{floats: true}
+	if kv, ok := mv.Value.(KV); ok {
+		if err := s.value(kv.Value); err != nil {
+			return nil, err
+		}
+		j.KV = &kvJSON{Key: kv.Key, Value: s.buf, Length: kv.Length}
+	} else {
+		if err := s.value(mv.Value); err != nil {
+			return nil, err
+		}
+		j.Value = s.buf
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes a MetaValue encoded by MarshalJSON
+func (mv *MetaValue) UnmarshalJSON(b []byte) error {
+	var j metaValueJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*mv = MetaValue{
+		Offset:       j.Offset,
+		Length:       j.Length,
+		Line:         j.Line,
+		Depth:        j.Depth,
+		Keys:         j.Keys,
+		Index:        j.Index,
+		ParentOffset: j.ParentOffset,
+		ValueType:    j.Type,
+		Source:       j.Source,
+		Raw:          j.Raw,
+	}
+	if j.Err != "" {
+		mv.Err = errors.New(j.Err)
+	}
+
+	var err error
+	if j.KV != nil {
+		kv := KV{Key: j.KV.Key, ValueType: j.Type, Length: j.KV.Length}
+		kv.Value, err = unmarshalValue(j.KV.Value, j.KVS)
+		mv.Value = kv
+	} else {
+		mv.Value, err = unmarshalValue(j.Value, j.KVS)
+	}
+	return err
+}
+
+// unmarshalValue decodes the value encoded by MarshalJSON in raw
+func unmarshalValue(raw []byte, kvs bool) (interface{}, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	d := NewDecoder(bytes.NewReader(raw), 0).SingleDocument().UseBigInt()
+	d.objectAsKVS = kvs
+	var v interface{}
+	err := d.Walk(func(mv *MetaValue) error {
+		v = mv.Value
+		return nil
+	})
+	return v, err
+}
+
+// containsKVS reports whether an object within v is a KVS
+func containsKVS(v interface{}) bool {
+	switch v := v.(type) {
+	case KVS:
+		return true
+	case KV:
+		return containsKVS(v.Value)
+	case []interface{}:
+		for _, elem := range v {
+			if containsKVS(elem) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, elem := range v {
+			if containsKVS(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
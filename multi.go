@@ -0,0 +1,186 @@
+package jstream
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// SourceError reports the failure to decode one of the readers of a
+// MultiDecoder
+type SourceError struct {
+	Source int // index of the reader
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("jstream: source %d: %v", e.Source, e.Err)
+}
+
+func (e *SourceError) Unwrap() error { return e.Err }
+
+// MultiDecoder decodes several readers, such as the shards of a single
+// dataset, into a single stream of values
+type MultiDecoder struct {
+	emitDepth       int
+	readers         []io.Reader
+	workers         int
+	continueOnError bool
+	configure       func(*Decoder) *Decoder
+
+	metaCh chan *MetaValue
+	done   chan struct{} // closed once decoding is stopped
+
+	mu       sync.Mutex
+	decoders []*Decoder // of the readers being decoded
+	errs     []*SourceError
+	stopped  bool
+	closed   bool // stopped by Close
+	finished bool
+}
+
+// NewMultiDecoder creates a MultiDecoder reading JSON values at the
+// provided emitDepth from each of the readers in turn, as NewDecoder
+// would
+func NewMultiDecoder(emitDepth int, rs ...io.Reader) *MultiDecoder {
+	return &MultiDecoder{
+		emitDepth: emitDepth,
+		readers:   rs,
+		workers:   1,
+		metaCh:    make(chan *MetaValue, defaultBuffer),
+		done:      make(chan struct{}),
+		decoders:  make([]*Decoder, len(rs)),
+	}
+}
+
+// Configure sets a function applied to the Decoder of each reader before
+// it is decoded, such as to enable EmitKV or other options
+func (m *MultiDecoder) Configure(fn func(*Decoder) *Decoder) *MultiDecoder {
+	m.configure = fn
+	return m
+}
+
+// Concurrency sets the number of readers decoded at a time, 1 by
+// default. Values of each reader are delivered in order, but those of
+// readers decoded concurrently are interleaved. It panics if n is less
+// than 1.
+func (m *MultiDecoder) Concurrency(n int) *MultiDecoder {
+	if n < 1 {
+		panic("jstream: invalid MultiDecoder concurrency")
+	}
+	m.workers = n
+	return m
+}
+
+// ContinueOnError continues decoding the remaining readers after one
+// fails, rather than stopping all decoding. The errors of all readers
+// are reported by Errs.
+func (m *MultiDecoder) ContinueOnError() *MultiDecoder {
+	m.continueOnError = true
+	return m
+}
+
+// Stream begins decoding the readers and returns a channel of the values
+// emitted from all of them, with Source set to the index of each value's
+// reader. Offsets, lines and other positions remain relative to the
+// reader. The channel is closed once all readers have been decoded or
+// decoding stops, after Err and Errs are set.
+func (m *MultiDecoder) Stream() chan *MetaValue {
+	go func() {
+		var (
+			wg  sync.WaitGroup
+			sem = make(chan struct{}, m.workers)
+		)
+		for i, r := range m.readers {
+			sem <- struct{}{}
+			d := NewDecoder(r, m.emitDepth)
+			if m.configure != nil {
+				d = m.configure(d)
+			}
+			m.mu.Lock()
+			stopped := m.stopped
+			m.decoders[i] = d
+			m.mu.Unlock()
+			if stopped {
+				break
+			}
+
+			wg.Add(1)
+			go func(i int, d *Decoder) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				err := d.Walk(func(mv *MetaValue) error {
+					mv.Source = i
+					select {
+					case m.metaCh <- mv:
+						return nil
+					case <-m.done:
+						return ErrClosed
+					}
+				})
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				if err == nil || m.stopped && err == ErrClosed {
+					return
+				}
+				m.errs = append(m.errs, &SourceError{Source: i, Err: err})
+				if !m.continueOnError {
+					m.stop()
+				}
+			}(i, d)
+		}
+		wg.Wait()
+		m.mu.Lock()
+		m.finished = true
+		m.mu.Unlock()
+		close(m.metaCh)
+	}()
+	return m.metaCh
+}
+
+// stop closes the decoders of all readers being decoded, and prevents
+// further readers from being decoded; m.mu must be held
+func (m *MultiDecoder) stop() {
+	if !m.stopped {
+		close(m.done)
+	}
+	m.stopped = true
+	for _, d := range m.decoders {
+		if d != nil {
+			d.Close()
+		}
+	}
+}
+
+// Close stops decoding of all readers, with Err reporting ErrClosed
+// unless a reader failed first. Values already buffered in the channel
+// may still be received. It is safe to call more than once.
+func (m *MultiDecoder) Close() error {
+	m.mu.Lock()
+	m.closed = m.closed || !m.stopped && !m.finished
+	m.stop()
+	m.mu.Unlock()
+	return nil
+}
+
+// Err returns the first error of any reader as a *SourceError, ErrClosed
+// if decoding was stopped by Close, or nil
+func (m *MultiDecoder) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case len(m.errs) > 0:
+		return m.errs[0]
+	case m.closed:
+		return ErrClosed
+	}
+	return nil
+}
+
+// Errs returns the errors of all readers that failed to decode, in the
+// order in which they failed
+func (m *MultiDecoder) Errs() []*SourceError {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*SourceError(nil), m.errs...)
+}
@@ -0,0 +1,69 @@
+package jstream
+
+import "github.com/xenking/jstream/internal"
+
+// NDJSON decodes the input as newline-delimited JSON: each non-blank line
+// holds exactly one document, and blank lines are skipped. A line that
+// fails to decode does not stop decoding; instead a MetaValue with Err
+// set is emitted for it, and decoding resumes on the following line. The
+// values of a document are emitted only once its line is complete, so a
+// malformed line produces no values other than its error.
+func (d *Decoder) NDJSON() *Decoder {
+	d.ndjson = true
+	return d
+}
+
+// endLine consumes the whitespace following a top-level value in NDJSON
+// mode, which must be followed by a newline or the end of input
+func (d *Decoder) endLine() error {
+	for {
+		switch d.Peek() {
+		case ' ', '\t', '\r':
+			d.Next()
+		case '\n':
+			return nil
+		case 0xC2, 0xEF:
+			if c := d.Next(); !d.lenient || d.strict || !d.lenientSpace(c) {
+				return d.mkError(internal.ErrSyntax, "after top-level value")
+			}
+		default:
+			if c := d.Next(); c == 0 && d.EOF() {
+				return nil
+			}
+			return d.mkError(internal.ErrSyntax, "after top-level value")
+		}
+	}
+}
+
+// lineError emits err for the line whose document began at offset, and
+// skips the remainder of the line
+func (d *Decoder) lineError(offset int64, line int, err error) error {
+	d.depth = 0
+	d.parents = d.parents[:0]
+	d.held = d.held[:0]
+	d.spaceErr = nil
+
+	for c := d.Cur(); c != '\n'; c = d.Next() {
+		if c == 0 && d.EOF() {
+			break
+		}
+	}
+	end := d.offset()
+	if d.Cur() == '\n' && d.lineStart != d.Pos {
+		d.lineStart = d.Pos
+		d.lineNo++
+	}
+
+	if d.emitFn == nil {
+		return nil
+	}
+	return d.send(d.newMetaValue(MetaValue{
+		Offset:       offset,
+		Length:       end - offset,
+		Line:         line,
+		Keys:         []string{},
+		Index:        -1,
+		ParentOffset: -1,
+		Err:          err,
+	}))
+}
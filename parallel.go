@@ -0,0 +1,420 @@
+package jstream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xenking/jstream/internal"
+	"github.com/xenking/jstream/internal/scanner"
+	data "github.com/xenking/jstream/internal/scratch"
+)
+
+var errParallelMode = errors.New("jstream: StreamParallel requires emit depth 1, without Recursive, comments, NDJSON, JSONSeq or DedupWindow")
+
+// ElementError reports the failure to decode an element of a top-level
+// array by StreamParallel. The Line and Column of a SyntaxError it wraps
+// are relative to the element, while its Offset is within the input.
+type ElementError struct {
+	Offset int64 // byte offset of the element
+	Index  int   // index of the element within its array
+	Err    error
+}
+
+func (e *ElementError) Error() string {
+	return fmt.Sprintf("jstream: element %d at offset %d: %v", e.Index, e.Offset, e.Err)
+}
+
+func (e *ElementError) Unwrap() error { return e.Err }
+
+const (
+	batchValues = 256     // max elements decoded together by StreamParallel
+	batchBytes  = 1 << 16 // size beyond which a batch is not extended
+)
+
+var errMisaligned = errors.New("jstream: element decoded with unexpected bounds")
+
+// parallelBatch is a run of consecutive elements of a top-level array to
+// be decoded together by a StreamParallel worker
+type parallelBatch struct {
+	values []*MetaValue // positions of the elements, completed by the worker
+	raw    []byte       // the elements' bytes, each followed by a newline
+	starts []int        // offset of each element within raw
+	n      int          // number of elements decoded, preceding any error
+	err    error
+	ready  chan struct{} // closed once decoded
+}
+
+// Ordered makes StreamParallel deliver elements in the order of the
+// input, rather than as soon as each is decoded. An element that is slow
+// to decode then holds back those following it.
+func (d *Decoder) Ordered() *Decoder {
+	d.ordered = true
+	return d
+}
+
+// StreamParallel is like Stream, but decodes the elements of top-level
+// arrays on the given number of worker goroutines, for an emit depth of
+// 1. The input is split into elements by balancing brackets and quotes
+// only, each then decoded in full by a worker with the Decoder's options
+// for strings, numbers, grammar and objects, as by DecodeValueAt;
+// filters and other options selecting values do not apply. Elements are
+// delivered as they are decoded unless Ordered is set. Decoding stops at
+// the first element that fails to decode, with Err reporting an
+// ElementError, or at the first top-level value that is not an array. It
+// panics if workers is less than 1.
+func (d *Decoder) StreamParallel(workers int) <-chan *MetaValue {
+	if workers < 1 {
+		panic("jstream: invalid StreamParallel workers")
+	}
+	if d.emitDepth != 1 || d.emitRecursive || d.comments || d.holdsDocuments() {
+		d.err = errParallelMode
+		close(d.metaCh)
+		close(d.finished)
+		return d.metaCh
+	}
+
+	var (
+		jobs     = make(chan *parallelBatch, workers)
+		pending  = make(chan *parallelBatch, cap(d.metaCh)/batchValues+workers) // in input order
+		results  = make(chan *parallelBatch, workers)
+		splitErr error
+		wg       sync.WaitGroup
+	)
+
+	go func() {
+		splitErr = d.readErr(d.split(func(b *parallelBatch) error {
+			b.ready = make(chan struct{})
+			if d.ordered {
+				select {
+				case pending <- b:
+				case <-d.done:
+					return d.abortErr
+				}
+			}
+			select {
+			case jobs <- b:
+				return nil
+			case <-d.done:
+				return d.abortErr
+			}
+		}))
+		d.Scanner.Close()
+		close(jobs)
+		close(pending)
+	}()
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			v := d.batchDecoder()
+			for b := range jobs {
+				d.decodeBatch(v, b)
+				close(b.ready)
+				if d.ordered {
+					continue
+				}
+				select {
+				case results <- b:
+				case <-d.done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	go func() {
+		batches := results
+		if d.ordered {
+			batches = pending
+		}
+	deliver:
+		for b := range batches {
+			select {
+			case <-b.ready:
+			case <-d.done:
+				break deliver
+			}
+			for _, mv := range b.values[:b.n] {
+				if !d.sendParallel(mv) {
+					break deliver
+				}
+			}
+			if b.err != nil {
+				d.abort(b.err)
+				break
+			}
+		}
+		// once aborted, wait for the splitter and workers to stop
+		wg.Wait()
+		for range pending {
+		}
+		atomic.StoreInt64(&d.values, d.emitted)
+
+		select {
+		case <-d.done:
+			if d.err = d.abortErr; d.err == errStop {
+				d.err = nil
+			}
+		default:
+			d.err = splitErr
+		}
+		close(d.metaCh)
+		close(d.finished)
+	}()
+	return d.metaCh
+}
+
+// sendParallel delivers a value decoded by StreamParallel, reporting
+// false if decoding has been aborted
+func (d *Decoder) sendParallel(mv *MetaValue) bool {
+	select {
+	case <-d.done:
+		return false
+	default:
+	}
+	if d.onEmit != nil {
+		if mv = d.onEmit(mv); mv == nil {
+			return true
+		}
+	}
+	stop := d.stopFn != nil && d.stopFn(mv)
+	select {
+	case d.metaCh <- mv:
+		d.emitted++
+		if d.emitted == d.limit || stop {
+			d.abort(errStop)
+			return false
+		}
+		return true
+	case <-d.done:
+		return false
+	}
+}
+
+// batchDecoder creates a Decoder with d's options for decoding values, to
+// be reused by a StreamParallel worker for each batch. It reads from
+// memory on the calling goroutine, the batches being already transcoded.
+func (d *Decoder) batchDecoder() *Decoder {
+	v := &Decoder{
+		input:   &transcoder{enc: encUTF8},
+		Scanner: scanner.NewBytes(nil, 0),
+		emitMax: math.MaxInt,
+		scratch: &data.Scratch{Data: make([]byte, scratchSize)},
+		done:    make(chan struct{}),
+	}
+	d.valueOptions(v)
+	v.poolValues = true // the values are moved to those split
+	return v
+}
+
+// decodeBytes decodes b, which begins at offset of the input, with a
+// Decoder created by batchDecoder, calling fn with each value
+func (d *Decoder) decodeBytes(b []byte, offset int64, fn func(*MetaValue) error) error {
+	d.Scanner.Reset(b, offset)
+	d.lineNo, d.lineStart = 0, offset
+	d.depth, d.parents, d.sizes = 0, d.parents[:0], d.sizes[:0]
+	d.spaceErr = nil
+	d.emitFn = fn
+	return d.decode()
+}
+
+// decodeBatch decodes the elements of a batch split by StreamParallel
+// with v, created by batchDecoder, as a sequence of top-level values.
+// Should that fail, the elements are decoded one at a time from the first
+// not decoded, to find the element at fault.
+func (d *Decoder) decodeBatch(v *Decoder, b *parallelBatch) {
+	v.singleDoc = false
+	err := v.decodeBytes(b.raw, 0, func(mv *MetaValue) error {
+		end := len(b.raw)
+		if b.n+1 < len(b.starts) {
+			end = b.starts[b.n+1]
+		}
+		if b.n == len(b.values) || mv.Offset != int64(b.starts[b.n]) || mv.Offset+mv.Length != int64(end-1) {
+			return errMisaligned
+		}
+		b.values[b.n].Value = mv.Value
+		b.values[b.n].ValueType = mv.ValueType
+		b.n++
+		v.Release(mv)
+		return nil
+	})
+	if err == nil && b.n == len(b.values) {
+		return
+	}
+
+	v.singleDoc = true
+	for ; b.n < len(b.values); b.n++ {
+		mv := b.values[b.n]
+		end := len(b.raw)
+		if b.n+1 < len(b.starts) {
+			end = b.starts[b.n+1]
+		}
+		var value *MetaValue
+		err := v.decodeBytes(b.raw[b.starts[b.n]:end-1], mv.Offset, func(got *MetaValue) error {
+			value = got
+			return nil
+		})
+		if err == nil && value == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			b.err = &ElementError{Offset: mv.Offset, Index: mv.Index, Err: err}
+			return
+		}
+		mv.Value = value.Value
+		mv.ValueType = value.ValueType
+	}
+}
+
+// split scans the top-level arrays of the input, passing batches of the
+// raw bytes and positions of their elements to enqueue
+func (d *Decoder) split(enqueue func(*parallelBatch) error) error {
+	newBatch := func() *parallelBatch {
+		return &parallelBatch{
+			values: make([]*MetaValue, 0, batchValues),
+			starts: make([]int, 0, batchValues),
+		}
+	}
+	b := newBatch()
+	flush := func() error {
+		if len(b.values) == 0 {
+			return nil
+		}
+		err := enqueue(b)
+		b = newBatch()
+		return err
+	}
+
+	for {
+		if c := d.skipDocSpaces(); c == 0 && d.EOF() {
+			return flush()
+		}
+		atomic.AddInt64(&d.documents, 1)
+		if d.Cur() != '[' {
+			err := d.mkError(internal.ErrSyntax, "looking for beginning of top-level array")
+			if ferr := flush(); ferr != nil {
+				return ferr
+			}
+			return err
+		}
+		parent := d.offset()
+		if c := d.skipSpaces(); c == ']' {
+			continue
+		}
+
+	scan:
+		for i := 0; ; i++ {
+			mv := d.newMetaValue(MetaValue{
+				Offset:       d.offset(),
+				Line:         d.lineNo + 1,
+				Depth:        1,
+				Keys:         []string{""},
+				Index:        i,
+				ParentOffset: parent,
+			})
+			if d.indexedKeys {
+				mv.Keys[0] = strconv.Itoa(i)
+			}
+			d.StartCapture()
+			if err := d.skipSpan(); err != nil {
+				d.Captured()
+				if ferr := flush(); ferr != nil {
+					return ferr
+				}
+				return err
+			}
+			mv.Length = d.end() - mv.Offset
+			b.values = append(b.values, mv)
+			b.starts = append(b.starts, len(b.raw))
+			b.raw = append(append(b.raw, d.Captured()...), '\n')
+			if len(b.values) == batchValues || len(b.raw) >= batchBytes {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+
+			switch c := d.skipSpaces(); c {
+			case ',':
+				if c = d.skipSpaces(); c == ']' && d.trailingComma {
+					break scan
+				}
+			case ']':
+				break scan
+			default:
+				err := d.mkError(internal.ErrSyntax, "after array element")
+				if c == 0 && d.EOF() {
+					err = d.mkError(internal.ErrUnexpectedEOF)
+				}
+				if ferr := flush(); ferr != nil {
+					return ferr
+				}
+				return err
+			}
+		}
+	}
+}
+
+// skipSpan advances to the last byte of the value beginning at the
+// current position by balancing brackets and quotes, without otherwise
+// checking its structure
+func (d *Decoder) skipSpan() error {
+	c := d.Cur()
+	if c != '[' && c != '{' && c != '"' && (c != '\'' || !d.relaxed) {
+		// scalars end at the following delimiter
+		for {
+			switch c = d.Next(); c {
+			case ',', ']', '}', ' ', '\t', '\r', '\n', 0:
+				d.Back()
+				return nil
+			}
+		}
+	}
+
+	var depth int
+	for {
+		switch c {
+		case '"', '\'':
+			if c == '\'' && !d.relaxed {
+				break
+			}
+			for q := c; ; {
+				if c = d.Next(); c == q {
+					break
+				}
+				if c == '\\' {
+					c = d.Next()
+				}
+				if c == 0 && d.EOF() {
+					return d.mkError(internal.ErrUnexpectedEOF)
+				}
+			}
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case '\n', '\r':
+			if c == '\n' || d.Peek() != '\n' {
+				d.lineStart = d.Pos
+				d.lineNo++
+			}
+		case 0:
+			if d.EOF() {
+				return d.mkError(internal.ErrUnexpectedEOF)
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+		c = d.Next()
+	}
+}
@@ -0,0 +1,98 @@
+package jstream
+
+import (
+	"math"
+	"strings"
+)
+
+var (
+	pathEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pathUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// FormatPath formats the Keys of a value as a JSON Pointer (RFC 6901),
+// e.g. ["a", "0", "b/c"] as "/a/0/b~1c". Keys recorded with IndexedKeys
+// address a single value within a document, which can be decoded again
+// with FilterPath.
+func FormatPath(keys []string) string {
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteByte('/')
+		pathEscaper.WriteString(&sb, k)
+	}
+	return sb.String()
+}
+
+// ParsePath parses a JSON Pointer as formatted by FormatPath into Keys.
+// The empty string addresses a whole document; the leading "/" is
+// optional for non-empty paths.
+func ParsePath(path string) []string {
+	if path == "" {
+		return []string{}
+	}
+	keys := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, k := range keys {
+		if strings.IndexByte(k, '~') >= 0 {
+			keys[i] = pathUnescaper.Replace(k)
+		}
+	}
+	return keys
+}
+
+// FilterPath restricts decoding to the value at the given Keys in each
+// document, as recorded with IndexedKeys, emitting it alone; all other
+// values along the way are skipped without being decoded. It sets the
+// emit depth to len(path) and enables IndexedKeys.
+func (d *Decoder) FilterPath(path []string) *Decoder {
+	d.filterPath = path
+	d.emitDepth = len(path)
+	d.emitRecursive = false
+	d.indexedKeys = true
+	return d
+}
+
+// onPath reports whether the value with the given last Keys segment, at
+// the current depth, lies on the path set by FilterPath
+func (d *Decoder) onPath(k string) bool {
+	return d.filterPath == nil || d.depth > len(d.filterPath) || d.filterPath[d.depth-1] == k
+}
+
+// EmitUnder emits the children of the value of each object member with
+// the given key, at whatever depth it is found, such as for a payload
+// nested differently across versions of an API: the elements of an array
+// or members of an object are emitted as if the emit depth were theirs,
+// after which decoding resumes as before. No other values are emitted,
+// and EmitDepth then reports math.MaxInt. Where the key is found again
+// within such a value, its children are emitted too if nested is set,
+// and otherwise decoded as any other value. It disables Recursive.
+func (d *Decoder) EmitUnder(key string, nested bool) *Decoder {
+	d.under = true
+	d.underKey = key
+	d.underNested = nested
+	d.emitDepth = math.MaxInt
+	d.emitRecursive = false
+	return d
+}
+
+// enterUnder begins emitting the children of the value of the member with
+// key k, at the current depth, if selected by EmitUnder, returning the emit
+// depth to restore by exitUnder once the value is decoded, or -1
+func (d *Decoder) enterUnder(k string) int {
+	if k != d.underKey || d.underDepth != 0 && !d.underNested {
+		return -1
+	}
+	restore := d.emitDepth
+	d.emitDepth = d.depth + 1
+	if d.underDepth == 0 {
+		d.underDepth = d.emitDepth
+	}
+	return restore
+}
+
+// exitUnder ends emitting the children of a value, as begun by enterUnder
+func (d *Decoder) exitUnder(restore int) {
+	d.emitDepth = restore
+	if d.underDepth == d.depth+1 {
+		d.underDepth = 0
+	}
+}
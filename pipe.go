@@ -0,0 +1,82 @@
+package jstream
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+var errPipeMode = errors.New("jstream: WriteTo does not support Recursive or DedupWindow")
+
+// WriteTo decodes the input, writing the original bytes of each value at
+// the emit depth to w, each followed by a newline, such as to convert a
+// large array into newline-delimited JSON. Values are copied exactly as
+// they appear in the input, without being decoded, so the formatting of
+// numbers and escaping of strings is preserved. Key filters, SkipIf and
+// the other options selecting values apply as with Stream; with EmitKV,
+// members are written as objects with "key" and "value" members, as by
+// Encoder. It returns the number of bytes written, and may not be
+// combined with Stream or Walk.
+func (d *Decoder) WriteTo(w io.Writer) (int64, error) {
+	if d.emitRecursive || d.dedup != nil {
+		return 0, errPipeMode
+	}
+	d.raw = true
+
+	var (
+		n   int64
+		buf []byte
+	)
+	err := d.Walk(func(mv *MetaValue) error {
+		buf = buf[:0]
+		switch v := mv.Value.(type) {
+		case json.RawMessage:
+			buf = append(buf, v...)
+		case KV:
+			buf = append(buf, `{"key":`...)
+			if d.rawStrings {
+				buf = append(append(append(buf, '"'), v.Key...), '"')
+			} else {
+				buf = appendString(buf, v.Key)
+			}
+			buf = append(buf, `,"value":`...)
+			buf = append(buf, v.Value.(json.RawMessage)...)
+			buf = append(buf, '}')
+		}
+		buf = append(buf, '\n')
+		m, err := w.Write(buf)
+		n += int64(m)
+		return err
+	})
+	return n, err
+}
+
+// rawValue returns the bytes of the value beginning at the current
+// position, for WriteTo's raw mode
+func (d *Decoder) rawValue() (interface{}, ValueType, error) {
+	t := rawType(d.Cur())
+	d.StartCapture()
+	err := d.skip()
+	raw := json.RawMessage(d.Captured())
+	if d.ndjson || d.jsonSeq { // held beyond the next capture
+		raw = append(json.RawMessage(nil), raw...)
+	}
+	return raw, t, err
+}
+
+// rawType returns the type of the value beginning with c, assumed valid
+func rawType(c byte) ValueType {
+	switch c {
+	case '"', '\'':
+		return String
+	case '[':
+		return Array
+	case '{':
+		return Object
+	case 't', 'f':
+		return Boolean
+	case 'n':
+		return Null
+	}
+	return Number
+}
@@ -0,0 +1,42 @@
+package jstream
+
+import "sync"
+
+// metaValuePool holds MetaValues released by consumers, shared by all
+// decoders with PoolMetaValues
+var metaValuePool = sync.Pool{New: func() interface{} { return new(MetaValue) }}
+
+// PoolMetaValues takes the MetaValues emitted from a pool, to which
+// consumers return them with Release once done with each, reducing the
+// allocations of decoding large inputs. A released MetaValue must not be
+// used or retained, including its Keys and Value, as it is reused for
+// another value. Values are not pooled with subscribers, who share them.
+func (d *Decoder) PoolMetaValues() *Decoder {
+	d.poolValues = true
+	return d
+}
+
+// Release returns mv, emitted by a Decoder with PoolMetaValues, to the
+// pool for reuse, after which it must not be used. mv may be released from
+// any goroutine, such as that receiving from Stream, or from within a Walk
+// callback once done with it.
+func (d *Decoder) Release(mv *MetaValue) {
+	if mv == nil || !d.poolValues || d.subscribers != nil {
+		return
+	}
+	*mv = MetaValue{}
+	metaValuePool.Put(mv)
+}
+
+// newMetaValue returns a copy of v to emit, allocated from the pool with
+// PoolMetaValues
+func (d *Decoder) newMetaValue(v MetaValue) *MetaValue {
+	var mv *MetaValue
+	if d.poolValues && d.subscribers == nil {
+		mv = metaValuePool.Get().(*MetaValue)
+	} else {
+		mv = new(MetaValue)
+	}
+	*mv = v
+	return mv
+}
@@ -0,0 +1,79 @@
+package jstream
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotReaderAt is returned by DecodeValueAt for Decoders not created
+// from an io.ReaderAt
+var ErrNotReaderAt = errors.New("jstream: decoder does not read from an io.ReaderAt")
+
+// NewDecoderReaderAt creates a Decoder reading the first size bytes of r,
+// as NewDecoder would, which can also decode individual values at known
+// offsets with DecodeValueAt
+func NewDecoderReaderAt(r io.ReaderAt, size int64, emitDepth int) *Decoder {
+	d := newDecoder(io.NewSectionReader(r, 0, size), 0, emitDepth)
+	d.readerAt = r
+	return d
+}
+
+// DecodeValueAt decodes the single value spanning length bytes at offset
+// in the io.ReaderAt of a Decoder created by NewDecoderReaderAt or
+// NewDecoderAt, such as the Offset and Length of a value emitted by
+// earlier decoding, reading only that range. The value is decoded as a
+// whole with the Decoder's options for strings, numbers, grammar and
+// objects; emit depth, filters and other options selecting values do not
+// apply. The returned MetaValue has the given Offset and Length, with
+// Depth, Keys and Line relative to the value. An error reading the range
+// from the io.ReaderAt is returned as is. It does not affect the
+// Decoder's own decoding, and is safe to call concurrently with it.
+func (d *Decoder) DecodeValueAt(offset, length int64) (*MetaValue, error) {
+	if d.readerAt == nil {
+		return nil, ErrNotReaderAt
+	}
+	values, err := d.valueDecoder(io.NewSectionReader(d.readerAt, offset, length), offset).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return values[0], nil
+}
+
+// valueDecoder creates a Decoder for the single value read from r, which
+// begins at offset, with d's options for decoding values
+func (d *Decoder) valueDecoder(r io.Reader, offset int64) *Decoder {
+	v := newDecoder(r, offset, 0)
+	d.valueOptions(v)
+	return v
+}
+
+// valueOptions sets the options of v for decoding single values to d's
+func (d *Decoder) valueOptions(v *Decoder) {
+	v.singleDoc = true
+	v.objectAsKVS = d.objectAsKVS
+	v.indexedKeys = d.indexedKeys
+	v.validateUTF8 = d.validateUTF8
+	v.replaceUTF8 = d.replaceUTF8
+	v.strictUnicode = d.strictUnicode
+	v.strict = d.strict
+	v.strictEscapes = d.strictEscapes
+	v.relaxed = d.relaxed
+	v.lenient = d.lenient
+	v.rawStrings = d.rawStrings
+	// values outlive v, so strings are always copied, as with Stream
+	v.stringsAsBytes = d.stringsAsBytes
+	if d.interned != nil {
+		// d's keys are not shared, as v may run concurrently with d
+		v.interned = make(map[string]string)
+	}
+	v.comments = d.comments
+	v.trailingComma = d.trailingComma
+	v.nonFinite = d.nonFinite
+	v.numberFn = d.numberFn
+	v.bigInt = d.bigInt
+	v.maxNumLen = d.maxNumLen
+	v.hooks = d.hooks
+}
@@ -0,0 +1,53 @@
+package jstream
+
+import "github.com/xenking/jstream/internal"
+
+// Relaxed enables parsing of a more lenient grammar, as commonly found in
+// hand-written configuration files: strings may be enclosed in single
+// quotes, object keys may be unquoted identifiers, and integers may be
+// written in hexadecimal with a 0x prefix. Values are emitted exactly as
+// their strict JSON equivalents would be.
+func (d *Decoder) Relaxed() *Decoder {
+	d.relaxed = true
+	return d
+}
+
+// scanKey reads an object key beginning at the current position into the
+// scratch buffer
+func (d *Decoder) scanKey() error {
+	switch c := d.Cur(); {
+	case c == '"', c == '\'' && d.relaxed:
+		return d.scanString()
+	case isIdentStart(c) && d.relaxed:
+		// unquoted identifier; stop on its last byte, as on a closing quote
+		d.scratch.Reset()
+		for ; isIdentStart(c) || (c >= '0' && c <= '9'); c = d.Next() {
+			d.scratch.Add(c)
+		}
+		d.Back()
+		return nil
+	}
+	return d.mkError(internal.ErrSyntax, "looking for beginning of object key string")
+}
+
+// isIdentStart reports whether c may begin an unquoted key
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$'
+}
+
+// scanHex reads the digits of a hexadecimal integer literal following 0x,
+// writing the literal to the scratch buffer
+func (d *Decoder) scanHex() error {
+	d.scratch.Add('x')
+	c, n := d.Next(), 0
+	for ; isHex(c); c, n = d.Next(), n+1 {
+		if err := d.addDigit(c); err != nil {
+			return err
+		}
+	}
+	if n == 0 {
+		return d.mkError(internal.ErrSyntax, "in hexadecimal numeric literal")
+	}
+	d.Back()
+	return nil
+}
@@ -0,0 +1,133 @@
+package jstream
+
+import "github.com/xenking/jstream/internal"
+
+// KeyInfo describes the values found at a path by ScanKeys
+type KeyInfo struct {
+	// Path holds the keys of the values, as for MetaValue.Keys, with ""
+	// for the elements of arrays at any index
+	Path      []string
+	ValueType ValueType
+	// Count is the number of values of ValueType found at Path
+	Count int
+}
+
+// ScanKeys reads the remainder of the input, reporting each distinct path
+// of the values within its documents along with their type, such as to
+// discover the shape of an unfamiliar input: a path holding values of
+// several types is reported once per type. Paths are reported once the
+// input is scanned, in the order first found. Values nested more than
+// maxDepth keys deep are skipped, unless maxDepth is negative. The
+// structure of the input is checked, strings included, as by Split, but
+// no values are built; the emit depth, Recursive and filters do not apply.
+// On error, reported by Err, the paths found before it are reported. It
+// must not be combined with other methods reading the input.
+func (d *Decoder) ScanKeys(maxDepth int) <-chan KeyInfo {
+	infos := make(chan KeyInfo, cap(d.metaCh))
+	go func() {
+		var (
+			found []KeyInfo
+			seen  = make(map[string]int) // index in found by path and type
+		)
+		record := func(keys []string, t ValueType) {
+			id := FormatPath(keys) + "#" + t.String()
+			if i, ok := seen[id]; ok {
+				found[i].Count++
+				return
+			}
+			seen[id] = len(found)
+			found = append(found, KeyInfo{Path: append([]string(nil), keys...), ValueType: t, Count: 1})
+		}
+		for {
+			if c := d.skipDocSpaces(); c == 0 && d.EOF() {
+				d.err = d.spaceErr
+				break
+			}
+			if d.err = d.scanPaths([]string{}, maxDepth, record); d.err != nil {
+				break
+			}
+		}
+		d.err = d.readErr(d.err)
+		d.Scanner.Close()
+		d.Publish()
+
+	send:
+		for _, info := range found {
+			select {
+			case infos <- info:
+			case <-d.done:
+				break send
+			}
+		}
+		close(infos)
+		close(d.finished)
+	}()
+	return infos
+}
+
+// scanPaths calls found with the keys and type of each value within the
+// value beginning at the current position, with keys, up to maxDepth keys
+// deep, and advances past it
+func (d *Decoder) scanPaths(keys []string, maxDepth int, found func(keys []string, t ValueType)) error {
+	c := d.Cur()
+	if c != '[' && c != '{' || maxDepth >= 0 && len(keys) >= maxDepth {
+		return d.skip()
+	}
+
+	if c == '[' {
+		keys = append(keys[:len(keys):len(keys)], "")
+		if c = d.skipSpaces(); c == ']' {
+			return nil
+		}
+		for {
+			if d.EOF() {
+				return d.mkError(internal.ErrUnexpectedEOF)
+			}
+			found(keys, rawType(d.Cur()))
+			if err := d.scanPaths(keys, maxDepth, found); err != nil {
+				return err
+			}
+			switch c = d.skipSpaces(); c {
+			case ',':
+				if c = d.skipSpaces(); c == ']' && d.trailingComma {
+					return nil
+				}
+			case ']':
+				return nil
+			default:
+				return d.mkError(internal.ErrSyntax, "after array element")
+			}
+		}
+	}
+
+	if c = d.skipSpaces(); c == '}' {
+		return nil
+	}
+	for {
+		if err := d.scanKey(); err != nil {
+			return err
+		}
+		k := d.key()
+		if c = d.skipSpaces(); c != ':' {
+			return d.mkError(internal.ErrSyntax, "after object key")
+		}
+		if d.skipSpaces(); d.EOF() {
+			return d.mkError(internal.ErrUnexpectedEOF)
+		}
+		member := append(keys[:len(keys):len(keys)], k)
+		found(member, rawType(d.Cur()))
+		if err := d.scanPaths(member, maxDepth, found); err != nil {
+			return err
+		}
+		switch c = d.skipSpaces(); c {
+		case ',':
+			if c = d.skipSpaces(); c == '}' && d.trailingComma {
+				return nil
+			}
+		case '}':
+			return nil
+		default:
+			return d.mkError(internal.ErrSyntax, pairContext(k))
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package jstream
+
+import (
+	"fmt"
+
+	"github.com/xenking/jstream/internal"
+)
+
+// recordSeparator precedes each document of a JSON text sequence
+const recordSeparator = 0x1E
+
+// InvalidRecordError is reported to the OnWarning callback for each record
+// of a JSON text sequence skipped by JSONSeq
+type InvalidRecordError struct {
+	Offset int64 // byte offset of the skipped record's content
+	Length int64
+	Err    error // the error which invalidated the record
+}
+
+func (e *InvalidRecordError) Error() string {
+	return fmt.Sprintf("jstream: skipped invalid record at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *InvalidRecordError) Unwrap() error { return e.Err }
+
+// JSONSeq decodes the input as a JSON text sequence, as defined by RFC
+// 7464 (application/json-seq): documents are delimited by the ASCII
+// record separator 0x1E, and each record must hold a single document.
+// A top-level number must be followed by whitespace, as otherwise it may
+// have been truncated. The values of a document are emitted only once
+// its record is complete. If skipInvalid is true, records that fail to
+// decode, such as those truncated by a following record separator, are
+// skipped as the RFC recommends, and reported to the OnWarning callback
+// as an InvalidRecordError; otherwise decoding fails at the first one.
+func (d *Decoder) JSONSeq(skipInvalid bool) *Decoder {
+	d.jsonSeq = true
+	d.skipInvalid = skipInvalid
+	return d
+}
+
+// endRecord consumes the whitespace following a top-level value v in a
+// JSON text sequence, which must be followed by the next record or the
+// end of input
+func (d *Decoder) endRecord(v interface{}) error {
+	switch v.(type) {
+	case int64, float64:
+		switch d.Peek() {
+		case ' ', '\t', '\r', '\n':
+		default:
+			d.Next()
+			return d.mkError(internal.ErrSyntax, "after number in JSON text sequence")
+		}
+	}
+
+	if d.peekNonSpace() == recordSeparator {
+		return nil
+	}
+	if c := d.Next(); c == 0 && d.EOF() {
+		return nil
+	}
+	return d.mkError(internal.ErrSyntax, "after top-level value")
+}
+
+// skipRecord reports err for the record whose document began at offset,
+// and skips the remainder of the record
+func (d *Decoder) skipRecord(offset int64, err error) {
+	d.depth = 0
+	d.parents = d.parents[:0]
+	d.held = d.held[:0]
+	d.spaceErr = nil
+
+	for c := d.Cur(); c != recordSeparator; c = d.Next() {
+		if c == 0 && d.EOF() {
+			break
+		}
+		if c == '\n' && d.lineStart != d.Pos {
+			d.lineStart = d.Pos
+			d.lineNo++
+		}
+	}
+
+	if d.onWarning != nil {
+		end := d.offset() // of the following separator, or the end of input
+		d.onWarning(&InvalidRecordError{Offset: offset, Length: end - offset, Err: err})
+	}
+}
@@ -0,0 +1,151 @@
+package jstream
+
+import (
+	"io"
+
+	"github.com/xenking/jstream/internal"
+)
+
+// Segment is the byte range of a value found by Split
+type Segment struct {
+	// Offset is the byte offset of the first byte of the value, and
+	// Length the number of bytes it spans, as for MetaValue
+	Offset int64
+	Length int64
+	// Index is the position of the value within its enclosing array, or
+	// -1 if the value is not an array element
+	Index int
+	// FirstKey is the key of the first member of an object value, or ""
+	// for other values and empty objects
+	FirstKey string
+}
+
+// Split scans the input for the values at emitDepth, returning the byte
+// range of each, such as to divide a large array among workers that each
+// decode their share of segments with NewDecoderAt. The structure of the
+// input is checked, strings included, but no values are built. On error,
+// the segments found before it are returned. It panics if emitDepth is
+// negative.
+func Split(r io.Reader, emitDepth int) ([]Segment, error) {
+	if emitDepth < 0 {
+		panic("jstream: negative Split depth")
+	}
+	d := NewDecoder(r, emitDepth)
+	defer d.Scanner.Stop() // r may be closed once Split returns
+
+	var segs []Segment
+	err := d.scanDocuments(func(index int) error {
+		seg := Segment{Offset: d.offset(), Index: index}
+		var err error
+		if d.Cur() != '{' {
+			err = d.skip()
+		} else if c := d.skipSpaces(); c != '}' {
+			if err = d.scanKey(); err == nil {
+				seg.FirstKey = d.key()
+				err = d.skipMembers()
+			}
+		}
+		if err != nil {
+			return err
+		}
+		seg.Length = d.end() - seg.Offset
+		segs = append(segs, seg)
+		return nil
+	})
+	return segs, d.readErr(err)
+}
+
+// CountValues reads the remainder of the input, returning the number of
+// values at the emit depth, such as to validate the input or size a
+// buffer for its values cheaply. The structure of the input is checked,
+// strings included, as by Split, but no values are built. Values at
+// greater depths are not counted, even with Recursive, and filters do not
+// apply. On error, the values counted before it are returned. It must not
+// be combined with other methods reading the input.
+func (d *Decoder) CountValues() (int, error) {
+	defer d.Scanner.Close()
+	var n int
+	err := d.scanDocuments(func(int) error {
+		if err := d.skip(); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	d.Publish()
+	return n, d.readErr(err)
+}
+
+// scanDocuments scans the documents remaining in the input, calling found
+// with the index of each value at the emit depth within them, as for
+// MetaValue; found must advance past the value at the current position
+func (d *Decoder) scanDocuments(found func(index int) error) error {
+	for {
+		if c := d.skipDocSpaces(); c == 0 && d.EOF() {
+			return d.spaceErr
+		}
+		if err := d.scanValues(-1, found); err != nil {
+			return err
+		}
+	}
+}
+
+// scanValues calls found with each value at the emit depth within the
+// value beginning at the current position, which is the element at index
+// of its enclosing array, or -1
+func (d *Decoder) scanValues(index int, found func(index int) error) error {
+	if d.EOF() {
+		return d.mkError(internal.ErrUnexpectedEOF)
+	}
+	if d.depth == d.emitDepth {
+		return found(index)
+	}
+
+	switch c := d.Cur(); c {
+	case '[':
+		d.depth++
+		if c = d.skipSpaces(); c == ']' {
+			break
+		}
+		for i := 0; ; i++ {
+			if err := d.scanValues(i, found); err != nil {
+				return err
+			}
+			if c = d.skipSpaces(); c == ']' {
+				break
+			}
+			if c != ',' {
+				return d.mkError(internal.ErrSyntax, "after array element")
+			}
+			d.skipSpaces()
+		}
+	case '{':
+		d.depth++
+		if c = d.skipSpaces(); c == '}' {
+			break
+		}
+		for {
+			if err := d.scanKey(); err != nil {
+				return err
+			}
+			if c = d.skipSpaces(); c != ':' {
+				return d.mkError(internal.ErrSyntax, "after object key")
+			}
+			d.skipSpaces()
+			if err := d.scanValues(-1, found); err != nil {
+				return err
+			}
+			if c = d.skipSpaces(); c == '}' {
+				break
+			}
+			if c != ',' {
+				return d.mkError(internal.ErrSyntax, "after object key:value pair")
+			}
+			d.skipSpaces()
+		}
+	default:
+		return d.skip()
+	}
+	d.depth--
+	return nil
+}
@@ -0,0 +1,75 @@
+package jstream
+
+import "sync/atomic"
+
+// SlowSubscriberPolicy determines how values are delivered to subscribers
+// registered with Subscribe whose channels are full
+type SlowSubscriberPolicy int
+
+const (
+	// BlockSlowSubscribers waits for each subscriber to receive every
+	// value, such that the slowest subscriber paces decoding
+	BlockSlowSubscribers SlowSubscriberPolicy = iota
+	// DropSlowSubscribers skips delivery of a value to subscribers whose
+	// channels are full, counting each value dropped in Stats
+	DropSlowSubscribers
+)
+
+// Subscribe registers a channel, with capacity buffer, receiving each
+// value emitted by Stream, Walk, ReadAll or Run, such as to share a single
+// decoding pass of a network stream among independent consumers. Each
+// value is delivered to every subscriber, which must not modify it, as
+// determined by the SlowSubscribers policy. Subscribers must be
+// registered before decoding begins. The channels of all subscribers are
+// closed once decoding ends, after which Err reports the outcome. It
+// panics if buffer is negative.
+func (d *Decoder) Subscribe(buffer int) <-chan *MetaValue {
+	if buffer < 0 {
+		panic("jstream: negative Subscribe buffer")
+	}
+	d.unsafeStrings = false // values outlive the emit
+	ch := make(chan *MetaValue, buffer)
+	d.subscribers = append(d.subscribers, ch)
+	return ch
+}
+
+// SlowSubscribers sets the policy for delivering values to subscribers
+// whose channels are full, BlockSlowSubscribers by default
+func (d *Decoder) SlowSubscribers(p SlowSubscriberPolicy) *Decoder {
+	d.slowPolicy = p
+	return d
+}
+
+// Run decodes the input synchronously, as by Walk, delivering values to
+// subscribers only, and returns Err
+func (d *Decoder) Run() error {
+	return d.Walk(func(*MetaValue) error { return nil })
+}
+
+// publish delivers mv to each subscriber
+func (d *Decoder) publish(mv *MetaValue) error {
+	for _, ch := range d.subscribers {
+		if d.slowPolicy == DropSlowSubscribers {
+			select {
+			case ch <- mv:
+			default:
+				atomic.AddInt64(&d.dropped, 1)
+			}
+			continue
+		}
+		select {
+		case ch <- mv:
+		case <-d.done:
+			return d.abortErr
+		}
+	}
+	return nil
+}
+
+// closeSubscribers closes the channels of all subscribers once decoding
+// has ended
+func (d *Decoder) closeSubscribers() {
+	for _, ch := range d.subscribers {
+		close(ch)
+	}
+}
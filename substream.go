@@ -0,0 +1,432 @@
+package jstream
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/xenking/jstream/internal"
+)
+
+// StreamUnmarshaler is the interface implemented by types that can fill
+// themselves from the elements of a JSON array or object as they are
+// decoded, without the container ever being materialized. It is the
+// streaming counterpart of json.Unmarshaler.
+type StreamUnmarshaler interface {
+	UnmarshalJStream(s *SubStream) error
+}
+
+var (
+	errNotContainer  = errors.New("jstream: StreamUnmarshaler requires an array or object value")
+	errSubStreamBusy = errors.New("jstream: sub-stream read while a nested value is being decoded")
+	errTokenPending  = errors.New("jstream: Token called before the previous value was read")
+	errFramesOpen    = errors.New("jstream: DecodeFull called within a container opened by DecodeNext")
+)
+
+// SubStream provides sequential access to the elements of a single JSON
+// array or object. It is scoped to its container: once the closing
+// delimiter has been reached every read returns io.EOF, and elements
+// left unread when UnmarshalJStream returns are skipped.
+type SubStream struct {
+	d       *Decoder
+	keys    []string // keys of the container itself
+	delim   byte     // closing delimiter of the container
+	n       int      // number of elements started
+	key     string   // key of the current object member
+	pending bool     // value of the current element is still unread
+	busy    bool     // a nested value is being decoded
+	done    bool
+	err     error
+
+	// closed once the container is read, or fails, for a Decoder with
+	// EmitSubStreams waiting to proceed
+	release  chan struct{}
+	released bool
+}
+
+func newSubStream(d *Decoder, keys []string) *SubStream {
+	s := &SubStream{d: d, keys: keys, delim: ']'}
+	if d.Cur() == '{' {
+		s.delim = '}'
+	}
+	d.depth++
+	return s
+}
+
+// Keys returns the keys of the container this SubStream reads from
+func (s *SubStream) Keys() []string { return s.keys }
+
+// Key returns the key of the current object member. For arrays it
+// returns "", or the element index with IndexedKeys
+func (s *SubStream) Key() string { return s.key }
+
+// Token advances to the next element of the container and returns its
+// key for objects or its index for arrays, leaving the value to be read
+// by NextValue, SkipValue or Decode. io.EOF is returned once the
+// container is exhausted.
+func (s *SubStream) Token() (interface{}, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	if s.pending {
+		return nil, errTokenPending
+	}
+	if err := s.advance(); err != nil {
+		return nil, err
+	}
+	if s.delim == '}' {
+		return s.key, nil
+	}
+	return s.n - 1, nil
+}
+
+// NextValue decodes and returns the value of the next element
+func (s *SubStream) NextValue() (interface{}, error) {
+	if err := s.next(); err != nil {
+		return nil, err
+	}
+	v, _, err := s.d.any(s.elemKeys())
+	return v, s.fail(err)
+}
+
+// SkipValue advances past the value of the next element without
+// decoding it
+func (s *SubStream) SkipValue() error {
+	if err := s.next(); err != nil {
+		return err
+	}
+	return s.fail(s.d.skip())
+}
+
+// Decode reads the value of the next element into v; see DecodeNext
+func (s *SubStream) Decode(v interface{}) error {
+	if err := s.next(); err != nil {
+		return err
+	}
+	s.busy = true
+	err := s.d.decodeValue(v, s.elemKeys())
+	s.busy = false
+	return s.fail(err)
+}
+
+// check returns the error, if any, preventing further reads
+func (s *SubStream) check() error {
+	if s.busy {
+		return errSubStreamBusy
+	}
+	return s.err
+}
+
+// next positions the decoder at the unread value of the next element
+func (s *SubStream) next() error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	if !s.pending {
+		if err := s.advance(); err != nil {
+			return err
+		}
+	}
+	s.pending = false
+	return nil
+}
+
+// advance reads up to the beginning of the next element's value, or
+// through the closing delimiter of the container
+func (s *SubStream) advance() error {
+	if s.done {
+		return io.EOF
+	}
+	d := s.d
+
+	c := d.skipSpaces()
+	if s.n > 0 {
+		switch c {
+		case s.delim:
+			return s.close()
+		case ',':
+			if c = d.skipSpaces(); c == s.delim && d.trailingComma {
+				return s.close()
+			}
+		default:
+			if s.delim == ']' {
+				return s.fail(d.mkError(internal.ErrSyntax, "after array element"))
+			}
+			return s.fail(d.mkError(internal.ErrSyntax, pairContext(s.key)))
+		}
+	} else if c == s.delim {
+		return s.close()
+	}
+
+	if s.delim == ']' {
+		if s.d.indexedKeys {
+			s.key = strconv.Itoa(s.n)
+		}
+	} else {
+		if err := d.scanKey(); err != nil {
+			return s.fail(err)
+		}
+		k := d.key()
+		if c = d.skipSpaces(); c != ':' {
+			return s.fail(d.mkError(internal.ErrSyntax, "after object key"))
+		}
+		s.key = k
+		d.skipSpaces()
+	}
+
+	s.n++
+	s.pending = true
+	return nil
+}
+
+// Close skips the elements left unread through the end of the container,
+// returning any error found, such as to let a Decoder with EmitSubStreams
+// proceed past it. It may be called more than once.
+func (s *SubStream) Close() error {
+	err := s.drain()
+	if err != nil {
+		s.unblock()
+	}
+	return err
+}
+
+// close marks the container as exhausted
+func (s *SubStream) close() error {
+	s.done = true
+	s.d.depth--
+	s.unblock()
+	return io.EOF
+}
+
+// unblock lets a Decoder waiting for the container to be read proceed
+func (s *SubStream) unblock() {
+	if s.release != nil && !s.released {
+		s.released = true
+		close(s.release)
+	}
+}
+
+// drain skips all remaining elements through the end of the container
+func (s *SubStream) drain() error {
+	for {
+		if err := s.SkipValue(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// fail records a decoding error, after which the container can no
+// longer be read
+func (s *SubStream) fail(err error) error {
+	if _, ok := err.(internal.SyntaxError); ok {
+		s.err = err
+		s.unblock()
+	}
+	return err
+}
+
+// elemKeys returns the keys of the current element
+func (s *SubStream) elemKeys() []string {
+	return append(s.keys[:len(s.keys):len(s.keys)], s.key)
+}
+
+// EmitSubStreams emits each array and object at the emit depth before
+// decoding it, with a *SubStream as its Value through which its elements
+// are read as they are decoded, such that containers too large to hold in
+// memory may still be streamed; Length is then 0. Decoding proceeds past
+// the container once its elements are read or the SubStream is closed:
+// with Stream, the SubStream may be read from the receiving goroutine,
+// which must read or close it before receiving further values, and
+// before any call to Close; with Walk, it must be read within the
+// callback, once which returns the elements left unread are skipped. It
+// has no effect with EmitKV, Recursive, NDJSON, JSONSeq or DedupWindow,
+// nor on StreamParallel.
+func (d *Decoder) EmitSubStreams() *Decoder {
+	d.subStreams = true
+	return d
+}
+
+// emitsSubStream reports whether the value beginning at the current
+// position is emitted as a SubStream, as with EmitSubStreams
+func (d *Decoder) emitsSubStream() bool {
+	c := d.Cur()
+	return d.subStreams && (c == '[' || c == '{') && d.willEmit() &&
+		!d.emitRecursive && !d.holdsDocuments() && !d.raw && !d.offsetsOnly
+}
+
+// emitSubStream emits the container beginning at the current position as
+// a SubStream, with keys and the index within its enclosing array, then
+// advances past it once read
+func (d *Decoder) emitSubStream(keys []string, index int) error {
+	mv := d.newMetaValue(MetaValue{
+		Offset:       d.offset(),
+		Line:         d.lineNo + 1,
+		Depth:        d.depth,
+		Keys:         keys,
+		Index:        index,
+		ParentOffset: d.parent(),
+		ValueType:    rawType(d.Cur()),
+	})
+	s := newSubStream(d, keys)
+	s.release = make(chan struct{})
+	mv.Value = s
+	if err := d.emit(mv); err != nil {
+		return err
+	}
+	if d.async {
+		// the SubStream is read by the goroutine receiving from Stream
+		select {
+		case <-s.release:
+		case <-d.done:
+			return d.abortErr
+		}
+	}
+	return s.Close()
+}
+
+// DecodeNext reads the next value at the configured emit depth into v,
+// providing a synchronous alternative to Stream; the two must not be
+// combined on the same Decoder. EmitKV and Recursive do not apply.
+//
+// If v implements StreamUnmarshaler and the value is an array or object,
+// its UnmarshalJStream method is called with a SubStream over the
+// container's elements. Otherwise, if v is an *interface{} it is set to
+// the decoded value, and any other v is filled as by json.Unmarshal.
+// io.EOF is returned once the input is exhausted.
+func (d *Decoder) DecodeNext(v interface{}) (err error) {
+	defer d.Publish()
+	defer d.FlushTee()
+	defer func() {
+		if err != nil {
+			err = d.readErr(err)
+		}
+	}()
+	for {
+		n := len(d.frames)
+		if n == 0 {
+			// begin the next top-level value
+			d.scratch.ResetCap(scratchRetain)
+			if c := d.skipDocSpaces(); c == 0 && d.EOF() {
+				if d.spaceErr != nil {
+					return d.spaceErr
+				}
+				return io.EOF
+			}
+			atomic.AddInt64(&d.documents, 1)
+			if d.emitDepth == 0 {
+				return d.decodeValue(v, []string{})
+			}
+			if c := d.Cur(); c != '[' && c != '{' {
+				if err := d.skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			d.frames = append(d.frames, newSubStream(d, []string{}))
+			continue
+		}
+
+		top := d.frames[n-1]
+		if n == d.emitDepth {
+			err := top.Decode(v)
+			if err == io.EOF {
+				d.frames = d.frames[:n-1]
+				continue
+			}
+			return err
+		}
+
+		// descend towards the emit depth
+		if err := top.next(); err != nil {
+			if err == io.EOF {
+				d.frames = d.frames[:n-1]
+				continue
+			}
+			return err
+		}
+		if c := d.Cur(); c == '[' || c == '{' {
+			d.frames = append(d.frames, newSubStream(d, top.elemKeys()))
+		} else if err := top.fail(d.skip()); err != nil {
+			return err
+		}
+	}
+}
+
+// DecodeFull reads the next top-level value in full, regardless of the
+// emit depth, and returns it as it would be emitted at depth 0: objects
+// are decoded as KVS with ObjectAsKVS, and strings and numbers as
+// configured. Options selecting values, such as key filters and SkipIf,
+// do not apply. io.EOF is returned once the input is exhausted. Like
+// DecodeNext, it must not be combined with Stream or Walk, and it may not
+// be called while DecodeNext is within a container.
+func (d *Decoder) DecodeFull() (v interface{}, err error) {
+	if len(d.frames) > 0 {
+		return nil, errFramesOpen
+	}
+	defer d.Publish()
+	defer d.FlushTee()
+	defer func() {
+		if err != nil {
+			err = d.readErr(err)
+		}
+	}()
+
+	d.scratch.ResetCap(scratchRetain)
+	if c := d.skipDocSpaces(); c == 0 && d.EOF() {
+		if d.spaceErr != nil {
+			return nil, d.spaceErr
+		}
+		return nil, io.EOF
+	}
+	atomic.AddInt64(&d.documents, 1)
+
+	// decode as at emit depth 0, building every container
+	emitDepth, emitRecursive, unsafeStrings := d.emitDepth, d.emitRecursive, d.unsafeStrings
+	filterKeys, filterRe, filterPath, skipFn := d.filterKeys, d.filterRe, d.filterPath, d.skipFn
+	d.emitDepth, d.emitRecursive, d.unsafeStrings = 0, false, false
+	d.filterKeys, d.filterRe, d.filterPath, d.skipFn = nil, nil, nil, nil
+	defer func() {
+		d.emitDepth, d.emitRecursive, d.unsafeStrings = emitDepth, emitRecursive, unsafeStrings
+		d.filterKeys, d.filterRe, d.filterPath, d.skipFn = filterKeys, filterRe, filterPath, skipFn
+	}()
+
+	i, _, err := d.any([]string{})
+	return i, err
+}
+
+// decodeValue reads the value beginning at the current position into v
+func (d *Decoder) decodeValue(v interface{}, keys []string) error {
+	if u, ok := v.(StreamUnmarshaler); ok {
+		if c := d.Cur(); c != '[' && c != '{' {
+			if err := d.skip(); err != nil {
+				return err
+			}
+			return errNotContainer
+		}
+		s := newSubStream(d, keys)
+		err := u.UnmarshalJStream(s)
+		if derr := s.drain(); err == nil {
+			err = derr
+		}
+		return err
+	}
+
+	i, _, err := d.any(keys)
+	if err != nil {
+		return err
+	}
+	if p, ok := v.(*interface{}); ok {
+		*p = i
+		return nil
+	}
+	b, err := marshal(i)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
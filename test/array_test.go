@@ -0,0 +1,206 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xenking/jstream"
+)
+
+type arrayExpect struct {
+	value interface{} // expected scalar value, or nil for containers
+	depth int
+	index int
+	keys  string // Keys joined by "/"
+}
+
+func TestDecoderNestedArrays(t *testing.T) {
+	const (
+		matrix = `[[1,2,3],[4,5,6]]`
+		cube   = `[[[1,2],[3,4]],[[5,6],[7,8]]]`
+	)
+
+	tests := []struct {
+		name    string
+		body    string
+		depth   int
+		options func(*jstream.Decoder) *jstream.Decoder
+		expect  []arrayExpect
+	}{
+		{
+			name:  "rows",
+			body:  matrix,
+			depth: 1,
+			expect: []arrayExpect{
+				{nil, 1, 0, ""},
+				{nil, 1, 1, ""},
+			},
+		},
+		{
+			name:  "cells",
+			body:  matrix,
+			depth: 2,
+			expect: []arrayExpect{
+				{int64(1), 2, 0, "/"}, {int64(2), 2, 1, "/"}, {int64(3), 2, 2, "/"},
+				{int64(4), 2, 0, "/"}, {int64(5), 2, 1, "/"}, {int64(6), 2, 2, "/"},
+			},
+		},
+		{
+			name:    "cells indexed",
+			body:    matrix,
+			depth:   2,
+			options: (*jstream.Decoder).IndexedKeys,
+			expect: []arrayExpect{
+				{int64(1), 2, 0, "0/0"}, {int64(2), 2, 1, "0/1"}, {int64(3), 2, 2, "0/2"},
+				{int64(4), 2, 0, "1/0"}, {int64(5), 2, 1, "1/1"}, {int64(6), 2, 2, "1/2"},
+			},
+		},
+		{
+			name:    "cells emitKV",
+			body:    matrix,
+			depth:   2,
+			options: (*jstream.Decoder).EmitKV,
+			expect: []arrayExpect{
+				{int64(1), 2, 0, "/"}, {int64(2), 2, 1, "/"}, {int64(3), 2, 2, "/"},
+				{int64(4), 2, 0, "/"}, {int64(5), 2, 1, "/"}, {int64(6), 2, 2, "/"},
+			},
+		},
+		{
+			name:  "recursive indexed",
+			body:  matrix,
+			depth: 1,
+			options: func(d *jstream.Decoder) *jstream.Decoder {
+				return d.Recursive().IndexedKeys()
+			},
+			expect: []arrayExpect{
+				{int64(1), 2, 0, "0/0"}, {int64(2), 2, 1, "0/1"}, {int64(3), 2, 2, "0/2"},
+				{nil, 1, 0, "0"},
+				{int64(4), 2, 0, "1/0"}, {int64(5), 2, 1, "1/1"}, {int64(6), 2, 2, "1/2"},
+				{nil, 1, 1, "1"},
+			},
+		},
+		{
+			name:  "recursive from root",
+			body:  matrix,
+			depth: -1,
+			expect: []arrayExpect{
+				{int64(1), 2, 0, "/"}, {int64(2), 2, 1, "/"}, {int64(3), 2, 2, "/"},
+				{nil, 1, 0, ""},
+				{int64(4), 2, 0, "/"}, {int64(5), 2, 1, "/"}, {int64(6), 2, 2, "/"},
+				{nil, 1, 1, ""},
+				{nil, 0, -1, ""},
+			},
+		},
+		{
+			name:  "cube planes",
+			body:  cube,
+			depth: 2,
+			expect: []arrayExpect{
+				{nil, 2, 0, "/"}, {nil, 2, 1, "/"},
+				{nil, 2, 0, "/"}, {nil, 2, 1, "/"},
+			},
+		},
+		{
+			name:    "cube cells indexed",
+			body:    cube,
+			depth:   3,
+			options: (*jstream.Decoder).IndexedKeys,
+			expect: []arrayExpect{
+				{int64(1), 3, 0, "0/0/0"}, {int64(2), 3, 1, "0/0/1"},
+				{int64(3), 3, 0, "0/1/0"}, {int64(4), 3, 1, "0/1/1"},
+				{int64(5), 3, 0, "1/0/0"}, {int64(6), 3, 1, "1/0/1"},
+				{int64(7), 3, 0, "1/1/0"}, {int64(8), 3, 1, "1/1/1"},
+			},
+		},
+		{
+			name:  "cube recursive emitKV indexed",
+			body:  cube,
+			depth: 2,
+			options: func(d *jstream.Decoder) *jstream.Decoder {
+				return d.Recursive().EmitKV().IndexedKeys()
+			},
+			expect: []arrayExpect{
+				{int64(1), 3, 0, "0/0/0"}, {int64(2), 3, 1, "0/0/1"}, {nil, 2, 0, "0/0"},
+				{int64(3), 3, 0, "0/1/0"}, {int64(4), 3, 1, "0/1/1"}, {nil, 2, 1, "0/1"},
+				{int64(5), 3, 0, "1/0/0"}, {int64(6), 3, 1, "1/0/1"}, {nil, 2, 0, "1/0"},
+				{int64(7), 3, 0, "1/1/0"}, {int64(8), 3, 1, "1/1/1"}, {nil, 2, 1, "1/1"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoder := jstream.NewDecoder(mkReader(test.body), test.depth)
+			if test.options != nil {
+				decoder = test.options(decoder)
+			}
+
+			var got []*jstream.MetaValue
+			for mv := range decoder.Stream() {
+				got = append(got, mv)
+			}
+			assertNil(t, decoder.Err())
+			if len(got) != len(test.expect) {
+				t.Fatalf("expected %d values, got %d", len(test.expect), len(got))
+			}
+
+			for i, exp := range test.expect {
+				mv := got[i]
+				if exp.value != nil {
+					assertEqual(t, exp.value, mv.Value)
+				} else {
+					assertEqual(t, jstream.Array, mv.ValueType)
+				}
+				assertEqual(t, exp.depth, mv.Depth)
+				assertEqual(t, exp.index, mv.Index)
+				assertEqual(t, exp.keys, strings.Join(mv.Keys, "/"))
+			}
+		})
+	}
+}
+
+func TestDecoderStreamRows(t *testing.T) {
+	body := `[[1, 2, 3], [4.5, -5, 6e2]]`
+
+	decoder := jstream.NewDecoder(mkReader(body), 1)
+	var rows [][]float64
+	for row := range decoder.StreamRows() {
+		rows = append(rows, row)
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 2, len(rows))
+	assertEqual(t, 3.0, rows[0][2])
+	assertEqual(t, 4.5, rows[1][0])
+	assertEqual(t, -5.0, rows[1][1])
+	assertEqual(t, 600.0, rows[1][2])
+
+	decoder = jstream.NewDecoder(mkReader(`[[1, 2], [3, "four"], [5, 6]]`), 1)
+	rows = rows[:0]
+	for row := range decoder.StreamRows() {
+		rows = append(rows, row)
+	}
+	assertEqual(t, 1, len(rows))
+	assertNotNil(t, decoder.Err())
+
+	// a consumer may stop receiving and Close the Decoder
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("[1, 2]")
+	}
+	sb.WriteString("]")
+	decoder = jstream.NewDecoder(mkReader(sb.String()), 1)
+	ch := decoder.StreamRows()
+	<-ch
+	assertNil(t, decoder.Close())
+	select {
+	case <-decoder.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("StreamRows did not end once closed")
+	}
+	assertEqual(t, jstream.ErrClosed, decoder.Err())
+}
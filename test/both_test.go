@@ -0,0 +1,65 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderEmitBoth(t *testing.T) {
+	body := `{"a": [1, 2.5, -3e2], "b": {"c": "esc\"aped é", "d": [true, false, null]},
+"e": [{"f": []}, {}]}
+["x", {"y": {"z": [0]}}]`
+
+	options := []func(*jstream.Decoder) *jstream.Decoder{
+		nil,
+		(*jstream.Decoder).EmitKV,
+		(*jstream.Decoder).Recursive,
+		(*jstream.Decoder).ObjectAsKVS,
+		func(d *jstream.Decoder) *jstream.Decoder { return d.EmitKV().Recursive() },
+	}
+	for _, option := range options {
+		for _, depth := range []int{0, 1, 2, -1} {
+			for _, n := range []int{1, 3, len(body)} {
+				decoder := jstream.NewDecoder(&chunkReader{data: []byte(body), n: n}, depth).EmitBoth()
+				if option != nil {
+					decoder = option(decoder)
+				}
+				values, err := decoder.ReadAll()
+				assertNil(t, err)
+				for _, mv := range values {
+					v := mv.Value
+					if kv, ok := v.(jstream.KV); ok {
+						v = kv.Value
+					} else {
+						assertEqual(t, body[mv.Offset:mv.Offset+mv.Length], string(mv.Raw))
+					}
+
+					var x interface{}
+					assertNil(t, json.Unmarshal(mv.Raw, &x))
+					expected, err := json.Marshal(x)
+					assertNil(t, err)
+					actual, err := json.Marshal(v)
+					assertNil(t, err)
+					assertEqual(t, string(expected), string(actual))
+				}
+			}
+		}
+	}
+
+	// values held until their document is complete
+	values, err := decodeAll("[1, \"a\"]\n{\"b\": null}\n", 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.NDJSON().EmitBoth()
+	})
+	assertNil(t, err)
+	assertEqual(t, 3, len(values))
+	for i, raw := range []string{`1`, `"a"`, `null`} {
+		assertEqual(t, raw, string(values[i].Raw))
+	}
+
+	// Raw is not set by default
+	values, err = decodeAll(`[1]`, 1, nil)
+	assertNil(t, err)
+	assertTrue(t, values[0].Raw == nil)
+}
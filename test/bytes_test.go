@@ -0,0 +1,97 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+const bytesBody = `["alpha", {"key": "beta", "list": ["gamma"]}, "delta\n", 1]`
+
+func TestDecoderStringsAsBytes(t *testing.T) {
+	values, err := decodeAll(bytesBody, -1, (*jstream.Decoder).StringsAsBytes)
+	assertNil(t, err)
+
+	// retained slices hold each value once decoding completes
+	var got []string
+	for _, mv := range values {
+		if b, ok := mv.Value.([]byte); ok {
+			assertEqual(t, jstream.String, mv.ValueType)
+			got = append(got, string(b))
+		}
+	}
+	assertEqual(t, "[alpha beta gamma delta\n]", fmt.Sprint(got))
+
+	obj := values[4].Value.(map[string]interface{})
+	assertEqual(t, "beta", string(obj["key"].([]byte)))
+	assertEqual(t, "gamma", string(obj["list"].([]interface{})[0].([]byte)))
+
+	// and are written as strings when encoded
+	var out bytes.Buffer
+	assertNil(t, jstream.NewEncoder(&out).Encode(values[len(values)-1]))
+	assertEqual(t, `["alpha",{"key":"beta","list":["gamma"]},"delta\n",1]`+"\n", out.String())
+}
+
+func TestDecoderUnsafeStrings(t *testing.T) {
+	var (
+		emitted []string
+		nested  []interface{}
+	)
+	decoder := jstream.NewDecoder(mkReader(bytesBody), 1).UnsafeStrings()
+	err := decoder.Walk(func(mv *jstream.MetaValue) error {
+		switch v := mv.Value.(type) {
+		case []byte:
+			emitted = append(emitted, string(v)) // copied within the callback
+		case map[string]interface{}:
+			nested = append(nested, v)
+		}
+		return nil
+	})
+	assertNil(t, err)
+	assertEqual(t, "[alpha delta\n]", fmt.Sprint(emitted))
+
+	// strings within containers are copies, and outlive the callback
+	obj := nested[0].(map[string]interface{})
+	assertEqual(t, "beta", string(obj["key"].([]byte)))
+	assertEqual(t, "gamma", string(obj["list"].([]interface{})[0].([]byte)))
+
+	// as are all strings with Stream
+	decoder = jstream.NewDecoder(mkReader(`["one", "two", "three"]`), 1).UnsafeStrings()
+	var retained [][]byte
+	for mv := range decoder.Stream() {
+		retained = append(retained, mv.Value.([]byte))
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, "[one two three]", fmt.Sprintf("%s", retained))
+}
+
+func BenchmarkDecoderStrings(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 100000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, `"string value number %d"`, i)
+	}
+	sb.WriteString("]")
+	body := []byte(sb.String())
+
+	modes := map[string]func(*jstream.Decoder) *jstream.Decoder{
+		"string": func(d *jstream.Decoder) *jstream.Decoder { return d },
+		"bytes":  (*jstream.Decoder).StringsAsBytes,
+		"unsafe": (*jstream.Decoder).UnsafeStrings,
+	}
+	for name, mode := range modes {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				mode(jstream.NewDecoder(bytes.NewReader(body), 1)).Walk(func(*jstream.MetaValue) error { return nil })
+			}
+		})
+	}
+}
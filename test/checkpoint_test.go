@@ -0,0 +1,103 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func checkpointBody() ([]string, []byte) {
+	var docs []string
+	for i := 0; i < 200; i++ {
+		docs = append(docs, fmt.Sprintf("{\"id\": %d,\n \"v\": [%d]}", i, i))
+	}
+	return docs, []byte(strings.Join(docs, "\n"))
+}
+
+func TestDecoderCheckpoint(t *testing.T) {
+	docs, body := checkpointBody()
+
+	// decode half the stream, checkpointing after the last document
+	var (
+		state []byte
+		stop  = errors.New("stop")
+	)
+	decoder := jstream.NewDecoder(bytes.NewReader(body), 0)
+	err := decoder.Walk(func(mv *jstream.MetaValue) error {
+		if mv.Value.(map[string]interface{})["id"] == int64(99) {
+			var err error
+			state, err = decoder.Checkpoint()
+			assertNil(t, err)
+			return stop
+		}
+		return nil
+	})
+	assertEqual(t, stop, err)
+
+	decoder, err = jstream.RestoreDecoder(bytes.NewReader(body), state, 0)
+	assertNil(t, err)
+	n := 100
+	for mv := range decoder.Stream() {
+		assertEqual(t, docs[n], string(body[mv.Offset:mv.Offset+mv.Length]))
+		assertEqual(t, 2*n+1, mv.Line)
+		n++
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 200, n)
+	assertEqual(t, 200, decoder.Stats().Documents)
+}
+
+func TestDecoderCheckpointPosition(t *testing.T) {
+	// errors after restoring report the same position as without
+	body := []byte("[1]\n  [2] [3, }")
+	var states [][]byte
+	decoder := jstream.NewDecoder(bytes.NewReader(body), 0)
+	err := decoder.Walk(func(mv *jstream.MetaValue) error {
+		state, err := decoder.Checkpoint()
+		assertNil(t, err)
+		states = append(states, state)
+		return nil
+	})
+	assertNotNil(t, err)
+	assertEqual(t, 2, len(states))
+
+	for _, state := range states {
+		restored, rerr := jstream.RestoreDecoder(bytes.NewReader(body), state, 0)
+		assertNil(t, rerr)
+		for range restored.Stream() {
+		}
+		assertEqual(t, errorLine(err), errorLine(restored.Err()))
+	}
+}
+
+func TestDecoderCheckpointMidValue(t *testing.T) {
+	_, body := checkpointBody()
+	decoder := jstream.NewDecoder(bytes.NewReader(body), 1)
+	err := decoder.Walk(func(mv *jstream.MetaValue) error {
+		_, err := decoder.Checkpoint()
+		return err
+	})
+	assertEqual(t, jstream.ErrMidValue, err)
+
+	// between calls to DecodeNext
+	decoder = jstream.NewDecoder(bytes.NewReader(body), 0)
+	var v interface{}
+	assertNil(t, decoder.DecodeNext(&v))
+	state, err := decoder.Checkpoint()
+	assertNil(t, err)
+	decoder, err = jstream.RestoreDecoder(bytes.NewReader(body), state, 0)
+	assertNil(t, err)
+	var n int
+	for {
+		if err := decoder.DecodeNext(&v); err == io.EOF {
+			break
+		}
+		n++
+	}
+	assertEqual(t, 199, n)
+}
@@ -0,0 +1,212 @@
+package test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xenking/jstream"
+)
+
+// hugeStringReader yields a single JSON string literal of the given size,
+// calling onRead with the total number of bytes produced after each read
+type hugeStringReader struct {
+	size     int64
+	produced int64
+	onRead   func(n int64)
+}
+
+func (r *hugeStringReader) Read(p []byte) (int, error) {
+	n := atomic.LoadInt64(&r.produced)
+	if n >= r.size+2 {
+		return 0, io.EOF
+	}
+	var i int
+	for ; i < len(p) && n < r.size+2; i++ {
+		if n == 0 || n == r.size+1 {
+			p[i] = '"'
+		} else {
+			p[i] = 'a'
+		}
+		n++
+	}
+	atomic.StoreInt64(&r.produced, n)
+	if r.onRead != nil {
+		r.onRead(n)
+	}
+	return i, nil
+}
+
+// blockingReader yields its data, then blocks until unblocked
+type blockingReader struct {
+	data    []byte
+	unblock chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	if len(r.data) > 0 {
+		n := copy(p, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+	<-r.unblock
+	return 0, io.EOF
+}
+
+func waitClosed(t *testing.T, ch chan *jstream.MetaValue) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+			t.Fatal("expected no values")
+		case <-timeout:
+			t.Fatal("stream was not closed promptly")
+		}
+	}
+}
+
+func TestDecoderCloseMidValue(t *testing.T) {
+	const (
+		size    = 100 << 20
+		closeAt = 10 << 20
+	)
+
+	// the reader pauses once closeAt bytes have been produced, until the
+	// decoder has been closed
+	var (
+		reached = make(chan struct{})
+		closed  = make(chan struct{})
+		once    sync.Once
+		r       = &hugeStringReader{size: size}
+	)
+	r.onRead = func(n int64) {
+		if n >= closeAt {
+			once.Do(func() {
+				close(reached)
+				<-closed
+			})
+		}
+	}
+	decoder := jstream.NewDecoder(r, 0)
+
+	ch := decoder.Stream()
+	<-reached
+	assertNil(t, decoder.Close())
+	close(closed)
+	waitClosed(t, ch)
+	assertEqual(t, jstream.ErrClosed, decoder.Err())
+
+	// decoding stopped within a few buffer fills of being closed, rather
+	// than reading and buffering the remainder of the string
+	if n := atomic.LoadInt64(&r.produced); n > closeAt+1<<16 {
+		t.Fatalf("expected decoding to stop near %d bytes, read %d", closeAt, n)
+	}
+	if pos := decoder.GetPos(); pos > closeAt+1<<16 {
+		t.Fatalf("expected decoding to stop near %d bytes, stopped at %d", closeAt, pos)
+	}
+
+	// closing again is harmless
+	assertNil(t, decoder.Close())
+}
+
+func TestDecoderStreamContext(t *testing.T) {
+	// cancellation while waiting for more input
+	r := &blockingReader{data: []byte(`[{"a": "b"}, "c`), unblock: make(chan struct{})}
+	defer close(r.unblock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	decoder := jstream.NewDecoder(r, 1)
+	var count int
+	for range decoder.StreamContext(ctx) {
+		count++
+	}
+	assertEqual(t, 1, count)
+	assertEqual(t, context.DeadlineExceeded, decoder.Err())
+
+	// a context outliving the stream has no effect
+	ctx, cancel = context.WithCancel(context.Background())
+	decoder = jstream.NewDecoder(mkReader(`[1, 2, 3]`), 1)
+	count = 0
+	for range decoder.StreamContext(ctx) {
+		count++
+	}
+	cancel()
+	assertEqual(t, 3, count)
+	assertNil(t, decoder.Err())
+}
+
+func TestDecoderCloseWalk(t *testing.T) {
+	// decoding stops at the next element, although the rest of the input
+	// is buffered by the scanner
+	tests := []struct {
+		body  string
+		depth int
+	}{
+		{`[1, 2, 3, 4, 5]`, 1},
+		{`{"a": 1, "b": 2, "c": 3}`, 1},
+		{`[[1, 2, 3]]`, 2},
+		{`1 2 3`, 0},
+	}
+	for _, test := range tests {
+		var decoder *jstream.Decoder
+		decoder = jstream.NewDecoder(mkReader(test.body), test.depth)
+		var count int
+		err := decoder.Walk(func(mv *jstream.MetaValue) error {
+			if count++; count == 2 {
+				decoder.Close()
+			}
+			return nil
+		})
+		assertEqual(t, jstream.ErrClosed, err)
+		assertEqual(t, 2, count)
+	}
+}
+
+func TestDecoderDone(t *testing.T) {
+	// Err is set once the channel is closed, without further
+	// synchronization; run with -race
+	for i := 0; i < 50; i++ {
+		decoder := jstream.NewDecoder(mkReader(`[1, 2, x]`), 1)
+		ch := decoder.Stream()
+		for range ch {
+		}
+		assertNotNil(t, decoder.Err())
+		<-decoder.Done()
+	}
+
+	// Done may be selected on along with values
+	decoder := jstream.NewDecoder(mkReader(`[1, 2, 3]`), 1).ChannelBuffer(0)
+	ch := decoder.Stream()
+	var count int
+	for done := false; !done; {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				count++
+			}
+		case <-decoder.Done():
+			done = true
+		}
+	}
+	assertEqual(t, 3, count)
+	assertNil(t, decoder.Err())
+
+	// Walk closes Done once it returns
+	decoder = jstream.NewDecoder(mkReader(`[1, 2, 3]`), 1)
+	select {
+	case <-decoder.Done():
+		t.Fatal("expected Done to remain open before decoding")
+	default:
+	}
+	assertNil(t, decoder.Walk(func(*jstream.MetaValue) error { return nil }))
+	<-decoder.Done()
+}
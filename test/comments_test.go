@@ -0,0 +1,64 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderAllowComments(t *testing.T) {
+	body := `// leading comment
+{
+  /* before a key */ "a": [1, // after an element
+    2 /* between */, /**/3],
+  "b" /* before colon */ : /* before value */ "not // a /* comment */",
+  // before the final key
+  "c": {"d": null}
+}
+/* after the
+   final value */ // and a line comment`
+
+	values, err := decodeAll(body, 1, (*jstream.Decoder).AllowComments)
+	assertNil(t, err)
+	assertEqual(t, 3, len(values))
+	assertEqual(t, "[1 2 3]", fmt.Sprint(values[0].Value))
+	assertEqual(t, "not // a /* comment */", values[1].Value)
+
+	// comments are rejected by default
+	_, err = decodeAll(body, 1, nil)
+	assertNotNil(t, err)
+}
+
+func TestDecoderCommentsLineNumbers(t *testing.T) {
+	body := "/* one\ntwo\nthree */ [1, // four\n  x]"
+	_, err := decodeAll(body, 1, (*jstream.Decoder).AllowComments)
+	if err == nil || !strings.HasSuffix(errorLine(err), "'x' [4,3] offset 34") {
+		t.Fatalf("expected error at line 4, column 3, got %v", err)
+	}
+}
+
+func TestDecoderCommentsUnterminated(t *testing.T) {
+	tests := []string{
+		`[1, 2] /* never closed`,
+		`[1, /* never closed`,
+		`{"a": /* never closed`,
+		`[1 /* almost closed *`,
+	}
+	for _, body := range tests {
+		_, err := decodeAll(body, 1, (*jstream.Decoder).AllowComments)
+		if err == nil || !strings.HasPrefix(err.Error(), "unexpected end of JSON input in block comment") {
+			t.Errorf("%s: expected unexpected EOF in block comment, got %v", body, err)
+		}
+	}
+
+	// a line comment may end the input
+	values, err := decodeAll("[1] // done", 0, (*jstream.Decoder).AllowComments)
+	assertNil(t, err)
+	assertEqual(t, 1, len(values))
+
+	// a lone slash is not a comment
+	_, err = decodeAll("[1, /2]", 0, (*jstream.Decoder).AllowComments)
+	assertNotNil(t, err)
+}
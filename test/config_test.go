@@ -0,0 +1,27 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderConfigGetters(t *testing.T) {
+	d := jstream.NewDecoder(strings.NewReader(`{}`), 2)
+	assertEqual(t, 2, d.EmitDepth())
+	assertFalse(t, d.IsRecursive())
+	assertFalse(t, d.IsEmitKV())
+	assertFalse(t, d.IsObjectAsKVS())
+
+	d = jstream.NewDecoder(strings.NewReader(`{}`), 1).Recursive().EmitKV().ObjectAsKVS()
+	assertEqual(t, 1, d.EmitDepth())
+	assertTrue(t, d.IsRecursive())
+	assertTrue(t, d.IsEmitKV())
+	assertTrue(t, d.IsObjectAsKVS())
+
+	// a negative depth emits values at every depth
+	d = jstream.NewDecoder(strings.NewReader(`{}`), -1)
+	assertEqual(t, 0, d.EmitDepth())
+	assertTrue(t, d.IsRecursive())
+}
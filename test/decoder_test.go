@@ -2,7 +2,13 @@ package test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
 	"runtime/debug"
+	"strings"
 	"testing"
 
 	"github.com/xenking/jstream"
@@ -10,11 +16,13 @@ import (
 
 func mkReader(s string) *bytes.Reader { return bytes.NewReader([]byte(s)) }
 
-func TestDecoderSimple(t *testing.T) {
+func TestDecoderSimple(t *testing.T) { testDecoderSimple(t, "") }
+
+func testDecoderSimple(t *testing.T, prefix string) {
 	var (
 		counter int
 		mv      *jstream.MetaValue
-		body    = `[{
+		body    = prefix + `[{
 	"bio": "bada bing bada boom",
 	"id": 1,
 	"name": "Charles",
@@ -175,6 +183,8 @@ func TestDecoderSimpleForEmitKV(t *testing.T) {
 		uRet, ok := (mv.Value).(jstream.KV)
 		assertTrue(t, ok)
 		assertNotNil(t, uRet)
+		assertEqual(t, jstream.Array, uRet.ValueType)
+		assertEqual(t, int64(len("[1, 2, 3]")), uRet.Length)
 		result, ok := (uRet.Value).([]interface{})
 		assertTrue(t, ok)
 		assertEqual(t, 3, len(result))
@@ -409,6 +419,25 @@ func TestDecoderFlat(t *testing.T) {
 	}
 }
 
+func TestDecoderReadAll(t *testing.T) {
+	body := `[
+  "1st test string",
+  "Roberto*Maestro", "Charles",
+  0, null, false,
+  1, 2.5
+]`
+	values, err := jstream.NewDecoder(mkReader(body), 1).ReadAll()
+	assertNil(t, err)
+	assertEqual(t, 8, len(values))
+	assertEqual(t, "Charles", values[2].Value)
+	assertEqual(t, 2.5, values[7].Value)
+
+	// values before an error are returned with it
+	values, err = jstream.NewDecoder(mkReader(`[1, 2, x]`), 1).ReadAll()
+	assertNotNil(t, err)
+	assertEqual(t, 2, len(values))
+}
+
 func TestDecoderMultiDoc(t *testing.T) {
 	var (
 		counter int
@@ -486,6 +515,151 @@ func TestDecoderMultiDoc(t *testing.T) {
 	}
 }
 
+func TestDecoderFilterKeys(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i := 0; i < 10000; i++ {
+		switch i {
+		case 10:
+			sb.WriteString(`"id": 42,`)
+		case 5000:
+			sb.WriteString(`"timestamp": "2020-01-01T00:00:00Z",`)
+		case 9000:
+			sb.WriteString(`"metric_cpu": [0.5, 0.75],`)
+		}
+		fmt.Fprintf(&sb, `"key%d": {"nested": {"deeper": [1, "two", {"three": null}]}, "flag": true}`, i)
+		if i < 9999 {
+			sb.WriteString(",")
+		}
+	}
+	sb.WriteString("}")
+	body := sb.String()
+
+	decode := func() map[string]interface{} {
+		decoder := jstream.NewDecoder(mkReader(body), 1).EmitKV().
+			FilterKeys("id", "timestamp").
+			FilterKeysRegexp(regexp.MustCompile(`^metric_`))
+		found := make(map[string]interface{})
+		for mv := range decoder.Stream() {
+			kv := mv.Value.(jstream.KV)
+			found[kv.Key] = kv.Value
+		}
+		assertNil(t, decoder.Err())
+		return found
+	}
+
+	found := decode()
+	assertEqual(t, 3, len(found))
+	assertEqual(t, int64(42), found["id"])
+	assertEqual(t, "2020-01-01T00:00:00Z", found["timestamp"])
+	assertEqual(t, 2, len(found["metric_cpu"].([]interface{})))
+
+	// decoding each of the skipped subtrees would allocate several maps,
+	// slices and strings; skipping must not allocate at all
+	if raceEnabled {
+		return
+	}
+	allocs := testing.AllocsPerRun(3, func() { decode() })
+	if allocs > 1000 {
+		t.Fatalf("expected skipped values not to allocate, got %v allocs", allocs)
+	}
+}
+
+func TestDecoderStoredKeysAllocs(t *testing.T) {
+	if raceEnabled {
+		return
+	}
+	const n = 10000
+	body := "[" + strings.Repeat(`{"a": 1, "b": [2, {"c": 3}], "d": true},`, n) + "null]"
+
+	// values stored in their container, and not emitted, are not given
+	// Keys of their own, such that each object allocates for its contents
+	// and MetaValue, but not for the Keys of its members
+	for _, depth := range []int{0, 1} {
+		allocs := testing.AllocsPerRun(3, func() {
+			decoder := jstream.NewDecoder(mkReader(body), depth)
+			assertNil(t, decoder.Walk(func(*jstream.MetaValue) error { return nil }))
+		})
+		if allocs > 9*n {
+			t.Errorf("depth %d: expected at most %d allocs, got %v", depth, 9*n, allocs)
+		}
+	}
+}
+
+func TestDecoderWalk(t *testing.T) {
+	body := `[{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}, {"id": 5}]`
+
+	var ids []interface{}
+	decoder := jstream.NewDecoder(mkReader(body), 1)
+	err := decoder.Walk(func(mv *jstream.MetaValue) error {
+		ids = append(ids, mv.Value.(map[string]interface{})["id"])
+		return nil
+	})
+	assertNil(t, err)
+	assertEqual(t, 5, len(ids))
+
+	// decoding stops at the first callback error
+	stop := errors.New("stop")
+	var calls int
+	decoder = jstream.NewDecoder(mkReader(body), 1)
+	err = decoder.Walk(func(mv *jstream.MetaValue) error {
+		calls++
+		if calls == 3 {
+			return stop
+		}
+		return nil
+	})
+	assertEqual(t, stop, err)
+	assertEqual(t, stop, decoder.Err())
+	assertEqual(t, 3, calls)
+	assertEqual(t, strings.Index(body, `, {"id": 4}`), decoder.GetPos())
+
+	// options apply as for Stream
+	var kvs []jstream.KV
+	decoder = jstream.NewDecoder(mkReader(body), 2).EmitKV().FilterKeys("id")
+	err = decoder.Walk(func(mv *jstream.MetaValue) error {
+		kvs = append(kvs, mv.Value.(jstream.KV))
+		return nil
+	})
+	assertNil(t, err)
+	assertEqual(t, 5, len(kvs))
+	assertEqual(t, int64(5), kvs[4].Value)
+}
+
+func TestDecoderScratchRetain(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`"`)
+	sb.WriteString(strings.Repeat("a", 8<<20))
+	sb.WriteString("\"\n")
+	for i := 0; i < 1000; i++ {
+		sb.WriteString(`{"small": "value"}` + "\n")
+	}
+	body := sb.String()
+	sb.Reset()
+
+	var count int
+	var before, after runtime.MemStats
+	decoder := jstream.NewDecoder(mkReader(body), 0)
+	err := decoder.Walk(func(mv *jstream.MetaValue) error {
+		if count++; count == 1 {
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+		}
+		return nil
+	})
+	assertNil(t, err)
+	assertEqual(t, 1001, count)
+
+	// the large string and the scratch space used to decode it are both
+	// released once decoding moves on to the small values
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(decoder)
+	if freed := int64(before.HeapAlloc) - int64(after.HeapAlloc); freed < 16<<20 {
+		t.Fatalf("expected at least %d bytes to be released, got %d", 16<<20, freed)
+	}
+}
+
 func assertTrue(t *testing.T, a interface{}) {
 	if a == false {
 		t.Errorf("%+v should be true %s", a, debug.Stack())
@@ -504,6 +678,16 @@ func assertEqual(t *testing.T, a, b interface{}) {
 	}
 }
 
+// errorLine returns the first line of the message of err, omitting any
+// snippet of the input
+func errorLine(err error) string {
+	if err == nil {
+		return "<nil>"
+	}
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	return msg
+}
+
 func assertNotNil(t *testing.T, a interface{}) {
 	if a == nil {
 		t.Errorf("%+v should not nil %s", a, debug.Stack())
@@ -515,3 +699,309 @@ func assertNil(t *testing.T, a interface{}) {
 		t.Errorf("%+v should be nil %s", a, debug.Stack())
 	}
 }
+
+func TestDecoderBytesConsumed(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, `{"id": %d}`, i)
+	}
+	sb.WriteString("]")
+	body := sb.String()
+
+	decoder := jstream.NewDecoder(mkReader(body), 1)
+	var last int64
+	for mv := range decoder.Stream() {
+		// read concurrently with decoding; never behind the value received
+		n := decoder.BytesConsumed()
+		if n < int64(mv.Offset+mv.Length) || n < last {
+			t.Fatalf("bytes consumed %d behind value ending at %d", n, mv.Offset+mv.Length)
+		}
+		last = n
+		_ = decoder.GetPos()
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, int64(len(body)), decoder.BytesConsumed())
+	assertEqual(t, len(body), decoder.GetPos())
+}
+
+func TestDecoderChannelBuffer(t *testing.T) {
+	for _, n := range []int{0, 1, 4096} {
+		decoder := jstream.NewDecoder(mkReader(`[1, 2, 3]`), 1).ChannelBuffer(n)
+		ch := decoder.Stream()
+		assertEqual(t, n, cap(ch))
+		var count int
+		for range ch {
+			count++
+		}
+		assertNil(t, decoder.Err())
+		assertEqual(t, 3, count)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for negative buffer size")
+		}
+	}()
+	jstream.NewDecoder(mkReader(`[]`), 1).ChannelBuffer(-1)
+}
+
+func BenchmarkDecoderChannelBuffer(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 100000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, "%d", i)
+	}
+	sb.WriteString("]")
+	body := []byte(sb.String())
+
+	for _, n := range []int{1, 128, 4096} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				decoder := jstream.NewDecoder(bytes.NewReader(body), 1).ChannelBuffer(n)
+				for range decoder.Stream() {
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderBOM(t *testing.T) {
+	const bom = "\xef\xbb\xbf"
+	testDecoderSimple(t, bom)
+
+	// offsets count the byte order mark; marks may precede each document
+	body := bom + `{"a": 1}` + "\n" + bom + ` [2]` + bom + `3`
+	values, err := decodeAll(body, 0, nil)
+	assertNil(t, err)
+	assertEqual(t, 3, len(values))
+	for _, mv := range values {
+		raw := body[mv.Offset : mv.Offset+mv.Length]
+		assertEqual(t, raw, strings.TrimPrefix(strings.TrimSpace(raw), bom))
+	}
+	assertEqual(t, int64(3), values[0].Offset)
+	assertEqual(t, int64(3), values[2].Value)
+
+	// a byte order mark is not allowed within a document, or when partial
+	for _, body := range []string{"[" + bom + "1]", "\xef\xbb[1]", "\xef[1]", bom + bom[:2]} {
+		if _, err := decodeAll(body, 0, nil); err == nil {
+			t.Errorf("%q: expected error", body)
+		}
+	}
+
+	// DecodeNext skips it likewise
+	decoder := jstream.NewDecoder(mkReader(bom+`[1, 2]`), 1)
+	var v interface{}
+	assertNil(t, decoder.DecodeNext(&v))
+	assertEqual(t, int64(1), v)
+}
+
+func TestDecoderEmitRange(t *testing.T) {
+	body := `{
+	"a": {"b": {"c": {"d": [1, [2]]}}},
+	"e": [{"f": 2}, 3],
+	"g": 4
+}`
+
+	all, err := decodeAll(body, -1, nil)
+	assertNil(t, err)
+
+	for _, r := range [][2]int{{1, 3}, {0, 0}, {2, 2}, {3, 10}, {5, 6}} {
+		values, err := decodeAll(body, 0, func(d *jstream.Decoder) *jstream.Decoder {
+			return d.EmitRange(r[0], r[1])
+		})
+		assertNil(t, err)
+
+		// the same values as emitted recursively, restricted to the band
+		var expected []*jstream.MetaValue
+		for _, mv := range all {
+			if mv.Depth >= r[0] && mv.Depth <= r[1] {
+				expected = append(expected, mv)
+			}
+		}
+		if len(values) != len(expected) {
+			t.Fatalf("range %v: expected %d values, got %d", r, len(expected), len(values))
+		}
+		for i, mv := range values {
+			assertEqual(t, expected[i].Offset, mv.Offset)
+			assertEqual(t, expected[i].Depth, mv.Depth)
+			assertEqual(t, fmt.Sprint(expected[i].Value), fmt.Sprint(mv.Value))
+		}
+	}
+
+	// deeper values are still decoded within their containers
+	values, err := decodeAll(body, 0, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.EmitRange(1, 1)
+	})
+	assertNil(t, err)
+	assertEqual(t, 3, len(values))
+	assertEqual(t, "map[b:map[c:map[d:[1 [2]]]]]", fmt.Sprint(values[0].Value))
+
+	for _, r := range [][2]int{{2, 1}, {-1, 1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("range %v: expected panic", r)
+				}
+			}()
+			jstream.NewDecoder(mkReader(body), 0).EmitRange(r[0], r[1])
+		}()
+	}
+}
+
+func TestDecoderLine(t *testing.T) {
+	body := "{\n  \"a\": 1,\n  \"b\": [\n    true\n  ]\n}\n\n\"c\""
+
+	decoder := jstream.NewDecoder(strings.NewReader(body), -1)
+	var lines []int
+	for mv := range decoder.Stream() {
+		lines = append(lines, mv.Line)
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, "[2 4 3 1 8]", fmt.Sprint(lines))
+}
+
+func TestDecoderRefillBoundary(t *testing.T) {
+	// values ending on either side of the scanner's 4095-byte buffer refill,
+	// such that the byte following a number is read from the next fill
+	// before being stepped back over
+	values := []string{`12345`, `-6.5e+3`, `"str"`, `true`, `null`, `[7]`, `{"k":8}`}
+	for _, v := range values {
+		alone, err := decodeAll(v, 0, nil)
+		assertNil(t, err)
+		for pad := 4095 - len(v) - 3; pad <= 4095; pad++ {
+			for _, sep := range []string{",", " ,", "]"} {
+				body := "[" + strings.Repeat(" ", pad) + v + sep
+				if sep != "]" {
+					body += "0]"
+				}
+				decoded, err := decodeAll(body, 1, nil)
+				assertNil(t, err)
+				want := 2
+				if sep == "]" {
+					want = 1
+				}
+				if len(decoded) != want {
+					t.Fatalf("%q at offset %d: got %d values", v, pad+1, len(decoded))
+				}
+				assertEqual(t, v, body[decoded[0].Offset:decoded[0].Offset+decoded[0].Length])
+				assertEqual(t, fmt.Sprint(alone[0].Value), fmt.Sprint(decoded[0].Value))
+			}
+		}
+	}
+}
+
+// chunkReader returns at most n bytes per Read, such that the scanner
+// refills its buffer every n bytes
+type chunkReader struct {
+	data []byte
+	n    int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestDecoderSmallReads(t *testing.T) {
+	// numbers, literals and escapes straddling buffer refills at every
+	// position decode as when read at once, including where the decoder
+	// steps back across refills
+	bodies := []string{
+		`[12345, -6.5e+3, 0, 1e9, true, false, null, "a\nb", "é😀", "\\\"\/", {"k": -0.25}, [1,2]]`,
+		`{"keyA": 1234567890123, "n":1.5}`,
+		`"\ud83dA"`,
+		"[1,\r\n2,\r3]",
+		`7`,
+	}
+	invalid := []struct {
+		body    string
+		options func(*jstream.Decoder) *jstream.Decoder
+	}{
+		{`["ab\ud83dA"]`, (*jstream.Decoder).StrictUnicode},
+		{`["ab\ud83dx"]`, (*jstream.Decoder).StrictUnicode},
+		{"[\"ab\xe2\x82x\"]", (*jstream.Decoder).StrictUTF8},
+		{`[12345 6]`, nil},
+		{`[tru]`, nil},
+		{`[1.e5]`, nil},
+	}
+
+	decode := func(r io.Reader, options func(*jstream.Decoder) *jstream.Decoder) (string, error) {
+		decoder := jstream.NewDecoder(r, -1)
+		if options != nil {
+			decoder = options(decoder)
+		}
+		var got []string
+		err := decoder.Walk(func(mv *jstream.MetaValue) error {
+			got = append(got, fmt.Sprintf("%d+%d:%v", mv.Offset, mv.Length, mv.Value))
+			return nil
+		})
+		return strings.Join(got, " "), err
+	}
+
+	for _, body := range bodies {
+		want, err := decode(mkReader(body), nil)
+		assertNil(t, err)
+		for n := 1; n <= 7; n++ {
+			got, err := decode(&chunkReader{data: []byte(body), n: n}, nil)
+			assertNil(t, err)
+			if got != want {
+				t.Errorf("%q read %d bytes at a time: expected %s, got %s", body, n, want, got)
+			}
+		}
+	}
+	for _, test := range invalid {
+		_, want := decode(mkReader(test.body), test.options)
+		assertNotNil(t, want)
+		for n := 1; n <= 7; n++ {
+			_, err := decode(&chunkReader{data: []byte(test.body), n: n}, test.options)
+			if err == nil || errorLine(err) != errorLine(want) {
+				t.Errorf("%q read %d bytes at a time: expected %v, got %v", test.body, n, want, err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecoderWideObjects(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; i < 2000; i++ {
+		sb.WriteString("{")
+		for j := 0; j < 50; j++ {
+			if j > 0 {
+				sb.WriteString(",")
+			}
+			fmt.Fprintf(&sb, `"field%d":%d`, j, i)
+		}
+		sb.WriteString("}\n")
+	}
+	body := []byte(sb.String())
+
+	for _, kvs := range []bool{false, true} {
+		b.Run(fmt.Sprint("kvs=", kvs), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				decoder := jstream.NewDecoder(bytes.NewReader(body), 0)
+				if kvs {
+					decoder = decoder.ObjectAsKVS()
+				}
+				for range decoder.Stream() {
+				}
+			}
+		})
+	}
+}
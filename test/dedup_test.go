@@ -0,0 +1,92 @@
+package test
+
+import (
+	"fmt"
+	"hash"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+// constHash is a hash.Hash64 for which every input collides
+type constHash struct{}
+
+func (constHash) Write(p []byte) (int, error) { return len(p), nil }
+func (constHash) Sum(b []byte) []byte         { return append(b, 0) }
+func (constHash) Reset()                      {}
+func (constHash) Size() int                   { return 8 }
+func (constHash) BlockSize() int              { return 1 }
+func (constHash) Sum64() uint64               { return 42 }
+
+func dedupValues(t *testing.T, body string, depth int, options func(*jstream.Decoder) *jstream.Decoder) ([]interface{}, *jstream.Decoder) {
+	t.Helper()
+	decoder := options(jstream.NewDecoder(mkReader(body), depth))
+	var values []interface{}
+	for mv := range decoder.Stream() {
+		values = append(values, mv.Value)
+	}
+	assertNil(t, decoder.Err())
+	return values, decoder
+}
+
+func TestDecoderDedupWindow(t *testing.T) {
+	body := `{"id": 1}
+{"id": 2}
+   {"id": 1}
+{"id":1}
+{"id": 3}
+{"id": 2}
+{"id": 1}
+`
+	var warnings []*jstream.DuplicateError
+	values, decoder := dedupValues(t, body, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.DedupWindow(3, nil).OnWarning(func(err error) {
+			warnings = append(warnings, err.(*jstream.DuplicateError))
+		})
+	})
+
+	// surrounding whitespace is ignored, but not whitespace within a
+	// document; the final {"id": 1} has left the window
+	assertEqual(t, "[1 2 1 3 1]", fmt.Sprint(values))
+	assertEqual(t, 2, decoder.Stats().Duplicates)
+	assertEqual(t, 2, len(warnings))
+	assertEqual(t, int64(23), warnings[0].Offset)
+	assertEqual(t, int64(9), warnings[0].Length)
+	assertEqual(t, `{"id": 1}`, body[warnings[0].Offset:warnings[0].Offset+warnings[0].Length])
+	assertEqual(t, `{"id": 2}`, body[warnings[1].Offset:warnings[1].Offset+warnings[1].Length])
+}
+
+func TestDecoderDedupCollisions(t *testing.T) {
+	body := `1 2 1 3`
+	collide := func() hash.Hash64 { return constHash{} }
+
+	// every document collides with the first
+	values, decoder := dedupValues(t, body, 0, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.DedupWindow(8, collide)
+	})
+	assertEqual(t, "[1]", fmt.Sprint(values))
+	assertEqual(t, 3, decoder.Stats().Duplicates)
+
+	// comparing bytes makes the window exact
+	values, decoder = dedupValues(t, body, 0, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.DedupExact().DedupWindow(8, collide)
+	})
+	assertEqual(t, "[1 2 3]", fmt.Sprint(values))
+	assertEqual(t, 1, decoder.Stats().Duplicates)
+}
+
+func TestDecoderDedupLargeDocuments(t *testing.T) {
+	// documents spanning several scanner buffers
+	doc := `["` + strings.Repeat("a", 10000) + `", 1]`
+	other := `["` + strings.Repeat("a", 10000) + `", 2]`
+	body := doc + "\n" + other + "\n" + doc + "\n" + doc
+
+	values, decoder := dedupValues(t, body, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.DedupWindow(4, nil).DedupExact()
+	})
+	assertEqual(t, 4, len(values))
+	assertEqual(t, int64(1), values[1])
+	assertEqual(t, int64(2), values[3])
+	assertEqual(t, 2, decoder.Stats().Duplicates)
+}
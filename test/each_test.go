@@ -0,0 +1,72 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecodeEach(t *testing.T) {
+	body := `{"id": 1}
+{"id": 2, "extra": true}
+{"id": 3}
+`
+	type item struct{ ID int }
+
+	var ids []int
+	err := jstream.DecodeEach(jstream.NewDecoder(mkReader(body), 0), func(v item) error {
+		ids = append(ids, v.ID)
+		return nil
+	})
+	assertNil(t, err)
+	assertEqual(t, 3, len(ids))
+	assertEqual(t, 1, ids[0])
+	assertEqual(t, 3, ids[2])
+
+	// values of the target type are passed through
+	var names []string
+	err = jstream.DecodeEach(jstream.NewDecoder(mkReader(`["a", "b"]`), 1), func(v string) error {
+		names = append(names, v)
+		return nil
+	})
+	assertNil(t, err)
+	assertEqual(t, "b", names[1])
+
+	// strings decoded as []byte unmarshal as strings
+	type named struct{ Name string }
+	names = names[:0]
+	decoder := jstream.NewDecoder(mkReader(`[{"Name": "a"}, {"Name": "b\u00e9"}]`), 1).StringsAsBytes()
+	err = jstream.DecodeEach(decoder, func(v named) error {
+		names = append(names, v.Name)
+		return nil
+	})
+	assertNil(t, err)
+	assertEqual(t, "[a bé]", fmt.Sprint(names))
+
+	// with EmitKV, the value of each member is unmarshaled, as by DecodeStream
+	var ints []int
+	err = jstream.DecodeEach(jstream.NewDecoder(mkReader(`{"a": 1, "b": 2}`), 1).EmitKV(), func(v int) error {
+		ints = append(ints, v)
+		return nil
+	})
+	assertNil(t, err)
+	assertEqual(t, "[1 2]", fmt.Sprint(ints))
+
+	// errors from fn stop decoding
+	stop := errors.New("stop")
+	var calls int
+	err = jstream.DecodeEach(jstream.NewDecoder(mkReader(body), 0), func(v item) error {
+		calls++
+		return stop
+	})
+	assertEqual(t, stop, err)
+	assertEqual(t, 1, calls)
+
+	// as do values which cannot be unmarshaled into T
+	err = jstream.DecodeEach(jstream.NewDecoder(mkReader(`{"id": 1} {"id": "two"}`), 0), func(v item) error {
+		return nil
+	})
+	assertNotNil(t, err)
+}
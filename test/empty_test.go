@@ -0,0 +1,188 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderEmptyContainers(t *testing.T) {
+	tests := []struct {
+		body      string
+		recursive bool
+		want      string // emitted values, as "type:value"
+	}{
+		{`{"a":[]}`, false, "[5:[]]"},
+		{`{"a":[null]}`, false, "[5:[<nil>]]"},
+		{`{"a":[]}`, true, "[5:[]]"},
+		{`{"a":[null]}`, true, "[1:<nil> 5:[<nil>]]"},
+		{`{"a":{}}`, false, "[6:map[]]"},
+		{`{"a":{}}`, true, "[6:map[]]"},
+		{`[[], {}, [[]]]`, false, "[5:[] 6:map[] 5:[[]]]"},
+		{`[[], {}, [[]]]`, true, "[5:[] 6:map[] 5:[] 5:[[]]]"},
+	}
+
+	for _, test := range tests {
+		for _, ordered := range []bool{false, true} {
+			values, err := decodeAll(test.body, 1, func(d *jstream.Decoder) *jstream.Decoder {
+				if test.recursive {
+					d = d.Recursive()
+				}
+				if ordered {
+					d = d.ObjectAsKVS()
+				}
+				return d
+			})
+			assertNil(t, err)
+
+			var got []string
+			for _, mv := range values {
+				got = append(got, fmt.Sprintf("%d:%v", mv.ValueType, mv.Value))
+				// containers are empty rather than nil
+				switch v := mv.Value.(type) {
+				case []interface{}:
+					assertTrue(t, v != nil)
+				case map[string]interface{}:
+					assertTrue(t, v != nil)
+				case jstream.KVS:
+					assertTrue(t, v != nil)
+				}
+			}
+			want := test.want
+			if ordered {
+				want = strings.ReplaceAll(want, "map[]", "[]")
+			}
+			assertEqual(t, want, fmt.Sprint(got))
+		}
+	}
+}
+
+func TestDecoderEmptyInput(t *testing.T) {
+	// input holding no values is not an error
+	for _, body := range []string{"", "   ", " \n\t\r\n "} {
+		for _, depth := range []int{0, 1, -1} {
+			values, err := decodeAll(body, depth, nil)
+			assertNil(t, err)
+			assertEqual(t, 0, len(values))
+		}
+	}
+
+	// while input ending within a value is
+	for _, body := range []string{`{"a":`, `{"a"`, `{"a":1`, `{`, `[1,`, `[`, `"ab`, `"`, `tru`, `-`, `1.`, `1e`, `{"a": [1, {"b"`} {
+		for _, depth := range []int{0, 1, -1} {
+			_, err := decodeAll(body, depth, nil)
+			if !errors.Is(err, jstream.ErrUnexpectedEOF) {
+				t.Errorf("%q at depth %d: expected unexpected EOF, got %v", body, depth, err)
+			}
+		}
+	}
+}
+
+func TestDecoderLiteralsAtEOF(t *testing.T) {
+	literals := map[string]interface{}{
+		"true":  true,
+		"false": false,
+		"null":  nil,
+		"-12":   int64(-12),
+		`"s"`:   "s",
+		`""`:    "",
+	}
+	for lit, want := range literals {
+		// flush against the end of input, with the input ending on either
+		// side of a buffer refill, and read a few bytes at a time
+		for _, pad := range []int{0, 1, 4095 - len(lit) - 1, 4095 - len(lit), 4095 - len(lit) + 1} {
+			for _, body := range []string{strings.Repeat(" ", pad) + lit, "[" + strings.Repeat(" ", pad) + "1," + lit + "]"} {
+				depth := 0
+				if body[0] == '[' {
+					depth = 1
+				}
+				for _, n := range []int{1, 3, 4096} {
+					decoder := jstream.NewDecoder(&chunkReader{data: []byte(body), n: n}, depth)
+					values, err := decoder.ReadAll()
+					assertNil(t, err)
+					mv := values[len(values)-1]
+					assertEqual(t, want, mv.Value)
+					assertEqual(t, lit, body[mv.Offset:mv.Offset+mv.Length])
+				}
+			}
+		}
+
+		// truncated, both at the top level and as the last array element
+		for i := 1; i < len(lit); i++ {
+			for _, body := range []string{lit[:i], "[1, " + lit[:i]} {
+				if json.Valid([]byte(body)) {
+					continue // a shorter number
+				}
+				_, err := decodeAll(body, 0, nil)
+				if !errors.Is(err, jstream.ErrUnexpectedEOF) {
+					t.Errorf("%q: expected unexpected EOF, got %v", body, err)
+				}
+			}
+		}
+	}
+
+	// invalid characters within literals are reported as such, even near
+	// the end of input
+	for _, body := range []string{`fxx`, `tx`, `nulx`, `-x`} {
+		_, err := decodeAll(body, 0, nil)
+		if err == nil || errors.Is(err, jstream.ErrUnexpectedEOF) {
+			t.Errorf("%q: expected syntax error, got %v", body, err)
+		}
+	}
+}
+
+func TestDecoderTruncated(t *testing.T) {
+	doc := `{"a": [1, 2.5, {"b": "c\"d", "e": [true, false, null]}], "f": {}, "g": [], "h": {"i": -3e2}}`
+	modes := map[string]func(*jstream.Decoder) *jstream.Decoder{
+		"default":   nil,
+		"kv":        (*jstream.Decoder).EmitKV,
+		"kvs":       (*jstream.Decoder).ObjectAsKVS,
+		"strict":    (*jstream.Decoder).Strict,
+		"raw":       (*jstream.Decoder).RawStrings,
+		"offsets":   (*jstream.Decoder).OffsetsOnly,
+		"recursive": (*jstream.Decoder).Recursive,
+		"comments":  (*jstream.Decoder).AllowComments,
+		"filtered":  func(d *jstream.Decoder) *jstream.Decoder { return d.FilterKeys("h") },
+	}
+
+	// every prefix of a document, alone or followed by a complete one, is
+	// either valid or reported as ending unexpectedly
+	for _, body := range []string{doc, "[" + doc + ", " + doc + "]", doc + "\n" + doc} {
+		for i := 1; i < len(body); i++ {
+			prefix := body[:i]
+			if json.Valid([]byte(prefix)) {
+				continue
+			}
+			dec := json.NewDecoder(strings.NewReader(prefix))
+			var err error
+			for err == nil {
+				var v interface{}
+				err = dec.Decode(&v)
+			}
+			if err.Error() == "EOF" {
+				continue // a sequence of complete documents
+			}
+
+			for name, options := range modes {
+				for _, depth := range []int{0, 1, 2, -1} {
+					_, err := decodeAll(prefix, depth, options)
+					if !errors.Is(err, io.ErrUnexpectedEOF) {
+						t.Errorf("%s at depth %d, %q: expected unexpected EOF, got %v", name, depth, prefix, err)
+					}
+				}
+			}
+			_, err = jstream.NewDecoder(&chunkReader{data: []byte(prefix), n: 1}, 1).ReadAll()
+			if !errors.Is(err, jstream.ErrUnexpectedEOF) {
+				t.Errorf("read bytewise, %q: expected unexpected EOF, got %v", prefix, err)
+			}
+			if _, err = jstream.Split(mkReader(prefix), 1); err == nil {
+				t.Errorf("split %q: expected error", prefix)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+const encoderBody = `{"z": 1, "a": {"y": [true, null, {"c": "<&>", "b": 2.5}], "x": "é\n"}}
+[3, "four", {"k": {}}]
+"five"`
+
+func encodeAll(t *testing.T, body string, depth int, array bool) string {
+	var out bytes.Buffer
+	encoder := jstream.NewEncoder(&out)
+	if array {
+		encoder = encoder.Array()
+	}
+	decoder := jstream.NewDecoder(strings.NewReader(body), depth).ObjectAsKVS()
+	for mv := range decoder.Stream() {
+		assertNil(t, encoder.Encode(mv))
+	}
+	assertNil(t, decoder.Err())
+	assertNil(t, encoder.Close())
+	return out.String()
+}
+
+func TestEncoderNDJSON(t *testing.T) {
+	out := encodeAll(t, encoderBody, 0, false)
+	want := `{"z":1,"a":{"y":[true,null,{"c":"<&>","b":2.5}],"x":"é\n"}}` + "\n" +
+		`[3,"four",{"k":{}}]` + "\n" +
+		`"five"` + "\n"
+	assertEqual(t, want, out)
+
+	// re-decoding the output yields the same values, in the same order
+	original, err := decodeAll(encoderBody, -1, (*jstream.Decoder).ObjectAsKVS)
+	assertNil(t, err)
+	decoded, err := decodeAll(out, -1, func(d *jstream.Decoder) *jstream.Decoder { return d.ObjectAsKVS().NDJSON() })
+	assertNil(t, err)
+	assertEqual(t, len(original), len(decoded))
+	for i := range original {
+		assertEqual(t, fmt.Sprint(original[i].Value), fmt.Sprint(decoded[i].Value))
+		assertEqual(t, fmt.Sprint(original[i].Keys), fmt.Sprint(decoded[i].Keys))
+	}
+}
+
+func TestEncoderArray(t *testing.T) {
+	out := encodeAll(t, encoderBody, 1, true)
+	want := `[1,{"y":[true,null,{"c":"<&>","b":2.5}],"x":"é\n"},3,"four",{"k":{}}]` + "\n"
+	assertEqual(t, want, out)
+
+	assertEqual(t, "[]\n", encodeAll(t, `"scalar"`, 1, true))
+	assertEqual(t, "", encodeAll(t, `"scalar"`, 1, false))
+}
+
+func TestEncoderClosed(t *testing.T) {
+	var out bytes.Buffer
+	encoder := jstream.NewEncoder(&out).Array()
+	assertNil(t, encoder.Encode(&jstream.MetaValue{Value: int64(1)}))
+	assertNil(t, encoder.Close())
+	assertNil(t, encoder.Close())
+	assertTrue(t, errors.Is(encoder.Encode(&jstream.MetaValue{Value: int64(2)}), jstream.ErrEncoderClosed))
+	assertEqual(t, "[1]\n", out.String())
+}
+
+func TestEncoderArrayStartEnd(t *testing.T) {
+	var out bytes.Buffer
+	encoder := jstream.NewEncoder(&out)
+	assertNil(t, encoder.Encode("line"))
+	assertNil(t, encoder.EncodeArrayStart())
+	assertNotNil(t, encoder.EncodeArrayStart())
+	assertNil(t, encoder.Encode(int64(1)))
+	assertNil(t, encoder.Encode(jstream.KV{Key: "k", Value: jstream.KVS{{Key: "b", Value: nil}, {Key: "a", Value: true}}}))
+	assertNil(t, encoder.EncodeArrayEnd())
+	assertNotNil(t, encoder.EncodeArrayEnd())
+	assertNil(t, encoder.EncodeArrayStart())
+	assertNil(t, encoder.Close())
+	assertEqual(t, "\"line\"\n[1,{\"key\":\"k\",\"value\":{\"b\":null,\"a\":true}}]\n[]\n", out.String())
+}
+
+func TestEncoderMatchesMarshal(t *testing.T) {
+	values := []interface{}{
+		"plain", "<&>", "quote\" backslash\\ slash/", "\x00\x1f\t\r\n", "\u2028\u2029", "日本語",
+		1.5, -2.25, 1e21, 1e-6, 1e-7, 123456789.125, -1.5e-10, 5e300,
+		int64(-9223372036854775808), true, nil,
+		[]interface{}{}, map[string]interface{}{"b": 1.5, "a": []interface{}{"x"}},
+		struct{ A string }{"<b>"},
+	}
+	for _, v := range values {
+		var out bytes.Buffer
+		assertNil(t, jstream.NewEncoder(&out).Encode(v))
+
+		var want bytes.Buffer
+		enc := json.NewEncoder(&want)
+		enc.SetEscapeHTML(false)
+		assertNil(t, enc.Encode(v))
+		assertEqual(t, want.String(), out.String())
+	}
+
+	// invalid UTF-8 is replaced, as its encoding varies between releases
+	var out bytes.Buffer
+	encoder := jstream.NewEncoder(&out)
+	assertNil(t, encoder.Encode("invalid \xff utf-8"))
+	var s string
+	assertNil(t, json.Unmarshal(out.Bytes(), &s))
+	assertEqual(t, "invalid \ufffd utf-8", s)
+
+	out.Reset()
+	assertNotNil(t, encoder.Encode(math.Inf(1)))
+	assertEqual(t, 0, out.Len())
+	assertNil(t, encoder.Encode(int64(1)))
+	assertEqual(t, "1\n", out.String())
+}
+
+func TestEncoderFloats(t *testing.T) {
+	const body = `[3.0, 3, -0.0, 1e20, 1e21, 2.5, {"f": 1E2, "i": 100}]`
+	out := encodeAll(t, body, 1, true)
+	assertEqual(t, `[3.0,3,-0.0,100000000000000000000.0,1e+21,2.5,{"f":100.0,"i":100}]`+"\n", out)
+
+	// re-decoding the output yields values of the same types
+	original, err := decodeAll(body, -1, (*jstream.Decoder).ObjectAsKVS)
+	assertNil(t, err)
+	decoded, err := decodeAll(out, -1, (*jstream.Decoder).ObjectAsKVS)
+	assertNil(t, err)
+	assertEqual(t, len(original), len(decoded))
+	for i := range original {
+		assertEqual(t, original[i].ValueType, decoded[i].ValueType)
+		assertEqual(t, fmt.Sprintf("%T %v", original[i].Value, original[i].Value), fmt.Sprintf("%T %v", decoded[i].Value, decoded[i].Value))
+	}
+}
+
+func TestEncoderPipe(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("[")
+	for i := 0; i < 2000; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `{"id":%d,"name":"item \"%d\"","tags":["a","b",{"z":null,"y":%d.5}],"ok":true}`, i, i, i)
+	}
+	b.WriteString("]")
+	body := b.String()
+
+	pr, pw := io.Pipe()
+	go func() {
+		encoder := jstream.NewEncoder(pw).Array()
+		decoder := jstream.NewDecoder(strings.NewReader(body), 1).ObjectAsKVS()
+		for mv := range decoder.Stream() {
+			if err := encoder.Encode(mv); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		if err := decoder.Err(); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(encoder.Close())
+	}()
+
+	decoder := jstream.NewDecoder(pr, -1).ObjectAsKVS()
+	var count int
+	var top interface{}
+	for mv := range decoder.Stream() {
+		count++
+		top = mv.Value
+	}
+	assertNil(t, decoder.Err())
+
+	original, err := decodeAll(body, -1, (*jstream.Decoder).ObjectAsKVS)
+	assertNil(t, err)
+	assertEqual(t, len(original), count)
+
+	out, err := json.Marshal(top.([]interface{}))
+	assertNil(t, err)
+	assertEqual(t, body, string(out))
+}
@@ -0,0 +1,204 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/xenking/jstream"
+)
+
+type textEncoding struct {
+	name   string
+	bom    []byte
+	encode func(s string) []byte
+	decode func(b []byte) string
+}
+
+var textEncodings = []textEncoding{
+	{"UTF-16LE", []byte{0xFF, 0xFE}, encodeUTF16(binary.LittleEndian), decodeUTF16(binary.LittleEndian)},
+	{"UTF-16BE", []byte{0xFE, 0xFF}, encodeUTF16(binary.BigEndian), decodeUTF16(binary.BigEndian)},
+	{"UTF-32LE", []byte{0xFF, 0xFE, 0, 0}, encodeUTF32(binary.LittleEndian), decodeUTF32(binary.LittleEndian)},
+	{"UTF-32BE", []byte{0, 0, 0xFE, 0xFF}, encodeUTF32(binary.BigEndian), decodeUTF32(binary.BigEndian)},
+}
+
+func encodeUTF16(order binary.ByteOrder) func(string) []byte {
+	return func(s string) []byte {
+		units := utf16.Encode([]rune(s))
+		b := make([]byte, 2*len(units))
+		for i, u := range units {
+			order.PutUint16(b[2*i:], u)
+		}
+		return b
+	}
+}
+
+func decodeUTF16(order binary.ByteOrder) func([]byte) string {
+	return func(b []byte) string {
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = order.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+}
+
+func encodeUTF32(order binary.ByteOrder) func(string) []byte {
+	return func(s string) []byte {
+		runes := []rune(s)
+		b := make([]byte, 4*len(runes))
+		for i, r := range runes {
+			order.PutUint32(b[4*i:], uint32(r))
+		}
+		return b
+	}
+}
+
+func decodeUTF32(order binary.ByteOrder) func([]byte) string {
+	return func(b []byte) string {
+		var sb strings.Builder
+		for i := 0; i+4 <= len(b); i += 4 {
+			sb.WriteRune(rune(order.Uint32(b[i:])))
+		}
+		return sb.String()
+	}
+}
+
+const encodedBody = `{"name": "Zoë", "tags": ["日本", "😀", "plain"], "n": [1, -2.5, true, null]}
+["second", {"k": "v"}]`
+
+func TestDecoderDetectEncoding(t *testing.T) {
+	want, err := decodeAll(encodedBody, -1, nil)
+	assertNil(t, err)
+
+	for _, enc := range textEncodings {
+		for _, withBOM := range []bool{true, false} {
+			src := enc.encode(encodedBody)
+			if withBOM {
+				src = append(append([]byte{}, enc.bom...), src...)
+			}
+			for _, r := range []io.Reader{bytes.NewReader(src), iotest.OneByteReader(bytes.NewReader(src))} {
+				decoder := jstream.NewDecoder(r, -1)
+				var got []*jstream.MetaValue
+				for mv := range decoder.Stream() {
+					got = append(got, mv)
+				}
+				assertNil(t, decoder.Err())
+				if len(got) != len(want) {
+					t.Fatalf("%s: expected %d values, got %d", enc.name, len(want), len(got))
+				}
+
+				for i, mv := range got {
+					assertEqual(t, fmt.Sprint(want[i].Value), fmt.Sprint(mv.Value))
+					// offsets refer to the encoded source
+					raw := enc.decode(src[mv.Offset : mv.Offset+mv.Length])
+					assertEqual(t, encodedBody[want[i].Offset:want[i].Offset+want[i].Length], raw)
+				}
+				assertEqual(t, int64(len(src)), decoder.BytesConsumed())
+			}
+		}
+	}
+}
+
+func TestDecoderDetectEncodingLarge(t *testing.T) {
+	// offsets remain accurate well beyond the first buffer fills
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 20000; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, `{"id": %d, "s": "ü€😀"}`, i)
+	}
+	sb.WriteString("]")
+	body := sb.String()
+
+	for _, enc := range textEncodings[:2] {
+		src := append(append([]byte{}, enc.bom...), enc.encode(body)...)
+		decoder := jstream.NewDecoder(bytes.NewReader(src), 1)
+		var count int
+		for mv := range decoder.Stream() {
+			raw := enc.decode(src[mv.Offset : mv.Offset+mv.Length])
+			assertEqual(t, fmt.Sprintf(`{"id": %d, "s": "ü€😀"}`, count), raw)
+			count++
+		}
+		assertNil(t, decoder.Err())
+		assertEqual(t, 20000, count)
+	}
+}
+
+func TestDecoderDetectEncodingInvalid(t *testing.T) {
+	// unpaired surrogates and a truncated code unit decode as U+FFFD
+	src := []byte{0xFF, 0xFE, '"', 0, 0x00, 0xD8, 'a', 0, 0x00, 0xDC, '"', 0, 0x20}
+	values, err := decodeStrings(bytes.NewReader(src), 0, func(d *jstream.Decoder) *jstream.Decoder { return d })
+	assertEqual(t, 1, len(values))
+	assertEqual(t, "�a�", values[0])
+	assertNotNil(t, err) // the trailing partial code unit
+
+	// UTF-8 input, including that beginning with a short value, is unaffected
+	for _, body := range []string{"1", "12", `"é"`, "\xef\xbb\xbf[1]"} {
+		values, err := decodeAll(body, 0, nil)
+		assertNil(t, err)
+		assertEqual(t, 1, len(values))
+		assertTrue(t, utf8.ValidString(fmt.Sprint(values[0].Value)))
+	}
+}
+
+func TestDecoderDetectEncodingElements(t *testing.T) {
+	// elements found by splitting the input, rather than decoding it, are
+	// also positioned within the encoded source
+	body := `[{"a": "Zoë"}, [1, 2], "x😀", 3]`
+	want, err := decodeAll(body, 1, nil)
+	assertNil(t, err)
+
+	for _, enc := range textEncodings[:2] {
+		src := append(append([]byte{}, enc.bom...), enc.encode(body)...)
+		raw := func(offset, length int64) string { return enc.decode(src[offset : offset+length]) }
+
+		segs, err := jstream.Split(bytes.NewReader(src), 1)
+		assertNil(t, err)
+		assertEqual(t, len(want), len(segs))
+		for i, seg := range segs {
+			assertEqual(t, body[want[i].Offset:want[i].Offset+want[i].Length], raw(seg.Offset, seg.Length))
+		}
+
+		decoder := jstream.NewDecoder(bytes.NewReader(src), 1).Ordered()
+		var i int
+		for mv := range decoder.StreamParallel(2) {
+			assertEqual(t, fmt.Sprint(want[i].Value), fmt.Sprint(mv.Value))
+			assertEqual(t, body[want[i].Offset:want[i].Offset+want[i].Length], raw(mv.Offset, mv.Length))
+			i++
+		}
+		assertNil(t, decoder.Err())
+		assertEqual(t, len(want), i)
+	}
+}
+
+func BenchmarkDecoderEncodings(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&sb, `{"id":%d,"name":"user %d","tags":["a","b"],"score":%d.5}`+"\n", i, i, i)
+	}
+	body := sb.String()
+
+	run := func(name string, data []byte) {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				for range jstream.NewDecoder(bytes.NewReader(data), 0).Stream() {
+				}
+			}
+		})
+	}
+	run("UTF-8", []byte(body))
+	for _, enc := range textEncodings {
+		run(enc.name, append(append([]byte{}, enc.bom...), enc.encode(body)...))
+	}
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestSyntaxErrorAs(t *testing.T) {
+	decoder := jstream.NewDecoder(mkReader("[1,\n {\"a\": x}]"), 1)
+	for range decoder.Stream() {
+	}
+	err := decoder.Err()
+
+	var serr jstream.SyntaxError
+	assertTrue(t, errors.As(err, &serr))
+	assertEqual(t, 2, serr.Line)
+	assertEqual(t, 8, serr.Column)
+	assertEqual(t, int64(11), serr.Offset)
+	assertEqual(t, byte('x'), serr.AtChar)
+	assertEqual(t, "looking for beginning of value", serr.Context)
+	assertTrue(t, errors.Is(err, jstream.ErrSyntax))
+	assertFalse(t, errors.Is(err, jstream.ErrUnexpectedEOF))
+	assertFalse(t, errors.Is(err, io.ErrUnexpectedEOF))
+
+	// Err reports the SyntaxError itself, its Offset locating the byte
+	body := "[1,\n {\"a\": x}]"
+	serr, ok := err.(jstream.SyntaxError)
+	assertTrue(t, ok)
+	assertEqual(t, byte(body[serr.Offset]), serr.AtChar)
+	assertEqual(t, int64(decoder.BytesConsumed()), serr.Offset+1)
+
+	// input ending within a value
+	_, err = decodeAll(`{"a": [1, 2`, 1, nil)
+	assertTrue(t, errors.As(err, &serr))
+	assertEqual(t, int64(11), serr.Offset)
+	assertEqual(t, byte(0), serr.AtChar)
+	assertTrue(t, errors.Is(err, jstream.ErrUnexpectedEOF))
+	assertTrue(t, errors.Is(err, io.ErrUnexpectedEOF))
+	assertFalse(t, errors.Is(err, jstream.ErrSyntax))
+
+	// data following a single document
+	_, err = decodeAll(`[1] 2`, 0, (*jstream.Decoder).SingleDocument)
+	assertTrue(t, errors.Is(err, jstream.ErrTrailingData))
+	assertTrue(t, errors.As(err, &serr))
+	assertEqual(t, int64(4), serr.Offset)
+
+	// syntax errors wrapped by other errors
+	decoder = jstream.NewDecoder(mkReader(`[1, {"a": 2,}]`), 1)
+	for range decoder.StreamParallel(2) {
+	}
+	var eerr *jstream.ElementError
+	assertTrue(t, errors.As(decoder.Err(), &eerr))
+	assertTrue(t, errors.As(decoder.Err(), &serr))
+	assertEqual(t, int64(12), serr.Offset)
+	assertEqual(t, 1, serr.Line)
+	assertEqual(t, 9, serr.Column)
+	assertTrue(t, errors.Is(decoder.Err(), jstream.ErrSyntax))
+}
+
+func TestSyntaxErrorFields(t *testing.T) {
+	// callers read where decoding failed from the fields of the error
+	// reported by Err, without parsing its message
+	body := "{\"a\": 1,\n \"b\": [true, nul]}"
+	decoder := jstream.NewDecoder(mkReader(body), 1)
+	for range decoder.Stream() {
+	}
+	serr, ok := decoder.Err().(jstream.SyntaxError)
+	assertTrue(t, ok)
+	assertEqual(t, 2, serr.Line)
+	assertEqual(t, 17, serr.Column)
+	assertEqual(t, int64(25), serr.Offset)
+	assertEqual(t, byte(']'), serr.AtChar)
+	assertEqual(t, "in literal null", serr.Context)
+	assertEqual(t, body, string(serr.Snippet))
+	assertEqual(t, byte(']'), serr.Snippet[serr.SnippetPos])
+}
@@ -0,0 +1,98 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderAutoGzip(t *testing.T) {
+	body := "[{\"a\": 1}, \"two\",\n [3, 4.5], null]\n{\"b\": true}"
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(body))
+	assertNil(t, err)
+	assertNil(t, zw.Close())
+
+	want, err := decodeAll(body, -1, nil)
+	assertNil(t, err)
+
+	// compressed and plain input decode alike, with offsets within the
+	// decompressed input
+	for _, input := range [][]byte{buf.Bytes(), []byte(body)} {
+		decoder, err := jstream.NewDecoderAuto(bytes.NewReader(input), -1)
+		assertNil(t, err)
+		got, err := decoder.ReadAll()
+		assertNil(t, err)
+		assertEqual(t, len(want), len(got))
+		for i := range want {
+			assertEqual(t, want[i].Offset, got[i].Offset)
+			assertEqual(t, want[i].Length, got[i].Length)
+			assertEqual(t, want[i].Line, got[i].Line)
+			raw := body[got[i].Offset : got[i].Offset+got[i].Length]
+			values, err := decodeAll(raw, 0, nil)
+			assertNil(t, err)
+			assertEqual(t, want[i].ValueType, values[0].ValueType)
+		}
+		assertEqual(t, int64(len(body)), decoder.BytesConsumed())
+	}
+
+	// input too short to hold the magic number
+	for _, body := range []string{"", "1"} {
+		decoder, err := jstream.NewDecoderAuto(mkReader(body), 0)
+		assertNil(t, err)
+		values, err := decoder.ReadAll()
+		assertNil(t, err)
+		assertEqual(t, len(body), len(values))
+	}
+
+	// an invalid gzip header
+	_, err = jstream.NewDecoderAuto(mkReader("\x1f\x8bxx"), 0)
+	assertNotNil(t, err)
+}
+
+func TestDecoderAutoGzipTruncated(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&sb, `{"id": %d, "name": "item %d"},`, i, i*7919)
+	}
+	sb.WriteString("null]")
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(sb.String()))
+	assertNil(t, err)
+	assertNil(t, zw.Close())
+	truncated := buf.Bytes()[:buf.Len()/2]
+
+	// decoding ends where the stream is cut, with Err reporting the
+	// error from decompressing rather than a syntax error
+	decoder, err := jstream.NewDecoderAuto(bytes.NewReader(truncated), 1)
+	assertNil(t, err)
+	var count int
+	for range decoder.Stream() {
+		count++
+	}
+	assertTrue(t, count > 0)
+	assertEqual(t, io.ErrUnexpectedEOF, decoder.Err())
+
+	decoder, err = jstream.NewDecoderAuto(bytes.NewReader(truncated), 1)
+	assertNil(t, err)
+	assertEqual(t, io.ErrUnexpectedEOF, decoder.Walk(func(*jstream.MetaValue) error { return nil }))
+
+	// as for values read one at a time
+	decoder, err = jstream.NewDecoderAuto(bytes.NewReader(truncated), 1)
+	assertNil(t, err)
+	for {
+		var v interface{}
+		if err = decoder.DecodeNext(&v); err != nil {
+			break
+		}
+	}
+	assertEqual(t, io.ErrUnexpectedEOF, err)
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xenking/jstream"
+)
+
+type cents int64
+
+func parseTime(raw []byte, t jstream.ValueType) (interface{}, error) {
+	s, err := strconv.Unquote(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func parseCents(raw []byte, t jstream.ValueType) (interface{}, error) {
+	if t != jstream.Number {
+		return nil, fmt.Errorf("amount is a %v", t)
+	}
+	whole, frac, _ := strings.Cut(string(raw), ".")
+	n, err := strconv.ParseInt(whole+(frac + "00")[:2], 10, 64)
+	return cents(n), err
+}
+
+func TestDecoderHooks(t *testing.T) {
+	body := `{
+	"timestamp": "2024-01-02T03:04:05Z",
+	"orders": [
+		{"amount": 12.5, "meta": {"timestamp": "2024-02-03T04:05:06Z"}},
+		{"amount": 3, "lines": [{"amount": 0.99}]}
+	],
+	"total": {"amount": 16.49}
+}`
+
+	values, err := decodeAll(body, 0, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.RegisterHook("**.timestamp", parseTime).
+			RegisterHook("orders.*.amount", parseCents).
+			RegisterHook("**.lines.*", func(raw []byte, t jstream.ValueType) (interface{}, error) {
+				return string(raw), nil
+			})
+	})
+	assertNil(t, err)
+	assertEqual(t, 1, len(values))
+
+	root := values[0].Value.(map[string]interface{})
+	ts, ok := root["timestamp"].(time.Time)
+	assertTrue(t, ok)
+	assertEqual(t, 2024, ts.Year())
+
+	orders := root["orders"].([]interface{})
+	first := orders[0].(map[string]interface{})
+	assertEqual(t, cents(1250), first["amount"])
+	_, ok = first["meta"].(map[string]interface{})["timestamp"].(time.Time)
+	assertTrue(t, ok)
+	second := orders[1].(map[string]interface{})
+	assertEqual(t, cents(300), second["amount"])
+	assertEqual(t, `{"amount": 0.99}`, second["lines"].([]interface{})[0])
+
+	// only the matched path is hooked
+	assertEqual(t, 16.49, root["total"].(map[string]interface{})["amount"])
+}
+
+func TestDecoderHooksEmitted(t *testing.T) {
+	// hooked values are emitted, as members with EmitKV, in place of the
+	// default decoding
+	body := `[{"ts": "2024-01-02T03:04:05Z"}, {"ts": "2025-01-02T03:04:05Z"}]`
+	values, err := decodeAll(body, 2, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.EmitKV().RegisterHook("*.ts", parseTime)
+	})
+	assertNil(t, err)
+	assertEqual(t, 2, len(values))
+	kv := values[1].Value.(jstream.KV)
+	assertEqual(t, 2025, kv.Value.(time.Time).Year())
+	assertEqual(t, jstream.String, kv.ValueType)
+
+	// with the empty pattern, whole documents
+	values, err = decodeAll(`{"a": 1} [2]`, 0, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.RegisterHook("", func(raw []byte, t jstream.ValueType) (interface{}, error) {
+			return len(raw), nil
+		})
+	})
+	assertNil(t, err)
+	assertEqual(t, 2, len(values))
+	assertEqual(t, 8, values[0].Value)
+	assertEqual(t, jstream.Array, values[1].ValueType)
+}
+
+func TestDecoderHookError(t *testing.T) {
+	body := "[\n{\"amount\": 1},\n{\"amount\": \"one\"}]"
+	_, err := decodeAll(body, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.RegisterHook("*.amount", parseCents)
+	})
+
+	var herr *jstream.HookError
+	assertTrue(t, errors.As(err, &herr))
+	assertEqual(t, int64(strings.Index(body, `"one"`)), herr.Offset)
+	assertEqual(t, 3, herr.Line)
+	assertEqual(t, "//amount", jstream.FormatPath(herr.Keys))
+	assertEqual(t, `jstream: hook for //amount failed at offset 28, line 3: amount is a string`, err.Error())
+}
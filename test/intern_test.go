@@ -0,0 +1,133 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/xenking/jstream"
+)
+
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestDecoderInternKeys(t *testing.T) {
+	body := `{"id": 1, "name": "a"}` + "\n" + `{"id": 2, "name": "b"}` + "\n" + `{"name": "c", "id": 3}`
+
+	for _, intern := range []bool{false, true} {
+		decoder := jstream.NewDecoder(mkReader(body), 1).EmitKV()
+		if intern {
+			decoder = decoder.InternKeys()
+		}
+		ids := map[uintptr]bool{}
+		var n int
+		for mv := range decoder.Stream() {
+			kv := mv.Value.(jstream.KV)
+			if kv.Key == "id" {
+				ids[stringData(kv.Key)] = true
+				assertEqual(t, "id", mv.Keys[0])
+				n++
+			}
+		}
+		assertNil(t, decoder.Err())
+		assertEqual(t, 3, n)
+		assertEqual(t, intern, len(ids) == 1)
+	}
+}
+
+func TestDecoderInternKeysEscaped(t *testing.T) {
+	// keys are interned in their decoded form, however they are escaped
+	body := `{"caf\u00e9": 1, "a\"b": 2}` + "\n" + `{"café": 3, "a\u0022b": 4, "a\\\"b": 5}`
+	decoder := jstream.NewDecoder(mkReader(body), 1).EmitKV().InternKeys()
+	var keys []string
+	data := map[string]map[uintptr]bool{}
+	for mv := range decoder.Stream() {
+		k := mv.Value.(jstream.KV).Key
+		keys = append(keys, k)
+		if data[k] == nil {
+			data[k] = map[uintptr]bool{}
+		}
+		data[k][stringData(k)] = true
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, `[café a"b café a"b a\"b]`, fmt.Sprint(keys))
+	assertEqual(t, 3, len(data))
+	for _, ptrs := range data {
+		assertEqual(t, 1, len(ptrs))
+	}
+}
+
+func TestDecoderInternKeysAllocs(t *testing.T) {
+	const n = 1000
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		sb.WriteString(`{"id":1,"name":"n","timestamp":2}` + "\n")
+	}
+	body := []byte(sb.String())
+
+	allocs := func(intern bool) float64 {
+		return testing.AllocsPerRun(5, func() {
+			decoder := jstream.NewDecoder(bytes.NewReader(body), 1).EmitKV()
+			if intern {
+				decoder = decoder.InternKeys()
+			}
+			decoder.Walk(func(*jstream.MetaValue) error { return nil })
+		})
+	}
+	without, with := allocs(false), allocs(true)
+	// three keys per object are no longer allocated
+	if without-with < 2*n {
+		t.Fatalf("expected interning to save at least %d allocations, got %v without and %v with", 2*n, without, with)
+	}
+}
+
+func TestDecoderInternKeysBounded(t *testing.T) {
+	// keys beyond the bounds of the table are decoded as usual
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&sb, `"key%d": %d, `, i, i)
+	}
+	fmt.Fprintf(&sb, `"%s": 0}`, strings.Repeat("long", 100))
+
+	decoder := jstream.NewDecoder(mkReader(sb.String()), 1).EmitKV().InternKeys()
+	var n int
+	for mv := range decoder.Stream() {
+		kv := mv.Value.(jstream.KV)
+		if n < 5000 {
+			assertEqual(t, fmt.Sprintf("key%d", n), kv.Key)
+		} else {
+			assertEqual(t, strings.Repeat("long", 100), kv.Key)
+		}
+		n++
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 5001, n)
+}
+
+func BenchmarkDecoderInternKeys(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&sb, `{"id":%d,"name":"n","ts":%d}`+"\n", i, i)
+	}
+	body := []byte(sb.String())
+
+	for _, intern := range []bool{false, true} {
+		b.Run(fmt.Sprint(intern), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				decoder := jstream.NewDecoder(bytes.NewReader(body), 0).ObjectAsKVS()
+				if intern {
+					decoder = decoder.InternKeys()
+				}
+				for range decoder.Stream() {
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderEmitKeysSeparately(t *testing.T) {
+	body := `{"a": 1, "bc": "x", "d": [true]}`
+	values, err := decodeAll(body, 1, (*jstream.Decoder).EmitKeysSeparately)
+	assertNil(t, err)
+
+	expected := []struct {
+		value     interface{}
+		valueType jstream.ValueType
+		offset    int64
+		length    int64
+	}{
+		{"a", jstream.String, 1, 3},
+		{int64(1), jstream.Number, 6, 1},
+		{"bc", jstream.String, 9, 4},
+		{"x", jstream.String, 15, 3},
+		{"d", jstream.String, 20, 3},
+		{[]interface{}{true}, jstream.Array, 25, 6},
+	}
+	if len(values) != len(expected) {
+		t.Fatalf("expected %d values, got %d", len(expected), len(values))
+	}
+	for i, mv := range values {
+		assertEqual(t, fmt.Sprint(expected[i].value), fmt.Sprint(mv.Value))
+		assertEqual(t, expected[i].valueType, mv.ValueType)
+		assertEqual(t, expected[i].offset, mv.Offset)
+		assertEqual(t, expected[i].length, mv.Length)
+		assertEqual(t, 1, mv.Depth)
+	}
+
+	// keys of values not emitted, and within arrays, are not emitted
+	values, err = decodeAll(`[{"a": 1}, {"b": 2}]`, 1, (*jstream.Decoder).EmitKeysSeparately)
+	assertNil(t, err)
+	assertEqual(t, 2, len(values))
+
+	values, err = decodeAll(`{"a": 1, "b": 2}`, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.EmitKeysSeparately().FilterKeys("b")
+	})
+	assertNil(t, err)
+	assertEqual(t, "[b 2]", fmt.Sprint([]interface{}{values[0].Value, values[1].Value}))
+
+	// EmitKV carries the key in its KVs
+	values, err = decodeAll(`{"a": 1}`, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.EmitKeysSeparately().EmitKV()
+	})
+	assertNil(t, err)
+	assertEqual(t, 1, len(values))
+}
@@ -0,0 +1,132 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderObjectAsKVSNested(t *testing.T) {
+	values, err := decodeAll(`{"a":{"b":1}}`, 0, (*jstream.Decoder).ObjectAsKVS)
+	assertNil(t, err)
+	assertEqual(t, 1, len(values))
+
+	kvs, ok := values[0].Value.(jstream.KVS)
+	assertTrue(t, ok)
+	assertEqual(t, "a", kvs[0].Key)
+	inner, ok := kvs[0].Value.(jstream.KVS)
+	assertTrue(t, ok)
+	assertEqual(t, "b", inner[0].Key)
+	assertEqual(t, int64(1), inner[0].Value)
+}
+
+func TestDecoderObjectAsKVSRoundTrip(t *testing.T) {
+	body := `{"z":1,"y":{"x":[{"w":2,"v":{"u":3,"t":{}}},[{"s":null,"r":"q"}]],"p":true},"o":{"n\"m":"é"}}`
+
+	for _, depth := range []int{0, 1, -1} {
+		decoder := jstream.NewDecoder(strings.NewReader(body), depth).ObjectAsKVS()
+		for mv := range decoder.Stream() {
+			if mv.ValueType != jstream.Object {
+				continue
+			}
+			_, ok := mv.Value.(jstream.KVS)
+			assertTrue(t, ok)
+
+			out, err := json.Marshal(mv.Value)
+			assertNil(t, err)
+			assertEqual(t, body[mv.Offset:mv.Offset+mv.Length], string(out))
+		}
+		assertNil(t, decoder.Err())
+	}
+}
+
+func TestDecoderObjectAsKVSEmitKV(t *testing.T) {
+	values, err := decodeAll(`{"a":{"c":1,"b":2}}`, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.ObjectAsKVS().EmitKV()
+	})
+	assertNil(t, err)
+	assertEqual(t, 1, len(values))
+
+	kv := values[0].Value.(jstream.KV)
+	out, err := json.Marshal(kv.Value)
+	assertNil(t, err)
+	assertEqual(t, `{"c":1,"b":2}`, string(out))
+}
+
+func TestKVMarshalJSON(t *testing.T) {
+	// ValueType and Length are not marshaled
+	values, err := decodeAll(`{"a": "b"}`, 1, (*jstream.Decoder).EmitKV)
+	assertNil(t, err)
+	kv := values[0].Value.(jstream.KV)
+	assertEqual(t, jstream.String, kv.ValueType)
+	assertEqual(t, int64(3), kv.Length)
+
+	out, err := json.Marshal(kv)
+	assertNil(t, err)
+	assertEqual(t, `{"key":"a","value":"b"}`, string(out))
+}
+
+func TestKVSHelpers(t *testing.T) {
+	kvs := jstream.KVS{{Key: "a", Value: 1}, {Key: "b", Value: 2}, {Key: "a", Value: 3}}
+
+	v, ok := kvs.Get("a")
+	assertTrue(t, ok)
+	assertEqual(t, 1, v)
+	_, ok = kvs.Get("c")
+	assertFalse(t, ok)
+	assertTrue(t, kvs.Has("b"))
+	assertFalse(t, kvs.Has("c"))
+
+	kvs = kvs.Set("a", 4).Set("c", 5)
+	out, err := json.Marshal(kvs)
+	assertNil(t, err)
+	assertEqual(t, `{"a":4,"b":2,"a":3,"c":5}`, string(out))
+
+	kvs = kvs.Delete("a")
+	assertFalse(t, kvs.Has("a"))
+	out, err = json.Marshal(kvs)
+	assertNil(t, err)
+	assertEqual(t, `{"b":2,"c":5}`, string(out))
+	assertEqual(t, 2, len(kvs.Delete("missing")))
+}
+
+func TestKVSUnmarshalJSON(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 60; i > 0; i-- {
+		if i < 60 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `"k%d":{"z":%d,"y":[{"x":1,"w":2}],"v":"%d"}`, i, i, i)
+	}
+	b.WriteString("}")
+	body := b.String()
+
+	var kvs jstream.KVS
+	assertNil(t, json.Unmarshal([]byte(body), &kvs))
+	assertEqual(t, 60, len(kvs))
+	assertEqual(t, "k60", kvs[0].Key)
+	inner, ok := kvs[0].Value.(jstream.KVS)
+	assertTrue(t, ok)
+	assertEqual(t, int64(60), inner[0].Value)
+
+	out, err := json.Marshal(kvs)
+	assertNil(t, err)
+	assertEqual(t, body, string(out))
+
+	// within other values
+	var doc struct {
+		Meta jstream.KVS `json:"meta"`
+		Null jstream.KVS `json:"null"`
+	}
+	assertNil(t, json.Unmarshal([]byte(`{"meta": {"b": 1, "a": 2}, "null": null}`), &doc))
+	out, err = json.Marshal(doc.Meta)
+	assertNil(t, err)
+	assertEqual(t, `{"b":1,"a":2}`, string(out))
+	assertTrue(t, doc.Null == nil)
+
+	assertNotNil(t, json.Unmarshal([]byte(`[1, 2]`), &kvs))
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderLimit(t *testing.T) {
+	body := strings.Repeat(`{ "bio": "bada bing bada boom", "id": 1, "name": "Charles" }`+"\n", 5)
+	before := runtime.NumGoroutine()
+
+	for _, depth := range []int{0, 1, -1} {
+		decoder := jstream.NewDecoder(mkReader(body), depth).Limit(2)
+		var count int
+		for range decoder.Stream() {
+			count++
+		}
+		assertNil(t, decoder.Err())
+		assertEqual(t, 2, count)
+		assertEqual(t, 2, decoder.Stats().Values)
+
+		// decoding stops at the last value emitted
+		values, err := jstream.NewDecoder(mkReader(body), depth).Limit(2).ReadAll()
+		assertNil(t, err)
+		assertEqual(t, 2, len(values))
+		assertTrue(t, values[1].Offset < int64(len(body)/2))
+	}
+
+	decoder := jstream.NewDecoder(mkReader(`[1, 2, 3, 4, 5, 6]`), 1).Limit(4)
+	var count int
+	for range decoder.StreamParallel(2) {
+		count++
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 4, count)
+
+	// a limit beyond the values of the input has no effect
+	values, err := jstream.NewDecoder(mkReader(body), 0).Limit(10).ReadAll()
+	assertNil(t, err)
+	assertEqual(t, 5, len(values))
+
+	// the scanner's goroutine has stopped
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assertEqual(t, before, runtime.NumGoroutine())
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+func TestDecoderLimitLargeInput(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 100000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, `{"id": %d, "tags": ["a", "b"]}`, i)
+	}
+	sb.WriteString("]")
+	body := sb.String()
+
+	options := []func(*jstream.Decoder) *jstream.Decoder{
+		nil,
+		(*jstream.Decoder).EmitKV,
+		(*jstream.Decoder).Recursive,
+		func(d *jstream.Decoder) *jstream.Decoder { return d.Recursive().EmitKV() },
+	}
+	for _, option := range options {
+		r := &countingReader{r: strings.NewReader(body)}
+		decoder := jstream.NewDecoder(r, 2)
+		if option != nil {
+			decoder = option(decoder)
+		}
+		decoder = decoder.Limit(10)
+		values, err := decoder.ReadAll()
+		assertNil(t, err)
+		assertEqual(t, 10, len(values))
+
+		// only the values emitted have been consumed, and read ahead of them
+		last := values[len(values)-1]
+		assertTrue(t, int64(decoder.GetPos()) >= last.Offset+last.Length)
+		assertTrue(t, decoder.GetPos() < 1000)
+		assertTrue(t, atomic.LoadInt64(&r.n) < int64(len(body))/100)
+	}
+}
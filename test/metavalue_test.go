@@ -0,0 +1,55 @@
+package test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestMetaValueJSON(t *testing.T) {
+	body := `{"s": "str<>", "i": 42, "f": 1.0, "e": 2.5e-3, "big": 123456789012345678901234567890,
+"b": true, "n": null, "a": [1, [2.0, "x"], {"k": "v"}], "o": {"z": 1, "y": [false]}}`
+
+	options := []func(*jstream.Decoder) *jstream.Decoder{
+		(*jstream.Decoder).UseBigInt,
+		func(d *jstream.Decoder) *jstream.Decoder { return d.UseBigInt().ObjectAsKVS() },
+		func(d *jstream.Decoder) *jstream.Decoder { return d.UseBigInt().EmitKV() },
+		func(d *jstream.Decoder) *jstream.Decoder { return d.UseBigInt().ObjectAsKVS().EmitKV() },
+		func(d *jstream.Decoder) *jstream.Decoder { return d.UseBigInt().EmitBoth() },
+	}
+	for _, option := range options {
+		for _, depth := range []int{0, 1, 2, -1} {
+			values, err := decodeAll(body, depth, option)
+			assertNil(t, err)
+			for _, mv := range values {
+				data, err := json.Marshal(mv)
+				assertNil(t, err)
+
+				var decoded jstream.MetaValue
+				assertNil(t, json.Unmarshal(data, &decoded))
+				if !reflect.DeepEqual(*mv, decoded) {
+					t.Errorf("round trip of %s: got %#v, expected %#v", data, decoded, *mv)
+				}
+			}
+		}
+	}
+
+	// the schema names the type
+	values, err := decodeAll(`{"a": [1]}`, 1, nil)
+	assertNil(t, err)
+	data, err := json.Marshal(values[0])
+	assertNil(t, err)
+	assertEqual(t, `{"offset":6,"length":3,"line":1,"depth":1,"keys":["a"],"index":-1,"parentOffset":0,"type":"array","value":[1]}`, string(data))
+
+	// errors are restored with their message
+	values, err = decodeAll("{\"a\": 1}\n{x}\n", 0, (*jstream.Decoder).NDJSON)
+	assertNil(t, err)
+	data, err = json.Marshal(values[1])
+	assertNil(t, err)
+	var decoded jstream.MetaValue
+	assertNil(t, json.Unmarshal(data, &decoded))
+	assertNotNil(t, decoded.Err)
+	assertEqual(t, values[1].Err.Error(), decoded.Err.Error())
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestMultiDecoder(t *testing.T) {
+	docs := []string{`[1, 2, 3]`, `[4, 5]`, `[6, 7, 8, 9]`}
+	readers := func() []io.Reader {
+		var rs []io.Reader
+		for _, doc := range docs {
+			rs = append(rs, strings.NewReader(doc))
+		}
+		return rs
+	}
+
+	for _, workers := range []int{1, 3} {
+		m := jstream.NewMultiDecoder(1, readers()...).Concurrency(workers)
+		var (
+			counts [3]int
+			last   = [3]int64{-1, -1, -1}
+			order  []int64
+		)
+		for mv := range m.Stream() {
+			counts[mv.Source]++
+			// values of each reader are delivered in order, with offsets
+			// relative to the reader
+			assertTrue(t, mv.Offset > last[mv.Source])
+			last[mv.Source] = mv.Offset
+			order = append(order, mv.Value.(int64))
+		}
+		assertNil(t, m.Err())
+		assertEqual(t, [3]int{3, 2, 4}, counts)
+		if workers == 1 {
+			// readers are decoded in turn
+			assertEqual(t, "[1 2 3 4 5 6 7 8 9]", fmt.Sprint(order))
+		}
+	}
+}
+
+func TestMultiDecoderErrors(t *testing.T) {
+	rs := []io.Reader{mkReader(`[1, 2]`), mkReader(`[3, x]`), mkReader(`[4, 5]`)}
+	m := jstream.NewMultiDecoder(1, rs...)
+	var count int
+	for range m.Stream() {
+		count++
+	}
+	// decoding stops at the first error
+	assertEqual(t, 3, count)
+	var srcErr *jstream.SourceError
+	assertTrue(t, errors.As(m.Err(), &srcErr))
+	assertEqual(t, 1, srcErr.Source)
+	assertEqual(t, 1, len(m.Errs()))
+
+	// or continues with the remaining readers
+	rs = []io.Reader{mkReader(`[1, x]`), mkReader(`[3, 4]`), mkReader(`{`)}
+	m = jstream.NewMultiDecoder(1, rs...).ContinueOnError().Configure((*jstream.Decoder).IndexedKeys)
+	var keys []string
+	for mv := range m.Stream() {
+		keys = append(keys, mv.Keys[0])
+	}
+	assertEqual(t, "[0 0 1]", fmt.Sprint(keys))
+	errs := m.Errs()
+	assertEqual(t, 2, len(errs))
+	assertEqual(t, 0, errs[0].Source)
+	assertEqual(t, 2, errs[1].Source)
+	assertTrue(t, errors.Is(errs[1], jstream.ErrUnexpectedEOF))
+}
+
+func TestMultiDecoderClose(t *testing.T) {
+	// closing stops a reader waiting for more input
+	r := &blockingReader{data: []byte(`[1, 2, `), unblock: make(chan struct{})}
+	defer close(r.unblock)
+
+	m := jstream.NewMultiDecoder(1, r, mkReader(`[4]`))
+	ch := m.Stream()
+	<-ch
+	assertNil(t, m.Close())
+	for mv := range ch {
+		// the remaining readers are not decoded
+		assertEqual(t, 0, mv.Source)
+	}
+	assertEqual(t, jstream.ErrClosed, m.Err())
+}
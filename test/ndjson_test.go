@@ -0,0 +1,146 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func decodeLines(body string, depth int) (values, errs []*jstream.MetaValue, err error) {
+	decoder := jstream.NewDecoder(strings.NewReader(body), depth).NDJSON()
+	for mv := range decoder.Stream() {
+		if mv.Err != nil {
+			errs = append(errs, mv)
+		} else {
+			values = append(values, mv)
+		}
+	}
+	return values, errs, decoder.Err()
+}
+
+func TestDecoderNDJSON(t *testing.T) {
+	var b bytes.Buffer
+	for i := 1; i <= 1000; i++ {
+		switch i {
+		case 10:
+			b.WriteString(`{"id": 10, "name": "ten"` + "\n") // unterminated
+		case 500:
+			b.WriteString(`{"id": 500} {"id": 501}` + "\n") // two documents
+		default:
+			fmt.Fprintf(&b, `{"id": %d, "tags": ["a", "b"]}`+"\n", i)
+		}
+	}
+	body := b.String()
+
+	values, errs, err := decodeLines(body, 0)
+	assertNil(t, err)
+	assertEqual(t, 998, len(values))
+	assertEqual(t, 2, len(errs))
+
+	line := 1
+	for _, mv := range values {
+		if line == 10 || line == 500 {
+			line++
+		}
+		assertEqual(t, line, mv.Line)
+		assertEqual(t, int64(line), mv.Value.(map[string]interface{})["id"])
+		line++
+	}
+
+	assertEqual(t, 10, errs[0].Line)
+	assertEqual(t, `{"id": 10, "name": "ten"`, body[errs[0].Offset:errs[0].Offset+errs[0].Length])
+	assertEqual(t, 500, errs[1].Line)
+	assertEqual(t, `{"id": 500} {"id": 501}`, body[errs[1].Offset:errs[1].Offset+errs[1].Length])
+	assertEqual(t, "invalid character after top-level value: '{' [500,13] offset 15866", errorLine(errs[1].Err))
+}
+
+func TestDecoderNDJSONBlankLines(t *testing.T) {
+	body := "\n  \n[1, 2]\r\n\t\n\"x\"  \n\n"
+
+	values, errs, err := decodeLines(body, 0)
+	assertNil(t, err)
+	assertEqual(t, 0, len(errs))
+	assertEqual(t, 2, len(values))
+	assertEqual(t, 3, values[0].Line)
+	assertEqual(t, 5, values[1].Line)
+	assertEqual(t, `"x"`, body[values[1].Offset:values[1].Offset+values[1].Length])
+}
+
+func TestDecoderNDJSONNested(t *testing.T) {
+	// values of a malformed line are not emitted, even below the error
+	body := "[1, 2]\n[3, 4, x]\n[5, 6]\n{\"a\": [7,\n8]}\n[9] garbage"
+
+	values, errs, err := decodeLines(body, 1)
+	assertNil(t, err)
+	var got []interface{}
+	for _, mv := range values {
+		got = append(got, mv.Value)
+	}
+	assertEqual(t, "[1 2 5 6]", fmt.Sprint(got))
+	assertEqual(t, 3, values[2].Line)
+
+	assertEqual(t, 4, len(errs))
+	var lines []int
+	for _, mv := range errs {
+		lines = append(lines, mv.Line)
+	}
+	assertEqual(t, "[2 4 5 6]", fmt.Sprint(lines))
+	assertEqual(t, "[9] garbage", body[errs[3].Offset:errs[3].Offset+errs[3].Length])
+}
+
+func TestDecoderNDJSONWalk(t *testing.T) {
+	// errors returned by the walk function are not isolated
+	stop := fmt.Errorf("stop")
+	decoder := jstream.NewDecoder(strings.NewReader("1\nx\n3\n"), 0).NDJSON()
+	var n int
+	err := decoder.Walk(func(mv *jstream.MetaValue) error {
+		if n++; mv.Err != nil {
+			return stop
+		}
+		return nil
+	})
+	assertEqual(t, stop, err)
+	assertEqual(t, 2, n)
+}
+
+func TestDecoderNDJSONRecords(t *testing.T) {
+	body := `{"level": "info", "msg": "start"}
+{"level": "warn", "msg": "trunc
+{"level": "info", "msg": "step"}
+{"level": "info", "msg": "done"}
+`
+	values, errs, err := decodeLines(body, 0)
+	assertNil(t, err)
+	assertEqual(t, 3, len(values))
+	assertEqual(t, 1, len(errs))
+	assertEqual(t, 2, errs[0].Line)
+	assertEqual(t, "[1 3 4]", fmt.Sprint([]int{values[0].Line, values[1].Line, values[2].Line}))
+}
+
+func TestDecoderNDJSONCRLFPositions(t *testing.T) {
+	// columns count from the start of each line, however lines end
+	body := "{\"a\": 1}\r\n{\"b\": x}\r\n  {\"c\": 2 3}\r\n[4]"
+	values, errs, err := decodeLines(body, 0)
+	assertNil(t, err)
+	assertEqual(t, 2, len(values))
+	assertEqual(t, 4, values[1].Line)
+	assertEqual(t, 2, len(errs))
+	assertEqual(t, "invalid character looking for beginning of value: 'x' [2,7] offset 16", errorLine(errs[0].Err))
+	assertEqual(t, `invalid character after object key:value pair for key "c": '3' [3,11] offset 30`, errorLine(errs[1].Err))
+
+	// a lone carriage return ends a line, as does \r\n
+	for _, sep := range []string{"\r", "\r\n", "\n"} {
+		body := "[1," + sep + "2," + sep + " x]"
+		_, err := decodeAll(body, 0, nil)
+		want := fmt.Sprintf("invalid character looking for beginning of value: 'x' [3,2] offset %d", len(body)-2)
+		if errorLine(err) != want {
+			t.Errorf("%q: unexpected error %v", body, err)
+		}
+		values, err := decodeAll("[1,"+sep+"2,"+sep+sep+" 3]", 1, nil)
+		assertNil(t, err)
+		assertEqual(t, 4, values[2].Line)
+	}
+}
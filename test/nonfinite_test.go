@@ -0,0 +1,90 @@
+package test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderNonFiniteNumbers(t *testing.T) {
+	allow := (*jstream.Decoder).AllowNonFiniteNumbers
+
+	check := func(t *testing.T, mv *jstream.MetaValue, expected float64) {
+		t.Helper()
+		assertEqual(t, jstream.Number, mv.ValueType)
+		f, ok := mv.Value.(float64)
+		if !ok {
+			t.Fatalf("expected float64, got %T", mv.Value)
+		}
+		if math.IsNaN(expected) {
+			assertTrue(t, math.IsNaN(f))
+		} else {
+			assertEqual(t, expected, f)
+		}
+	}
+
+	// array elements
+	values, err := decodeAll(`[NaN, Infinity, -Infinity, 1]`, 1, allow)
+	assertNil(t, err)
+	assertEqual(t, 4, len(values))
+	check(t, values[0], math.NaN())
+	check(t, values[1], math.Inf(1))
+	check(t, values[2], math.Inf(-1))
+
+	// object values
+	values, err = decodeAll(`{"a": -Infinity, "b": NaN}`, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.AllowNonFiniteNumbers().ObjectAsKVS()
+	})
+	assertNil(t, err)
+	assertEqual(t, 2, len(values))
+	check(t, values[0], math.Inf(-1))
+	check(t, values[1], math.NaN())
+
+	// top level, including as the last bytes of input
+	values, err = decodeAll("Infinity\nNaN -Infinity", 0, allow)
+	assertNil(t, err)
+	assertEqual(t, 3, len(values))
+	check(t, values[0], math.Inf(1))
+	check(t, values[1], math.NaN())
+	check(t, values[2], math.Inf(-1))
+	assertEqual(t, int64(9), values[1].Offset)
+	assertEqual(t, int64(3), values[1].Length)
+
+	// skipped values
+	values, err = decodeAll(`{"a": [NaN, -Infinity], "b": Infinity}`, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.AllowNonFiniteNumbers().FilterKeys("b")
+	})
+	assertNil(t, err)
+	assertEqual(t, 1, len(values))
+	check(t, values[0], math.Inf(1))
+}
+
+func TestDecoderNonFiniteNumbersRejected(t *testing.T) {
+	for _, body := range []string{`[NaN]`, `[Infinity]`, `[-Infinity]`} {
+		_, err := decodeAll(body, 1, nil)
+		if err == nil {
+			t.Errorf("%s: expected error by default", body)
+		}
+	}
+
+	tests := []struct {
+		body    string
+		context string
+	}{
+		{`[Nan]`, "in literal NaN"},
+		{`[NaN`, "after array element"},
+		{`[Infinit]`, "in literal Infinity"},
+		{`[-Inf]`, "in literal Infinity"},
+		{`[Infinit`, "in literal Infinity"},
+		{`[-NaN]`, "in negative numeric literal"},
+		{`[inf]`, "looking for beginning of value"},
+	}
+	for _, test := range tests {
+		_, err := decodeAll(test.body, 1, (*jstream.Decoder).AllowNonFiniteNumbers)
+		if err == nil || !strings.Contains(err.Error(), test.context) {
+			t.Errorf("%s: expected error %q, got %v", test.body, test.context, err)
+		}
+	}
+}
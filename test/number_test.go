@@ -0,0 +1,140 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderNumberFunc(t *testing.T) {
+	body := `[12345678901234567890123, -98765432109876543210, 0, -7, 1.5, -2e3]`
+
+	var raws []string
+	bigInts := func(raw []byte, isFloat bool) (interface{}, error) {
+		raws = append(raws, string(raw))
+		if isFloat {
+			return strconv.ParseFloat(string(raw), 64)
+		}
+		n, ok := new(big.Int).SetString(string(raw), 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", raw)
+		}
+		return n, nil
+	}
+
+	values, err := decodeAll(body, 1, func(d *jstream.Decoder) *jstream.Decoder { return d.NumberFunc(bigInts) })
+	assertNil(t, err)
+	assertEqual(t, "[12345678901234567890123 -98765432109876543210 0 -7 1.5 -2e3]", fmt.Sprint(raws))
+	assertEqual(t, 6, len(values))
+
+	want, _ := new(big.Int).SetString("12345678901234567890123", 10)
+	assertEqual(t, 0, want.Cmp(values[0].Value.(*big.Int)))
+	want, _ = new(big.Int).SetString("-98765432109876543210", 10)
+	assertEqual(t, 0, want.Cmp(values[1].Value.(*big.Int)))
+	assertEqual(t, 0, big.NewInt(-7).Cmp(values[3].Value.(*big.Int)))
+	assertEqual(t, -2000.0, values[5].Value)
+	for _, mv := range values {
+		assertEqual(t, jstream.Number, mv.ValueType)
+	}
+}
+
+func TestDecoderNumberFuncError(t *testing.T) {
+	_, err := decodeAll(`[1, 2]`, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.NumberFunc(func(raw []byte, isFloat bool) (interface{}, error) {
+			return nil, fmt.Errorf("rejected %s", raw)
+		})
+	})
+	assertEqual(t, "rejected 1", err.Error())
+}
+
+func TestDecoderMinInt64(t *testing.T) {
+	values, err := decodeAll(`-9223372036854775808`, 0, nil)
+	assertNil(t, err)
+	assertEqual(t, int64(math.MinInt64), values[0].Value)
+}
+
+func TestDecoderUseBigInt(t *testing.T) {
+	body := `[9223372036854775807, 9223372036854775808, -9223372036854775808, -9223372036854775809,
+		1234567890123456789012345678901234567890, -1234567890123456789012345678901234567890, 1.5]`
+
+	values, err := decodeAll(body, 1, (*jstream.Decoder).UseBigInt)
+	assertNil(t, err)
+	assertEqual(t, 7, len(values))
+
+	assertEqual(t, int64(math.MaxInt64), values[0].Value)
+	assertEqual(t, int64(math.MinInt64), values[2].Value)
+	assertEqual(t, 1.5, values[6].Value)
+	for i, want := range map[int]string{
+		1: "9223372036854775808",
+		3: "-9223372036854775809",
+		4: "1234567890123456789012345678901234567890",
+		5: "-1234567890123456789012345678901234567890",
+	} {
+		n, ok := values[i].Value.(*big.Int)
+		assertTrue(t, ok)
+		assertEqual(t, want, n.String())
+		assertEqual(t, jstream.Number, values[i].ValueType)
+	}
+
+	// without the option, out of range integers are an error
+	_, err = decodeAll(`9223372036854775808`, 0, nil)
+	assertNotNil(t, err)
+}
+
+func TestDecoderMaxNumberLen(t *testing.T) {
+	body := "[1, -12345678, " + strings.Repeat("9", 1<<20) + "]"
+
+	decoder := jstream.NewDecoder(mkReader(body), 1).MaxNumberLen(9)
+	var n int
+	for range decoder.Stream() {
+		n++
+	}
+	assertEqual(t, 2, n)
+	err := decoder.Err()
+	assertTrue(t, errors.Is(err, jstream.ErrNumberTooLong))
+	assertEqual(t, "numeric literal longer than 9 bytes: '9' [1,25] offset 24", errorLine(err))
+
+	// literals are limited wherever they appear, including fractions
+	for _, body := range []string{`{"a": [1.0000000000]}`, `12345e1234567`, `-123456789`} {
+		_, err := decodeAll(body, 1, func(d *jstream.Decoder) *jstream.Decoder { return d.MaxNumberLen(9) })
+		assertTrue(t, errors.Is(err, jstream.ErrNumberTooLong))
+	}
+	_, err = decodeAll(`[123456789, -12345678, 1.2345678]`, 1, func(d *jstream.Decoder) *jstream.Decoder { return d.MaxNumberLen(9) })
+	assertNil(t, err)
+	assertFalse(t, errors.Is(jstream.NewDecoder(mkReader(`x`), 0).Walk(func(*jstream.MetaValue) error { return nil }), jstream.ErrNumberTooLong))
+}
+
+func TestDecoderNumberAllocs(t *testing.T) {
+	if raceEnabled {
+		return
+	}
+	const n = 10000
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "%d, %d.5, ", 1000000+i, i)
+	}
+	sb.WriteString("1]")
+	body := sb.String()
+
+	// each number allocates once, boxed as an element of the array, and
+	// is otherwise parsed in place
+	for _, bigInt := range []bool{false, true} {
+		allocs := testing.AllocsPerRun(3, func() {
+			decoder := jstream.NewDecoder(mkReader(body), 0)
+			if bigInt {
+				decoder.UseBigInt()
+			}
+			assertNil(t, decoder.Walk(func(*jstream.MetaValue) error { return nil }))
+		})
+		if allocs > 2*n*1.25 {
+			t.Errorf("bigInt %v: expected about %d allocs, got %v", bigInt, 2*n, allocs)
+		}
+	}
+}
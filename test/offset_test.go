@@ -0,0 +1,183 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+var offsetDocs = []string{
+	`{"a": [1, 22], "b": {"c": "d"}}`,
+	`[1, "two", 3.5, [], {}]`,
+	`"str"`,
+	`12`,
+	`1.5`,
+	`-3e+2`,
+	`true`,
+	`null`,
+	`false`,
+	`{}`,
+	`[]`,
+}
+
+func TestDecoderMultiDocOffsets(t *testing.T) {
+	separators := map[string]string{
+		"nothing":  "",
+		"spaces":   "  ",
+		"newlines": "\n",
+		"crlf":     "\r\n",
+	}
+
+	for name, sep := range separators {
+		for _, trailing := range []bool{false, true} {
+			for _, depth := range []int{0, -1} {
+				docs := offsetDocs
+				if sep == "" {
+					// adjacent scalars would run together
+					docs = []string{offsetDocs[0], offsetDocs[1], offsetDocs[2], offsetDocs[6], offsetDocs[9], offsetDocs[4]}
+				}
+				body := strings.Join(docs, sep)
+				if trailing {
+					body += sep
+				}
+
+				decoder := jstream.NewDecoder(mkReader(body), depth)
+				var top int
+				for mv := range decoder.Stream() {
+					if mv.Offset < 0 || mv.Offset+mv.Length > int64(len(body)) {
+						t.Fatalf("%s: value out of range: offset %d, length %d", name, mv.Offset, mv.Length)
+					}
+					raw := body[mv.Offset : mv.Offset+mv.Length]
+					if strings.TrimSpace(raw) != raw || !json.Valid([]byte(raw)) {
+						t.Fatalf("%s: value at offset %d has invalid raw bytes %q", name, mv.Offset, raw)
+					}
+					if mv.Depth == 0 {
+						if top >= len(docs) {
+							t.Fatalf("%s: unexpected top-level value %q", name, raw)
+						}
+						assertEqual(t, docs[top], raw)
+						top++
+					}
+				}
+				assertNil(t, decoder.Err())
+				assertEqual(t, len(docs), top)
+			}
+		}
+	}
+}
+
+func TestDecoderMultiDocErrorPosition(t *testing.T) {
+	// line and column are counted from the start of the reader, not the
+	// start of the current document
+	body := "{\"a\": 1}\r\n[2]\n{\"b\": x}"
+	decoder := jstream.NewDecoder(mkReader(body), 0)
+	var count int
+	for range decoder.Stream() {
+		count++
+	}
+	assertEqual(t, 2, count)
+	if err := decoder.Err(); err == nil || !strings.HasSuffix(errorLine(err), "'x' [3,7] offset 20") {
+		t.Fatalf("expected syntax error at line 3, column 7, got %v", err)
+	}
+}
+
+func TestDecoderKVTrailingGarbage(t *testing.T) {
+	// the member is emitted before the unexpected token following it is
+	// found, which is reported along with the member's key
+	modes := map[string]func(*jstream.Decoder) *jstream.Decoder{
+		"kv":      (*jstream.Decoder).EmitKV,
+		"kvs":     func(d *jstream.Decoder) *jstream.Decoder { return d.EmitKV().ObjectAsKVS() },
+		"default": nil,
+	}
+	for name, options := range modes {
+		values, err := decodeAll(`{"a":1 2}`, 1, options)
+		assertEqual(t, 1, len(values))
+		if errorLine(err) != `invalid character after object key:value pair for key "a": '2' [1,8] offset 7` {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+
+	// the key of a member skipped by a key filter is not known
+	_, err := decodeAll(`{"a":1 2}`, 1, func(d *jstream.Decoder) *jstream.Decoder { return d.FilterKeys("b") })
+	if errorLine(err) != `invalid character after object key:value pair: '2' [1,8] offset 7` {
+		t.Errorf("filtered: unexpected error %v", err)
+	}
+}
+
+func TestDecoderStartOffsets(t *testing.T) {
+	// values beginning at the first byte of input
+	for _, body := range []string{`5`, `-5`, `"hi"`, `{"a":1}`, `[1]`, `true`, `null`, `1.5e3`} {
+		values, err := decodeAll(body, 0, nil)
+		assertNil(t, err)
+		assertEqual(t, 1, len(values))
+		assertEqual(t, int64(0), values[0].Offset)
+		assertEqual(t, int64(len(body)), values[0].Length)
+	}
+
+	// the first member of an object, emitted as KV, spans from its key
+	body := `{"k":[1]}`
+	values, err := decodeAll(body, 1, (*jstream.Decoder).EmitKV)
+	assertNil(t, err)
+	assertEqual(t, 1, len(values))
+	assertEqual(t, `"k":[1]`, body[values[0].Offset:values[0].Offset+values[0].Length])
+}
+
+// pastReader is an io.Seeker whose content appears at any offset sought
+type pastReader struct{ *strings.Reader }
+
+func (r pastReader) Seek(offset int64, whence int) (int64, error) {
+	_, err := r.Reader.Seek(0, io.SeekStart)
+	return offset, err
+}
+
+func TestDecoderLargeOffsets(t *testing.T) {
+	// offsets beyond the range of a 32-bit int are reported in full
+	const base = 5 << 30
+	decoder := jstream.NewDecoder(pastReader{strings.NewReader(`[1] {"a": "b"}`)}, -1).EmitKV()
+	assertNil(t, decoder.SeekTo(base))
+
+	var offsets, lengths []int64
+	for mv := range decoder.Stream() {
+		offsets = append(offsets, mv.Offset-base)
+		lengths = append(lengths, mv.Length)
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, "[1 0 5 4]", fmt.Sprint(offsets))
+	assertEqual(t, "[1 3 8 10]", fmt.Sprint(lengths))
+	assertEqual(t, int64(base+14), decoder.BytesConsumed())
+}
+
+func TestDecoderParentOffsets(t *testing.T) {
+	body := `{"a": [1, {"b": 2}], "c": {"d": [3]}} [4]`
+	values, err := decodeAll(body, -1, nil)
+	assertNil(t, err)
+
+	var got []string
+	for _, mv := range values {
+		if mv.ParentOffset >= 0 {
+			// the parent was emitted, and encloses the value
+			var found bool
+			for _, p := range values {
+				if p.Offset == mv.ParentOffset {
+					found = p.Depth == mv.Depth-1 && mv.Offset+mv.Length <= p.Offset+p.Length
+				}
+			}
+			assertTrue(t, found)
+		}
+		got = append(got, fmt.Sprintf("%s@%d", body[mv.Offset:mv.Offset+1], mv.ParentOffset))
+	}
+	assertEqual(t, "[1@6 2@10 {@6 [@0 3@32 [@26 {@0 {@-1 4@38 [@-1]", fmt.Sprint(got))
+
+	// members emitted as KV are linked to their object
+	values, err = decodeAll(`[{"k": {"j": 1}}]`, -1, (*jstream.Decoder).EmitKV)
+	assertNil(t, err)
+	assertEqual(t, 4, len(values))
+	assertEqual(t, int64(7), values[0].ParentOffset)
+	assertEqual(t, int64(1), values[1].ParentOffset)
+	assertEqual(t, int64(0), values[2].ParentOffset)
+	assertEqual(t, int64(-1), values[3].ParentOffset)
+}
@@ -0,0 +1,98 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderOffsetsOnly(t *testing.T) {
+	body := `{"a": [1, {"b": "two"}], "c": {"d": [true, null]}, "e": -3.5} ["f", []]`
+
+	type mode struct {
+		depth   int
+		options func(*jstream.Decoder) *jstream.Decoder
+	}
+	modes := []mode{
+		{1, nil},
+		{2, nil},
+		{-1, nil},
+		{1, (*jstream.Decoder).EmitKV},
+		{2, func(d *jstream.Decoder) *jstream.Decoder { return d.EmitKV().Recursive() }},
+	}
+	for _, m := range modes {
+		want, err := decodeAll(body, m.depth, m.options)
+		assertNil(t, err)
+		got, err := decodeAll(body, m.depth, func(d *jstream.Decoder) *jstream.Decoder {
+			if m.options != nil {
+				d = m.options(d)
+			}
+			return d.OffsetsOnly()
+		})
+		assertNil(t, err)
+		assertEqual(t, len(want), len(got))
+		for i := range want {
+			assertEqual(t, want[i].Offset, got[i].Offset)
+			assertEqual(t, want[i].Length, got[i].Length)
+			assertEqual(t, want[i].ValueType, got[i].ValueType)
+			assertEqual(t, fmt.Sprint(want[i].Keys), fmt.Sprint(got[i].Keys))
+			if kv, ok := got[i].Value.(jstream.KV); ok {
+				assertEqual(t, want[i].Value.(jstream.KV).Key, kv.Key)
+				assertNil(t, kv.Value)
+			} else {
+				assertNil(t, got[i].Value)
+			}
+		}
+	}
+}
+
+func TestDecoderSkipsShallowScalars(t *testing.T) {
+	// scalars above the emit depth are neither emitted nor stored, and are
+	// skipped rather than decoded
+	var decoded []string
+	values, err := decodeAll(`{"a": 1, "b": {"c": 2, "d": [3]}, "e": 4}`, 2, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.NumberFunc(func(raw []byte, isFloat bool) (interface{}, error) {
+			decoded = append(decoded, string(raw))
+			return string(raw), nil
+		})
+	})
+	assertNil(t, err)
+	assertEqual(t, 2, len(values))
+	assertEqual(t, "[2 3]", fmt.Sprint(decoded))
+
+	// syntax errors within them are still reported
+	_, err = decodeAll(`{"a": 01, "b": {"c": 2}}`, 2, nil)
+	assertNotNil(t, err)
+}
+
+func BenchmarkDecoderOffsetsOnly(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(strings.Repeat(`{"k": [1, "s", `, 10))
+		sb.WriteString("null")
+		sb.WriteString(strings.Repeat(`]}`, 10))
+	}
+	sb.WriteString("]")
+	body := []byte(sb.String())
+
+	for _, offsetsOnly := range []bool{false, true} {
+		b.Run(fmt.Sprint(offsetsOnly), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				decoder := jstream.NewDecoder(bytes.NewReader(body), 1)
+				if offsetsOnly {
+					decoder = decoder.OffsetsOnly()
+				}
+				decoder.Walk(func(*jstream.MetaValue) error { return nil })
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+const flatBody = `[
+  "1st test string",
+  "Roberto*Maestro", "Charles",
+  0, null, false,
+  1, 2.5
+]`
+
+func TestDecoderOnEmit(t *testing.T) {
+	// dropping null values
+	values, err := decodeAll(flatBody, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.OnEmit(func(mv *jstream.MetaValue) *jstream.MetaValue {
+			if mv.ValueType == jstream.Null {
+				return nil
+			}
+			return mv
+		})
+	})
+	assertNil(t, err)
+	var got []interface{}
+	for _, mv := range values {
+		got = append(got, mv.Value)
+	}
+	assertEqual(t, "[1st test string Roberto*Maestro Charles 0 false 1 2.5]", fmt.Sprint(got))
+
+	// uppercasing strings, in place or by replacement
+	upper := func(mv *jstream.MetaValue) *jstream.MetaValue {
+		if s, ok := mv.Value.(string); ok {
+			mv.Value = strings.ToUpper(s)
+		}
+		return mv
+	}
+	replace := func(mv *jstream.MetaValue) *jstream.MetaValue {
+		if s, ok := mv.Value.(string); ok {
+			return &jstream.MetaValue{Value: strings.ToUpper(s), ValueType: jstream.String, Offset: mv.Offset}
+		}
+		return mv
+	}
+	for _, fn := range []func(*jstream.MetaValue) *jstream.MetaValue{upper, replace} {
+		values, err = decodeAll(flatBody, 1, func(d *jstream.Decoder) *jstream.Decoder { return d.OnEmit(fn) })
+		assertNil(t, err)
+		got = got[:0]
+		for _, mv := range values {
+			got = append(got, mv.Value)
+		}
+		assertEqual(t, "[1ST TEST STRING ROBERTO*MAESTRO CHARLES 0 <nil> false 1 2.5]", fmt.Sprint(got))
+	}
+
+	// KVs are passed to the hook, and dropped values not counted by Limit
+	decoder := jstream.NewDecoder(mkReader(`{"a": null, "b": 1, "c": null, "d": 2, "e": 3}`), 1).EmitKV().Limit(2).
+		OnEmit(func(mv *jstream.MetaValue) *jstream.MetaValue {
+			if mv.Value.(jstream.KV).Value == nil {
+				return nil
+			}
+			return mv
+		})
+	values, err = decoder.ReadAll()
+	assertNil(t, err)
+	assertEqual(t, 2, len(values))
+	assertEqual(t, "b", values[0].Value.(jstream.KV).Key)
+	assertEqual(t, "d", values[1].Value.(jstream.KV).Key)
+
+	// elements decoded by StreamParallel
+	decoder = jstream.NewDecoder(mkReader(flatBody), 1).OnEmit(upper)
+	var count int
+	for mv := range decoder.StreamParallel(2) {
+		if s, ok := mv.Value.(string); ok {
+			assertEqual(t, strings.ToUpper(s), s)
+		}
+		count++
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 8, count)
+}
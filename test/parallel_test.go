@@ -0,0 +1,180 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func parallelBody(n int) string {
+	var sb strings.Builder
+	sb.WriteString("[\n")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteString(",\n")
+		}
+		switch i % 4 {
+		case 0:
+			fmt.Fprintf(&sb, `{"id": %d, "name": "item [%d] {\"q\"}", "tags": ["a", "b"]}`, i, i)
+		case 1:
+			fmt.Fprintf(&sb, `[%d, %d.5, null, true]`, i, i)
+		case 2:
+			fmt.Fprintf(&sb, `"str\\\"%d]"`, i)
+		default:
+			fmt.Fprintf(&sb, `%d`, i)
+		}
+	}
+	sb.WriteString("\n]")
+	return sb.String()
+}
+
+func TestDecoderStreamParallel(t *testing.T) {
+	body := parallelBody(1000)
+	serial, err := decodeAll(body, 1, nil)
+	assertNil(t, err)
+	assertEqual(t, 1000, len(serial))
+
+	format := func(mv *jstream.MetaValue) string {
+		return fmt.Sprintf("%d %d %d %d %d %v %v %v", mv.Offset, mv.Length, mv.Line, mv.Depth, mv.Index, mv.ParentOffset, mv.ValueType, mv.Value)
+	}
+	var want []string
+	for _, mv := range serial {
+		want = append(want, format(mv))
+	}
+
+	for _, ordered := range []bool{false, true} {
+		for _, workers := range []int{1, 4, 16} {
+			decoder := jstream.NewDecoder(mkReader(body), 1)
+			if ordered {
+				decoder.Ordered()
+			}
+			var got []string
+			for mv := range decoder.StreamParallel(workers) {
+				got = append(got, format(mv))
+			}
+			assertNil(t, decoder.Err())
+			assertEqual(t, 1000, decoder.Stats().Values)
+			if !ordered {
+				sort.Strings(got)
+				sorted := append([]string(nil), want...)
+				sort.Strings(sorted)
+				assertEqual(t, strings.Join(sorted, "\n"), strings.Join(got, "\n"))
+				continue
+			}
+			assertEqual(t, strings.Join(want, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestDecoderStreamParallelErrors(t *testing.T) {
+	// a malformed element reports its absolute offset
+	body := `[{"a": 1}, {"b": tru}, 3]`
+	decoder := jstream.NewDecoder(mkReader(body), 1).Ordered()
+	var count int
+	for range decoder.StreamParallel(2) {
+		count++
+	}
+	assertEqual(t, 1, count)
+	var elemErr *jstream.ElementError
+	assertTrue(t, errors.As(decoder.Err(), &elemErr))
+	assertEqual(t, int64(11), elemErr.Offset)
+	assertEqual(t, 1, elemErr.Index)
+
+	// the syntax error wrapped is positioned by line within the element
+	decoder = jstream.NewDecoder(mkReader("[1,\n {\"b\":\n  tru}]"), 1)
+	for range decoder.StreamParallel(1) {
+	}
+	var syntaxErr jstream.SyntaxError
+	assertTrue(t, errors.As(decoder.Err(), &syntaxErr))
+	assertEqual(t, "2 6 16", fmt.Sprint(syntaxErr.Line, syntaxErr.Column, syntaxErr.Offset))
+
+	// errors splitting the input are positioned within it
+	for _, body := range []string{`[1, 2`, `[1, "2]`, `[[1, 2]`, `{"a": 1}`, `[1 2]`} {
+		decoder := jstream.NewDecoder(mkReader(body), 1)
+		for range decoder.StreamParallel(2) {
+		}
+		if decoder.Err() == nil {
+			t.Errorf("%q: expected error", body)
+		}
+	}
+
+	// only elements of top-level arrays may be decoded in parallel
+	decoder = jstream.NewDecoder(mkReader(`[1]`), 2)
+	for range decoder.StreamParallel(2) {
+	}
+	assertNotNil(t, decoder.Err())
+}
+
+func TestDecoderStreamParallelOptions(t *testing.T) {
+	tests := []struct {
+		body   string
+		option func(*jstream.Decoder) *jstream.Decoder
+	}{
+		{"[{\"a\":\u00a0 1}, [2,\u00a03], \"x\"]", (*jstream.Decoder).Lenient},
+		{`[{"a": "x"}, ["y\n", {"b": "z"}], "w"]`, (*jstream.Decoder).StringsAsBytes},
+		{`[{"a": "x"}, "y"]`, (*jstream.Decoder).UnsafeStrings},
+		{`[{"a": "x"}, {"a": "y"}]`, (*jstream.Decoder).InternKeys},
+	}
+
+	for _, test := range tests {
+		serial, err := decodeAll(test.body, 1, test.option)
+		assertNil(t, err)
+		var want []string
+		for _, mv := range serial {
+			want = append(want, fmt.Sprintf("%#v", mv.Value))
+		}
+
+		// the options apply to elements decoded by workers
+		decoder := test.option(jstream.NewDecoder(mkReader(test.body), 1)).Ordered()
+		var got []string
+		for mv := range decoder.StreamParallel(2) {
+			got = append(got, fmt.Sprintf("%#v", mv.Value))
+		}
+		assertNil(t, decoder.Err())
+		assertEqual(t, strings.Join(want, "\n"), strings.Join(got, "\n"))
+
+		// and to values decoded by DecodeValueAt
+		r := bytes.NewReader([]byte(test.body))
+		decoder = test.option(jstream.NewDecoderReaderAt(r, r.Size(), 1))
+		got = got[:0]
+		for _, mv := range serial {
+			at, err := decoder.DecodeValueAt(mv.Offset, mv.Length)
+			assertNil(t, err)
+			got = append(got, fmt.Sprintf("%#v", at.Value))
+		}
+		assertEqual(t, strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+// BenchmarkDecoderStreamParallel compares StreamParallel with Stream: with
+// a single worker, or GOMAXPROCS of 1, it is slower by the cost of
+// splitting the input, which workers on other CPUs make up for
+func BenchmarkDecoderStreamParallel(b *testing.B) {
+	body := []byte(parallelBody(20000))
+
+	b.Run("serial", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			decoder := jstream.NewDecoder(bytes.NewReader(body), 1)
+			for range decoder.Stream() {
+			}
+		}
+	})
+	for _, workers := range []int{1, 4, 8} {
+		b.Run(fmt.Sprint(workers), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				decoder := jstream.NewDecoder(bytes.NewReader(body), 1)
+				for range decoder.StreamParallel(workers) {
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestFormatParsePath(t *testing.T) {
+	tests := []struct {
+		keys []string
+		path string
+	}{
+		{[]string{}, ""},
+		{[]string{"a"}, "/a"},
+		{[]string{"a", "0", "b"}, "/a/0/b"},
+		{[]string{""}, "/"},
+		{[]string{"a/b", "c~d", "~1"}, "/a~1b/c~0d/~01"},
+	}
+	for _, test := range tests {
+		assertEqual(t, test.path, jstream.FormatPath(test.keys))
+		if keys := jstream.ParsePath(test.path); !reflect.DeepEqual(test.keys, keys) {
+			t.Errorf("%q: expected %q, got %q", test.path, test.keys, keys)
+		}
+	}
+	if keys := jstream.ParsePath("a/b"); !reflect.DeepEqual([]string{"a", "b"}, keys) {
+		t.Errorf("expected leading / to be optional, got %q", keys)
+	}
+}
+
+func TestDecoderPathRoundTrip(t *testing.T) {
+	body := `{"a": [1, [2, 3], {"b": [4, {"c/d": 5}]}], "e": {"0": "zero", "~": [null, true]}, "f": []}`
+
+	modes := map[string]func(*jstream.Decoder) *jstream.Decoder{
+		"recursive": func(d *jstream.Decoder) *jstream.Decoder {
+			return d.Recursive().IndexedKeys()
+		},
+		"recursive emitKV": func(d *jstream.Decoder) *jstream.Decoder {
+			return d.Recursive().EmitKV().IndexedKeys()
+		},
+		"recursive ordered": func(d *jstream.Decoder) *jstream.Decoder {
+			return d.Recursive().ObjectAsKVS().IndexedKeys()
+		},
+	}
+
+	for name, options := range modes {
+		decoder := options(jstream.NewDecoder(mkReader(body), 0))
+		var count int
+		for mv := range decoder.Stream() {
+			count++
+			expected, offset := mv.Value, mv.Offset
+			if kv, ok := expected.(jstream.KV); ok {
+				// a KV spans both the key and the value
+				expected, offset = kv.Value, -1
+			}
+
+			// decode the document again for just the value at the address
+			path := jstream.FormatPath(mv.Keys)
+			redecoder := jstream.NewDecoder(mkReader(body), 0).FilterPath(jstream.ParsePath(path))
+			if name == "recursive ordered" {
+				redecoder = redecoder.ObjectAsKVS()
+			}
+			var got []*jstream.MetaValue
+			for v := range redecoder.Stream() {
+				got = append(got, v)
+			}
+			assertNil(t, redecoder.Err())
+			if len(got) != 1 {
+				t.Fatalf("%s: expected one value at %q, got %d", name, path, len(got))
+			}
+			if !reflect.DeepEqual(expected, got[0].Value) {
+				t.Errorf("%s: expected %v at %q, got %v", name, expected, path, got[0].Value)
+			}
+			if offset >= 0 {
+				assertEqual(t, offset, got[0].Offset)
+			}
+			assertEqual(t, mv.Depth, got[0].Depth)
+			assertEqual(t, mv.Index, got[0].Index)
+		}
+		assertNil(t, decoder.Err())
+		assertEqual(t, 17, count)
+	}
+}
+
+func TestDecoderFilterPathMissing(t *testing.T) {
+	body := `{"a": [1, 2]} {"a": [3]} [4, 5]`
+	decoder := jstream.NewDecoder(mkReader(body), 0).FilterPath([]string{"a", "1"})
+	var values []interface{}
+	for mv := range decoder.Stream() {
+		values = append(values, mv.Value)
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 1, len(values))
+	assertEqual(t, int64(2), values[0])
+}
+
+func TestDecoderCurrentPath(t *testing.T) {
+	body := `{"a": [1, {"b": [true, {}]}], "c": {"d": "e", "f": []}} [{"g": null}]`
+	modes := map[string]func(*jstream.Decoder) *jstream.Decoder{
+		"default": nil,
+		"kv":      (*jstream.Decoder).EmitKV,
+		"kvs":     (*jstream.Decoder).ObjectAsKVS,
+		"indexed": (*jstream.Decoder).IndexedKeys,
+		"filter":  func(d *jstream.Decoder) *jstream.Decoder { return d.FilterKeys("c") },
+	}
+	for name, options := range modes {
+		for _, depth := range []int{0, 1, 2, -1} {
+			decoder := jstream.NewDecoder(mkReader(body), depth).TrackPath()
+			if options != nil {
+				decoder = options(decoder)
+			}
+			var count int
+			err := decoder.Walk(func(mv *jstream.MetaValue) error {
+				if path := decoder.CurrentPath(); !reflect.DeepEqual(path, mv.Keys) && len(path)+len(mv.Keys) > 0 {
+					t.Errorf("%s at depth %d: expected path %q, got %q", name, depth, mv.Keys, path)
+				}
+				count++
+				return nil
+			})
+			assertNil(t, err)
+			assertTrue(t, count > 0)
+			assertEqual(t, 0, len(decoder.CurrentPath()))
+		}
+	}
+
+	// the path of the value at fault remains once decoding fails
+	decoder := jstream.NewDecoder(mkReader(`{"a": {"b": [1, x]}}`), 1).IndexedKeys().TrackPath()
+	assertNotNil(t, decoder.Walk(func(*jstream.MetaValue) error { return nil }))
+	assertEqual(t, `[a b 1]`, fmt.Sprint(decoder.CurrentPath()))
+
+	// and it may be read while streaming; run with -race
+	decoder = jstream.NewDecoder(mkReader(body), -1).TrackPath()
+	for range decoder.Stream() {
+		decoder.CurrentPath()
+	}
+	assertNil(t, decoder.Err())
+
+	// nothing is recorded without TrackPath
+	decoder = jstream.NewDecoder(mkReader(body), 2)
+	assertNil(t, decoder.Walk(func(*jstream.MetaValue) error {
+		assertEqual(t, 0, len(decoder.CurrentPath()))
+		return nil
+	}))
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderWriteTo(t *testing.T) {
+	body := `[1.230, "caf\u00e9\n", {"b": [1e2, -0.0], "a": null}, true, []]`
+
+	var out bytes.Buffer
+	n, err := jstream.NewDecoder(mkReader(body), 1).WriteTo(&out)
+	assertNil(t, err)
+	want := "1.230\n\"caf\\u00e9\\n\"\n{\"b\": [1e2, -0.0], \"a\": null}\ntrue\n[]\n"
+	assertEqual(t, want, out.String())
+	assertEqual(t, int64(len(want)), n)
+
+	// values selected by key filters, as members
+	body = `{"keep": 1.50, "drop": 2, "also": {"x": "\/"}}`
+	out.Reset()
+	_, err = jstream.NewDecoder(mkReader(body), 1).EmitKV().FilterKeys("keep", "also").WriteTo(&out)
+	assertNil(t, err)
+	assertEqual(t, "{\"key\":\"keep\",\"value\":1.50}\n{\"key\":\"also\",\"value\":{\"x\": \"\\/\"}}\n", out.String())
+
+	// documents of newline-delimited input
+	out.Reset()
+	_, err = jstream.NewDecoder(mkReader("{\"a\": [1,2]}\n\n{\"a\": [3.0]}\n"), 2).NDJSON().WriteTo(&out)
+	assertNil(t, err)
+	assertEqual(t, "1\n2\n3.0\n", out.String())
+}
+
+func TestDecoderWriteToErrors(t *testing.T) {
+	var out bytes.Buffer
+	_, err := jstream.NewDecoder(mkReader(`[1]`), -1).WriteTo(&out)
+	assertNotNil(t, err)
+
+	// syntax errors stop writing at the last complete value
+	_, err = jstream.NewDecoder(mkReader(`[1, 2, x]`), 1).WriteTo(&out)
+	assertNotNil(t, err)
+	assertEqual(t, "1\n2\n", out.String())
+
+	// as do errors writing
+	werr := errors.New("write failed")
+	n, err := jstream.NewDecoder(mkReader(`[1, 2]`), 1).WriteTo(failWriter{werr})
+	assertTrue(t, errors.Is(err, werr))
+	assertEqual(t, int64(0), n)
+}
+
+type failWriter struct{ err error }
+
+func (w failWriter) Write(p []byte) (int, error) { return 0, w.err }
+
+func TestDecoderWriteToLarge(t *testing.T) {
+	// values spanning several buffer refills are copied intact
+	long := `"` + strings.Repeat("x", 20000) + `"`
+	body := "[" + long + ", {\"k\": " + long + "}]"
+
+	var out bytes.Buffer
+	_, err := jstream.NewDecoder(mkReader(body), 1).WriteTo(&out)
+	assertNil(t, err)
+	assertEqual(t, long+"\n{\"k\": "+long+"}\n", out.String())
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func describe(mv *jstream.MetaValue) string {
+	return fmt.Sprintf("%d %d %d %d %q %d %d %v %v %v", mv.Offset, mv.Length, mv.Line, mv.Depth, mv.Keys, mv.Index, mv.ParentOffset, mv.Value, mv.ValueType, mv.Err)
+}
+
+func TestDecoderPoolMetaValues(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&sb, `{"id": %d, "tags": ["a", "b"], "nested": {"n": [%d, {}]}}`+"\n", i, i)
+	}
+	body := sb.String()
+
+	modes := map[string]func(*jstream.Decoder) *jstream.Decoder{
+		"default": nil,
+		"kv":      (*jstream.Decoder).EmitKV,
+		"ndjson":  (*jstream.Decoder).NDJSON,
+	}
+	for name, options := range modes {
+		want, err := decodeAll(body, -1, options)
+		assertNil(t, err)
+
+		// values released as soon as they are received
+		decoder := jstream.NewDecoder(mkReader(body), -1).PoolMetaValues()
+		if options != nil {
+			decoder = options(decoder)
+		}
+		var i int
+		for mv := range decoder.Stream() {
+			if got := describe(mv); got != describe(want[i]) {
+				t.Fatalf("%s: value %d: expected %s, got %s", name, i, describe(want[i]), got)
+			}
+			decoder.Release(mv)
+			i++
+		}
+		assertNil(t, decoder.Err())
+		assertEqual(t, len(want), i)
+
+		// and from within Walk
+		decoder = jstream.NewDecoder(mkReader(body), -1).PoolMetaValues()
+		if options != nil {
+			decoder = options(decoder)
+		}
+		i = 0
+		assertNil(t, decoder.Walk(func(mv *jstream.MetaValue) error {
+			if got := describe(mv); got != describe(want[i]) {
+				t.Fatalf("%s: value %d: expected %s, got %s", name, i, describe(want[i]), got)
+			}
+			decoder.Release(mv)
+			i++
+			return nil
+		}))
+		assertEqual(t, len(want), i)
+	}
+
+	// values shared with subscribers are not released
+	decoder := jstream.NewDecoder(mkReader(`[1, 2, 3]`), 1).PoolMetaValues()
+	sub := decoder.Subscribe(3)
+	for mv := range decoder.Stream() {
+		decoder.Release(mv)
+	}
+	var sum int64
+	for mv := range sub {
+		sum += mv.Value.(int64)
+	}
+	assertEqual(t, int64(6), sum)
+}
+
+func BenchmarkDecoderPoolMetaValues(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 100000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, "%d", i)
+	}
+	sb.WriteString("]")
+	body := []byte(sb.String())
+
+	for _, pooled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pooled=%t", pooled), func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				decoder := jstream.NewDecoder(bytes.NewReader(body), 1)
+				if pooled {
+					decoder.PoolMetaValues()
+				}
+				for mv := range decoder.Stream() {
+					decoder.Release(mv)
+				}
+			}
+		})
+	}
+}
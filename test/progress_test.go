@@ -0,0 +1,98 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderOnProgress(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&b, `{"id": %d, "tags": ["a", "b"]} `, i)
+	}
+	body := b.String()
+
+	const every = 10000
+	var bytes, values []int64
+	decoder := jstream.NewDecoder(iotest.HalfReader(strings.NewReader(body)), 1).
+		OnProgress(func(bytesRead, valuesEmitted int64) {
+			bytes = append(bytes, bytesRead)
+			values = append(values, valuesEmitted)
+		}, every)
+
+	var emitted int64
+	for range decoder.Stream() {
+		emitted++
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, int64(10000), emitted)
+
+	n := len(bytes)
+	assertTrue(t, n >= len(body)/every)
+	assertTrue(t, n <= len(body)/every+1)
+	for i := 1; i < n; i++ {
+		assertTrue(t, values[i] >= values[i-1])
+		if i < n-1 {
+			assertTrue(t, bytes[i]-bytes[i-1] >= every)
+		} else {
+			assertTrue(t, bytes[i] >= bytes[i-1])
+		}
+	}
+	// the final call reports the totals
+	assertEqual(t, int64(decoder.GetPos()), bytes[n-1])
+	assertEqual(t, emitted, values[n-1])
+}
+
+func TestDecoderOnProgressLargeValue(t *testing.T) {
+	// progress is reported while decoding a single large value
+	body := "[" + strings.Repeat(`"abcdefghij", `, 20000) + "0]"
+	var calls int
+	decoder := jstream.NewDecoder(strings.NewReader(body), 0).
+		OnProgress(func(bytesRead, valuesEmitted int64) {
+			if calls++; bytesRead < int64(len(body)) {
+				assertEqual(t, int64(0), valuesEmitted)
+			}
+		}, 4096)
+	for range decoder.Stream() {
+	}
+	assertNil(t, decoder.Err())
+	assertTrue(t, calls >= len(body)/(2*4096))
+}
+
+func TestDecoderOnProgressSmallInterval(t *testing.T) {
+	// a small interval with a minimal channel buffer, and a slow consumer
+	var b strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&b, "%d,", i)
+	}
+	body := "[" + b.String() + "0]"
+
+	var positions []int64
+	decoder := jstream.NewDecoder(strings.NewReader(body), 1).ChannelBuffer(1).
+		OnProgress(func(bytesRead, _ int64) { positions = append(positions, bytesRead) }, 64)
+	var n int
+	for range decoder.Stream() {
+		n++
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 20001, n)
+	assertTrue(t, len(positions) >= len(body)/(2*64))
+	for i := 1; i < len(positions); i++ {
+		assertTrue(t, positions[i] > positions[i-1])
+	}
+
+	// the decoder may be closed from the callback
+	decoder = jstream.NewDecoder(strings.NewReader(body), 1).ChannelBuffer(1)
+	decoder.OnProgress(func(bytesRead, _ int64) {
+		if bytesRead > 1000 {
+			decoder.Close()
+		}
+	}, 64)
+	for range decoder.Stream() {
+	}
+	assertEqual(t, jstream.ErrClosed, decoder.Err())
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package test
+
+// raceEnabled reports whether tests run with the race detector, whose
+// instrumentation allocates
+const raceEnabled = true
@@ -0,0 +1,56 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderRawStrings(t *testing.T) {
+	body := `{"caf\u00e9": "line\none", "plain": "text", "esc\"aped": ["\u00e9\\\/", ""]}`
+
+	values, err := decodeAll(body, -1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.RawStrings().EmitKV()
+	})
+	assertNil(t, err)
+
+	var got []string
+	for _, mv := range values {
+		switch v := mv.Value.(type) {
+		case jstream.KV:
+			if s, ok := v.Value.(string); ok {
+				got = append(got, v.Key+"="+s)
+			}
+		case string:
+			got = append(got, strings.Join(mv.Keys, ".")+"="+v)
+		}
+	}
+	expected := []string{
+		`caf\u00e9=line\none`,
+		`plain=text`,
+		`esc\"aped.=\u00e9\\\/`,
+		`esc\"aped.=`,
+	}
+	assertEqual(t, strings.Join(expected, " "), strings.Join(got, " "))
+
+	// the root object is built with raw keys
+	obj := values[len(values)-1].Value.(map[string]interface{})
+	assertEqual(t, `line\none`, obj[`caf\u00e9`])
+
+	// key filters match raw keys
+	values, err = decodeAll(body, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.RawStrings().FilterKeys(`caf\u00e9`)
+	})
+	assertNil(t, err)
+	assertEqual(t, 1, len(values))
+	assertEqual(t, `line\none`, values[0].Value)
+}
+
+func TestDecoderRawStringsInvalid(t *testing.T) {
+	for _, body := range []string{`"\x"`, `"\u00g0"`, `"\u00"`, "\"a\nb\"", `"unterminated`, `"trailing\`} {
+		if _, err := decodeAll(body, 0, (*jstream.Decoder).RawStrings); err == nil {
+			t.Errorf("%s: expected error", body)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderDecodeValueAt(t *testing.T) {
+	body := `{"people": [{"name": "Ada", "born": 1815}, {"name": "Alan", "tags": ["a", "b"]}]}
+[1.5, "two\n", null]
+"three"`
+	path := filepath.Join(t.TempDir(), "values.json")
+	assertNil(t, os.WriteFile(path, []byte(body), 0o644))
+	f, err := os.Open(path)
+	assertNil(t, err)
+	defer f.Close()
+	info, err := f.Stat()
+	assertNil(t, err)
+
+	decoder := jstream.NewDecoderReaderAt(f, info.Size(), -1).ObjectAsKVS()
+	values, err := decoder.ReadAll()
+	assertNil(t, err)
+	assertEqual(t, 15, len(values))
+
+	for _, mv := range values {
+		got, err := decoder.DecodeValueAt(mv.Offset, mv.Length)
+		assertNil(t, err)
+		assertEqual(t, mv.Offset, got.Offset)
+		assertEqual(t, mv.Length, got.Length)
+		assertEqual(t, mv.ValueType, got.ValueType)
+		assertEqual(t, fmt.Sprint(mv.Value), fmt.Sprint(got.Value))
+	}
+
+	// the range must hold exactly one value
+	_, err = decoder.DecodeValueAt(values[0].Offset, values[0].Length-1)
+	assertNotNil(t, err)
+	_, err = decoder.DecodeValueAt(0, int64(len(body)))
+	assertNotNil(t, err)
+
+	// a range holding only whitespace reports the input ending
+	_, err = decoder.DecodeValueAt(int64(len(body)), 0)
+	assertTrue(t, errors.Is(err, io.ErrUnexpectedEOF))
+	space := bytes.NewReader([]byte("[1]  \n"))
+	_, err = jstream.NewDecoderReaderAt(space, space.Size(), 0).DecodeValueAt(3, 3)
+	assertTrue(t, errors.Is(err, io.ErrUnexpectedEOF))
+
+	// DecodeValueAt requires an io.ReaderAt
+	_, err = jstream.NewDecoder(mkReader(body), 0).DecodeValueAt(0, 1)
+	assertTrue(t, errors.Is(err, jstream.ErrNotReaderAt))
+}
+
+// failingReaderAt reads data as bytes.Reader, but fails reading past
+// failAt
+type failingReaderAt struct {
+	data   []byte
+	failAt int64
+}
+
+var errReadAt = errors.New("read failed")
+
+func (r *failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.failAt {
+		return 0, errReadAt
+	}
+	if off+int64(len(p)) > r.failAt {
+		return copy(p, r.data[off:r.failAt]), errReadAt
+	}
+	return bytes.NewReader(r.data).ReadAt(p, off)
+}
+
+func TestDecoderReaderAtError(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&sb, `{"id": %d},`, i)
+	}
+	sb.WriteString("null]")
+	body := []byte(sb.String())
+	r := &failingReaderAt{data: body, failAt: int64(len(body) / 2)}
+
+	// decoding ends where reading fails, with Err reporting its error
+	decoder := jstream.NewDecoderReaderAt(r, int64(len(body)), 1)
+	values, err := decoder.ReadAll()
+	assertEqual(t, errReadAt, err)
+	assertEqual(t, errReadAt, decoder.Err())
+	assertTrue(t, len(values) > 0)
+
+	// values before the failure are decoded, and those spanning it not
+	mv, err := decoder.DecodeValueAt(values[0].Offset, values[0].Length)
+	assertNil(t, err)
+	assertEqual(t, "map[id:0]", fmt.Sprint(mv.Value))
+	_, err = decoder.DecodeValueAt(0, int64(len(body)))
+	assertEqual(t, errReadAt, err)
+
+	decoder = jstream.NewDecoderAt(r, 0, 1)
+	for range decoder.Stream() {
+	}
+	assertEqual(t, errReadAt, decoder.Err())
+}
@@ -0,0 +1,151 @@
+package test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func decodeAll(body string, depth int, options func(*jstream.Decoder) *jstream.Decoder) ([]*jstream.MetaValue, error) {
+	decoder := jstream.NewDecoder(mkReader(body), depth)
+	if options != nil {
+		decoder = options(decoder)
+	}
+	var values []*jstream.MetaValue
+	for mv := range decoder.Stream() {
+		values = append(values, mv)
+	}
+	return values, decoder.Err()
+}
+
+func TestDecoderRelaxed(t *testing.T) {
+	tests := []struct {
+		relaxed string
+		strict  string
+	}{
+		{`'single'`, `"single"`},
+		{`'with "double" quotes'`, `"with \"double\" quotes"`},
+		{`'escaped \' quote\n'`, `"escaped ' quote\n"`},
+		{`["mixed", 'quotes']`, `["mixed", "quotes"]`},
+		{`{key: 1, _under_score: 2, $dollar9: 3}`, `{"key": 1, "_under_score": 2, "$dollar9": 3}`},
+		{`{'quoted': 'key'}`, `{"quoted": "key"}`},
+		{`{a:{b:[1]}}`, `{"a": {"b": [1]}}`},
+		{`0x1F`, `31`},
+		{`[0XfF, -0x10, 0x0, 0]`, `[255, -16, 0, 0]`},
+		{`{n: 0x7fffffffffffffff}`, `{"n": 9223372036854775807}`},
+		{`-0x8000000000000000`, `-9223372036854775808`},
+	}
+
+	relaxed := (*jstream.Decoder).Relaxed
+	for _, test := range tests {
+		for _, depth := range []int{0, -1} {
+			want, err := decodeAll(test.strict, depth, nil)
+			assertNil(t, err)
+			got, err := decodeAll(test.relaxed, depth, relaxed)
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", test.relaxed, err)
+				continue
+			}
+			if len(got) != len(want) {
+				t.Errorf("%s: expected %d values, got %d", test.relaxed, len(want), len(got))
+				continue
+			}
+			for i := range want {
+				if !reflect.DeepEqual(want[i].Value, got[i].Value) || want[i].ValueType != got[i].ValueType {
+					t.Errorf("%s: expected %#v, got %#v", test.relaxed, want[i].Value, got[i].Value)
+				}
+				if !reflect.DeepEqual(want[i].Keys, got[i].Keys) {
+					t.Errorf("%s: expected keys %q, got %q", test.relaxed, want[i].Keys, got[i].Keys)
+				}
+			}
+		}
+
+		// the relaxed grammar is rejected by default
+		if _, err := decodeAll(test.relaxed, 0, nil); err == nil {
+			t.Errorf("%s: expected error without Relaxed", test.relaxed)
+		}
+	}
+}
+
+func TestDecoderRelaxedBigInt(t *testing.T) {
+	// hexadecimal literals out of range are decoded as decimal ones are
+	tests := []struct {
+		relaxed string
+		strict  string
+	}{
+		{`0x10000000000000000`, `18446744073709551616`},
+		{`-0x8000000000000001`, `-9223372036854775809`},
+		{`[0xffffffffffffffffff, -0x10]`, `[4722366482869645213695, -16]`},
+	}
+	for _, test := range tests {
+		want, err := decodeAll(test.strict, -1, (*jstream.Decoder).UseBigInt)
+		assertNil(t, err)
+		got, err := decodeAll(test.relaxed, -1, func(d *jstream.Decoder) *jstream.Decoder {
+			return d.Relaxed().UseBigInt()
+		})
+		assertNil(t, err)
+		assertEqual(t, len(want), len(got))
+		for i := range want {
+			assertEqual(t, fmt.Sprintf("%T %v", want[i].Value, want[i].Value), fmt.Sprintf("%T %v", got[i].Value, got[i].Value))
+		}
+	}
+}
+
+func TestDecoderRelaxedRejected(t *testing.T) {
+	tests := []string{
+		`{1a: 1}`,
+		`{a-b: 1}`,
+		`{a b: 1}`,
+		`{a 1}`,
+		`'unterminated`,
+		`'mismatched"`,
+		`0x`,
+		`-0x`,
+		`[-0x]`,
+		`0xg1`,
+		`0x1.5`,
+		`0x8000000000000000`,
+		`[a]`,
+		`{"a": b}`,
+	}
+	for _, body := range tests {
+		if _, err := decodeAll(body, 0, (*jstream.Decoder).Relaxed); err == nil {
+			t.Errorf("%s: expected error", body)
+		}
+	}
+
+	// hexadecimal literals without digits are reported with their position
+	hexTests := []struct {
+		body string
+		err  string
+	}{
+		{`0x`, `unexpected end of JSON input in hexadecimal numeric literal: '\x00' [1,3] offset 2`},
+		{`-0x`, `unexpected end of JSON input in hexadecimal numeric literal: '\x00' [1,4] offset 3`},
+		{`[-0x]`, `invalid character in hexadecimal numeric literal: ']' [1,5] offset 4`},
+	}
+	for _, test := range hexTests {
+		_, err := decodeAll(test.body, 0, (*jstream.Decoder).Relaxed)
+		_, ok := err.(jstream.SyntaxError)
+		assertTrue(t, ok)
+		assertEqual(t, test.err, errorLine(err))
+	}
+}
+
+func TestDecoderRelaxedSkipped(t *testing.T) {
+	// relaxed syntax within values skipped by a key filter
+	body := `{skip: {'a': [0x1, b]}, keep: 'yes'}`
+	values, err := decodeAll(body, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.Relaxed().FilterKeys("keep")
+	})
+	assertEqual(t, 0, len(values))
+	assertNotNil(t, err) // b is not a value
+
+	values, err = decodeAll(`{skip: {'a': [0x1, {b: 2}]}, keep: 'yes'}`, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.Relaxed().FilterKeys("keep")
+	})
+	assertNil(t, err)
+	assertEqual(t, 1, len(values))
+	assertEqual(t, "yes", values[0].Value)
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderScanKeys(t *testing.T) {
+	body := `{
+  "1": {
+    "bio": "bada bing bada boom",
+    "id": 0,
+    "name": "Roberto",
+    "nested1": {
+      "bio": "utf16 surrogate (\ud834\udcb2)\n\u201cutf 8\u201d",
+      "id": 1.5,
+      "name": "Roberto*Maestro",
+      "nested2": { "nested2arr": [0,1,2], "nested3": {
+        "nested4": { "depth": "recursion" }}
+			}
+		}
+  },
+  "2": {
+    "nullfield": null,
+    "id": -2
+  }
+}`
+	scan := func(body string, depth, maxDepth int) (string, error) {
+		decoder := jstream.NewDecoder(mkReader(body), depth)
+		var lines []string
+		for info := range decoder.ScanKeys(maxDepth) {
+			lines = append(lines, fmt.Sprintf("%s %s %d", jstream.FormatPath(info.Path), info.ValueType, info.Count))
+		}
+		return strings.Join(lines, "\n"), decoder.Err()
+	}
+
+	// the emit depth does not apply
+	for _, depth := range []int{0, 2, -1} {
+		paths, err := scan(body, depth, -1)
+		assertNil(t, err)
+		assertEqual(t, `/1 object 1
+/1/bio string 1
+/1/id number 1
+/1/name string 1
+/1/nested1 object 1
+/1/nested1/bio string 1
+/1/nested1/id number 1
+/1/nested1/name string 1
+/1/nested1/nested2 object 1
+/1/nested1/nested2/nested2arr array 1
+/1/nested1/nested2/nested2arr/ number 3
+/1/nested1/nested2/nested3 object 1
+/1/nested1/nested2/nested3/nested4 object 1
+/1/nested1/nested2/nested3/nested4/depth string 1
+/2 object 1
+/2/nullfield null 1
+/2/id number 1`, paths)
+	}
+
+	paths, err := scan(body, 0, 2)
+	assertNil(t, err)
+	assertEqual(t, `/1 object 1
+/1/bio string 1
+/1/id number 1
+/1/name string 1
+/1/nested1 object 1
+/2 object 1
+/2/nullfield null 1
+/2/id number 1`, paths)
+
+	// array indices are collapsed, and values counted by type across documents
+	paths, err = scan(`[{"a": 1, "b": []}, {"a": "x"}, {"a": 2, "b": [true, [false]]}] [{"a": null}]`, 0, -1)
+	assertNil(t, err)
+	assertEqual(t, `/ object 4
+//a number 2
+//b array 2
+//a string 1
+//b/ boolean 1
+//b/ array 1
+//b// boolean 1
+//a null 1`, paths)
+
+	// the paths found before an error are reported
+	paths, err = scan(`{"a": {"b": 1}, "c": [2, x]}`, 0, -1)
+	assertEqual(t, "/a object 1\n/a/b number 1\n/c array 1\n/c/ number 2", paths)
+	assertEqual(t, "invalid character looking for beginning of value: 'x' [1,26] offset 25", errorLine(err))
+
+	_, err = scan(`{"a": [1, `, 0, -1)
+	assertEqual(t, "unexpected end of JSON input : '\\x00' [1,11] offset 10", errorLine(err))
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"sync/atomic"
 	"testing"
+	"testing/iotest"
 
 	"github.com/xenking/jstream/internal/scanner"
 )
@@ -32,6 +33,167 @@ func TestScanner(t *testing.T) {
 	}
 }
 
+func TestScannerNestedCapture(t *testing.T) {
+	data := make([]byte, 3*4095+100)
+	for i := range data {
+		data[i] = byte('a' + i%26)
+	}
+
+	// captures spanning refills, nested within an outer capture
+	s := scanner.New(iotest.OneByteReader(bytes.NewReader(data)))
+	s.Next()
+	s.StartCapture()
+	for _, span := range [][2]int{{10, 20}, {4000, 4200}, {5000, 9000}} {
+		for s.Pos <= int64(span[0]) {
+			s.Next()
+		}
+		s.StartCapture()
+		for s.Pos < int64(span[1]) {
+			s.Next()
+		}
+		s.Next()
+		s.Back() // rewinding leaves the capture ending at the current position
+		assertEqual(t, string(data[span[0]:span[1]]), string(s.Captured()))
+	}
+	for s.Pos < 10000 {
+		s.Next()
+	}
+	assertEqual(t, string(data[:10000]), string(s.Captured()))
+}
+
+func TestScannerBackN(t *testing.T) {
+	data := make([]byte, 3*4095+100)
+	for i := range data {
+		data[i] = byte('a' + i%26)
+	}
+
+	readers := map[string]func() io.Reader{
+		"chunked":  func() io.Reader { return bytes.NewReader(data) },
+		"one byte": func() io.Reader { return iotest.OneByteReader(bytes.NewReader(data)) },
+	}
+	for name, mkr := range readers {
+		t.Run(name, func(t *testing.T) {
+			s := scanner.New(mkr())
+			assertEqual(t, scanner.DefaultLookback, s.Lookback())
+
+			// advance through the input, periodically rewinding by up to the
+			// full lookback window; positions near 4095 rewind across a refill
+			for i := 0; i < len(data); i++ {
+				assertEqual(t, data[i], s.Next())
+				if i%7 != 0 || i < s.Lookback() {
+					continue
+				}
+				n := 1 + i%s.Lookback()
+				s.BackN(n)
+				assertEqual(t, int64(i+1-n), s.Pos)
+				assertEqual(t, data[i-n], s.Cur())
+				for j := i - n + 1; j <= i; j++ {
+					assertEqual(t, data[j], s.Next())
+				}
+			}
+
+			// rewind from the virtual EOF byte
+			assertEqual(t, byte(0), s.Next())
+			assertTrue(t, s.EOF())
+			s.BackN(3)
+			assertEqual(t, data[len(data)-3], s.Cur())
+			assertEqual(t, data[len(data)-2], s.Next())
+			assertEqual(t, data[len(data)-1], s.Next())
+			assertEqual(t, byte(0), s.Next())
+		})
+	}
+}
+
+func TestScannerBackNBoundary(t *testing.T) {
+	// the full window is available immediately after a refill, but no more
+	data := make([]byte, 4095+10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	s := scanner.NewLookback(bytes.NewReader(data), 64)
+	for i := 0; i < 4095+1; i++ {
+		s.Next()
+	}
+	assertPanics(t, func() { s.BackN(65) })
+	s.BackN(64)
+	assertEqual(t, data[4095-64], s.Cur())
+	for i := 4095 - 64 + 1; i < len(data); i++ {
+		assertEqual(t, data[i], s.Next())
+	}
+}
+
+func TestScannerBackStart(t *testing.T) {
+	s := scanner.New(bytes.NewReader([]byte("abc")))
+	s.Next()
+	s.Next()
+	s.BackN(2)
+	assertEqual(t, int64(0), s.Pos)
+	assertEqual(t, byte('a'), s.Next())
+	assertPanics(t, func() { s.BackN(2) })
+}
+
+func TestScannerBytes(t *testing.T) {
+	s := scanner.NewBytes([]byte("abc"), 10)
+	for _, input := range []string{"abc", "", "longer input"} {
+		if input != "abc" {
+			s.Reset([]byte(input), 10)
+		}
+		var got []byte
+		for c := s.Next(); !s.EOF(); c = s.Next() {
+			got = append(got, c)
+		}
+		assertEqual(t, input, string(got))
+		assertEqual(t, int64(10+len(input)), s.End)
+		assertEqual(t, byte(0), s.Cur())
+		assertEqual(t, byte(0), s.Next())
+		if input != "" {
+			s.Back()
+			assertEqual(t, input[len(input)-1], s.Cur())
+		}
+	}
+}
+
+func TestScannerPeek(t *testing.T) {
+	data := make([]byte, 2*4095+3)
+	for i := range data {
+		data[i] = byte('a' + i%26)
+	}
+
+	for _, at := range []int{0, 4093, 4094, 4095, 2 * 4095, len(data) - 1} {
+		for _, r := range []io.Reader{bytes.NewReader(data), iotest.OneByteReader(bytes.NewReader(data))} {
+			s := scanner.New(r)
+			for i := 0; i < at; i++ {
+				s.Next()
+			}
+			// peeking repeatedly neither advances nor corrupts the stream
+			assertEqual(t, data[at], s.Peek())
+			assertEqual(t, data[at], s.Peek())
+			assertEqual(t, int64(at), s.Pos)
+			for i := at; i < len(data); i++ {
+				assertEqual(t, data[i], s.Next())
+				if i+1 < len(data) {
+					assertEqual(t, data[i+1], s.Peek())
+				}
+			}
+			assertEqual(t, byte(0), s.Peek())
+			assertFalse(t, s.EOF())
+			assertEqual(t, byte(0), s.Next())
+			assertTrue(t, s.EOF())
+			assertEqual(t, byte(0), s.Peek())
+		}
+	}
+}
+
+func assertPanics(t *testing.T, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	fn()
+}
+
 func BenchmarkBufioScanner(b *testing.B) {
 	b.Run("small", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
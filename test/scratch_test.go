@@ -0,0 +1,38 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/xenking/jstream/internal/scratch"
+)
+
+func TestScratchResetCap(t *testing.T) {
+	s := &scratch.Scratch{Data: make([]byte, 1024)}
+
+	// a single large value grows the buffer well beyond its initial size
+	for i := 0; i < 1<<20; i++ {
+		s.Add('a')
+	}
+	if n := len(s.Bytes()); n != 1<<20 {
+		t.Fatalf("expected %d bytes, got %d", 1<<20, n)
+	}
+
+	s.ResetCap(4096)
+	assertEqual(t, 0, len(s.Bytes()))
+	assertEqual(t, 4096, cap(s.Data))
+
+	// many small values afterward stay within the capped buffer
+	for i := 0; i < 1000; i++ {
+		s.ResetCap(4096)
+		for _, c := range []byte("small value") {
+			s.Add(c)
+		}
+		assertEqual(t, "small value", string(s.Bytes()))
+	}
+	assertEqual(t, 4096, cap(s.Data))
+
+	// buffers within the cap are kept as is
+	data := s.Data
+	s.ResetCap(1 << 20)
+	assertEqual(t, &data[0], &s.Data[0])
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderSeekTo(t *testing.T) {
+	var docs []string
+	for i := 0; i < 1000; i++ {
+		docs = append(docs, fmt.Sprintf(`{"id": %d, "v": [%d, "%d"]}`, i, i*i, i))
+	}
+	body := []byte(strings.Join(docs, "\n") + "\n")
+
+	// decode the first half, checkpointing after each document
+	var (
+		checkpoint int64
+		n          int
+		stop       = errors.New("stop")
+	)
+	decoder := jstream.NewDecoder(bytes.NewReader(body), 0)
+	err := decoder.Walk(func(mv *jstream.MetaValue) error {
+		if n == 500 {
+			checkpoint = int64(mv.Offset)
+			return stop
+		}
+		n++
+		return nil
+	})
+	assertEqual(t, stop, err)
+
+	// resume with a fresh decoder
+	decoder = jstream.NewDecoder(bytes.NewReader(body), 0)
+	assertNil(t, decoder.SeekTo(checkpoint))
+	for mv := range decoder.Stream() {
+		assertEqual(t, docs[n], string(body[mv.Offset:mv.Offset+mv.Length]))
+		assertEqual(t, int64(n), mv.Value.(map[string]interface{})["id"])
+		assertEqual(t, n-499, mv.Line)
+		n++
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 1000, n)
+	assertEqual(t, len(body), decoder.GetPos())
+}
+
+func TestDecoderSeekToError(t *testing.T) {
+	body := "[1]\n[2, }\n"
+	decoder := jstream.NewDecoder(strings.NewReader(body), 0)
+	assertNil(t, decoder.SeekTo(4))
+	for range decoder.Stream() {
+	}
+	// positions are reported relative to the line at the offset
+	assertEqual(t, "invalid character looking for beginning of value: '}' [1,5] offset 8", errorLine(decoder.Err()))
+}
+
+func TestDecoderSeekToEncoded(t *testing.T) {
+	enc := textEncodings[1] // UTF-16BE
+	body := append(append([]byte{}, enc.bom...), enc.encode(`["é"] {"a": "😀"} [3]`)...)
+
+	decoder := jstream.NewDecoder(bytes.NewReader(body), 0)
+	var offsets []int64
+	for mv := range decoder.Stream() {
+		offsets = append(offsets, mv.Offset)
+	}
+	assertEqual(t, 3, len(offsets))
+
+	decoder = jstream.NewDecoder(bytes.NewReader(body), 0)
+	assertNil(t, decoder.SeekTo(int64(offsets[1])))
+	var values []string
+	for mv := range decoder.Stream() {
+		values = append(values, enc.decode(body[mv.Offset:mv.Offset+mv.Length]))
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, `[{"a": "😀"} [3]]`, fmt.Sprint(values))
+}
+
+func TestDecoderSeekToNotSeekable(t *testing.T) {
+	decoder := jstream.NewDecoder(io.MultiReader(strings.NewReader("[1] [2]")), 0)
+	assertEqual(t, jstream.ErrNotSeekable, decoder.SeekTo(4))
+
+	// the decoder remains usable
+	var values int
+	for range decoder.Stream() {
+		values++
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 2, values)
+}
+
+func TestNewDecoderAt(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&b, "{\"id\": %d, \"tags\": [\"t%d\", {\"n\": %d.5}], \"s\": \"%s\"}\n", i, i, i, strings.Repeat("x", i))
+	}
+	body := b.String()
+	r := strings.NewReader(body)
+
+	// index every value from a full pass
+	index := make(map[int64]*jstream.MetaValue)
+	decoder := jstream.NewDecoder(strings.NewReader(body), -1)
+	for mv := range decoder.Stream() {
+		index[mv.Offset] = mv
+	}
+	assertNil(t, decoder.Err())
+
+	for offset, want := range index {
+		if offset%7 != 0 {
+			continue
+		}
+		decoder := jstream.NewDecoderAt(r, offset, 0)
+		var got []*jstream.MetaValue
+		for mv := range decoder.Stream() {
+			got = append(got, mv)
+		}
+		assertNil(t, decoder.Err())
+		assertEqual(t, 1, len(got))
+		assertEqual(t, want.Offset, got[0].Offset)
+		assertEqual(t, want.Length, got[0].Length)
+		assertEqual(t, want.ValueType, got[0].ValueType)
+		assertEqual(t, fmt.Sprint(want.Value), fmt.Sprint(got[0].Value))
+		assertEqual(t, 1, got[0].Line)
+	}
+}
+
+func TestNewDecoderAtNested(t *testing.T) {
+	body := `{"a": {"b": [1, 2, {"c": 3}]}, "d": 4}`
+	offset := int64(strings.Index(body, "["))
+
+	decoder := jstream.NewDecoderAt(strings.NewReader(body), offset, -1)
+	var offsets []int64
+	for mv := range decoder.Stream() {
+		offsets = append(offsets, mv.Offset)
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, "[13 16 25 19 12]", fmt.Sprint(offsets))
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func decodeSeq(body string, skipInvalid bool) (values []interface{}, warnings []error, err error) {
+	decoder := jstream.NewDecoder(strings.NewReader(body), 0).JSONSeq(skipInvalid).
+		OnWarning(func(err error) { warnings = append(warnings, err) })
+	for mv := range decoder.Stream() {
+		values = append(values, mv.Value)
+	}
+	return values, warnings, decoder.Err()
+}
+
+func TestDecoderJSONSeq(t *testing.T) {
+	body := "\x1e{\"a\":1}\n\x1e[1, 2]\n\x1e\"x\"\n\x1e42\n\x1etrue\x1e\n\x1e null \n"
+
+	values, warnings, err := decodeSeq(body, false)
+	assertNil(t, err)
+	assertEqual(t, 0, len(warnings))
+	assertEqual(t, "[map[a:1] [1 2] x 42 true <nil>]", fmt.Sprint(values))
+}
+
+func TestDecoderJSONSeqTruncated(t *testing.T) {
+	body := "\x1e{\"a\":1}\n" +
+		"\x1e{\"b\": [1, \x1e{\"c\":3}\n" + // truncated object
+		"\x1e12\x1e" + // truncated number
+		"\x1e4\n" +
+		"\x1e{\"d\":5} 6\n" + // two documents in a record
+		"\x1e\"e\"\n"
+
+	values, warnings, err := decodeSeq(body, true)
+	assertNil(t, err)
+	assertEqual(t, "[map[a:1] map[c:3] 4 e]", fmt.Sprint(values))
+	assertEqual(t, 3, len(warnings))
+
+	var invalid *jstream.InvalidRecordError
+	assertTrue(t, errors.As(warnings[0], &invalid))
+	assertEqual(t, `{"b": [1, `, body[invalid.Offset:invalid.Offset+invalid.Length])
+	assertTrue(t, errors.As(warnings[1], &invalid))
+	assertEqual(t, "12", body[invalid.Offset:invalid.Offset+invalid.Length])
+	assertTrue(t, errors.As(warnings[2], &invalid))
+	assertEqual(t, "{\"d\":5} 6\n", body[invalid.Offset:invalid.Offset+invalid.Length])
+
+	// without skipping, the first invalid record is an error
+	values, _, err = decodeSeq(body, false)
+	assertEqual(t, 1, len(values))
+	assertNotNil(t, err)
+}
+
+func TestDecoderJSONSeqNumberAtEOF(t *testing.T) {
+	// a final number not followed by a newline may have been truncated
+	values, warnings, err := decodeSeq("\x1e1\n\x1e23", true)
+	assertNil(t, err)
+	assertEqual(t, "[1]", fmt.Sprint(values))
+	assertEqual(t, 1, len(warnings))
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderSingleDocument(t *testing.T) {
+	tests := []struct {
+		body   string
+		values int
+		err    string
+	}{
+		{`{"a":1}`, 1, ""},
+		{" \n{\"a\":1} \r\n\t ", 1, ""},
+		{`"x"`, 1, ""},
+		{`{"a":1}{"b":2}`, 1, "unexpected data after top-level value : '{' [1,8] offset 7"},
+		{"{\"a\":1}\n{\"b\":2}", 1, "unexpected data after top-level value : '{' [2,1] offset 8"},
+		{`{"a":1} trailing junk`, 1, "unexpected data after top-level value : 't' [1,9] offset 8"},
+		{`1 2`, 1, "unexpected data after top-level value : '2' [1,3] offset 2"},
+		{"[1]\x00", 1, "unexpected data after top-level value : '\\x00' [1,4] offset 3"},
+		{"", 0, "unexpected end of JSON input : '\\x00' [1,1] offset 0"},
+		{"  \n", 0, "unexpected end of JSON input : '\\x00' [2,1] offset 3"},
+	}
+
+	for _, test := range tests {
+		values, err := decodeAll(test.body, 0, (*jstream.Decoder).SingleDocument)
+		assertEqual(t, test.values, len(values))
+		if test.err == "" {
+			assertNil(t, err)
+		} else if errorLine(err) != test.err {
+			t.Errorf("%q: expected error %q, got %v", test.body, test.err, err)
+		}
+	}
+
+	// multiple documents remain accepted by default
+	values, err := decodeAll(`{"a":1}{"b":2} 3`, 0, nil)
+	assertNil(t, err)
+	assertEqual(t, 3, len(values))
+}
+
+func TestDecoderConcatenatedDocuments(t *testing.T) {
+	tests := []struct {
+		body   string
+		values int
+		err    string
+	}{
+		{`{}{}`, 2, ""},
+		{`{} {}`, 2, ""},
+		{"{}\n[]\n\"x\"-1", 4, ""},
+		{`{} ,`, 1, "invalid character after top-level value: ',' [1,4] offset 3"},
+		{`{} x`, 1, "invalid character after top-level value: 'x' [1,4] offset 3"},
+		{"[1]\n ]", 1, "invalid character after top-level value: ']' [2,2] offset 5"},
+		{`{} tru`, 1, "unexpected end of JSON input in literal true: '\\x00' [1,7] offset 6"},
+	}
+	for _, test := range tests {
+		values, err := decodeAll(test.body, 0, nil)
+		assertEqual(t, test.values, len(values))
+		if test.err == "" {
+			assertNil(t, err)
+		} else if errorLine(err) != test.err {
+			t.Errorf("%q: expected error %q, got %v", test.body, test.err, err)
+		}
+	}
+
+	// the first value is checked as any other
+	_, err := decodeAll(`, {}`, 0, nil)
+	assertEqual(t, "invalid character looking for beginning of value: ',' [1,1] offset 0", errorLine(err))
+}
+
+func TestDecoderTopLevelScalars(t *testing.T) {
+	tests := []struct {
+		lit   string
+		value interface{}
+		typ   jstream.ValueType
+	}{
+		{`-17`, int64(-17), jstream.Number},
+		{`1.5e3`, 1500.0, jstream.Number},
+		{`null`, nil, jstream.Null},
+		{`true`, true, jstream.Boolean},
+		{`"hello"`, "hello", jstream.String},
+	}
+
+	options := map[string]func(*jstream.Decoder) *jstream.Decoder{
+		"default": nil,
+		"single":  (*jstream.Decoder).SingleDocument,
+	}
+	for _, test := range tests {
+		for name, option := range options {
+			for _, pad := range []string{"", " \n"} {
+				body := pad + test.lit + pad
+				// a top-level scalar is emitted at depth 0, spanning the literal
+				for _, depth := range []int{0, -1} {
+					values, err := decodeAll(body, depth, option)
+					assertNil(t, err)
+					assertEqual(t, 1, len(values))
+					mv := values[0]
+					assertEqual(t, 0, mv.Depth)
+					assertEqual(t, test.typ, mv.ValueType)
+					assertEqual(t, test.value, mv.Value)
+					assertEqual(t, int64(len(pad)), mv.Offset)
+					assertEqual(t, int64(len(test.lit)), mv.Length)
+					assertEqual(t, 0, len(mv.Keys))
+					assertEqual(t, -1, mv.Index)
+					assertEqual(t, int64(-1), mv.ParentOffset)
+				}
+
+				// and at no other depth
+				values, err := decodeAll(body, 1, option)
+				assertNil(t, err)
+				if len(values) != 0 {
+					t.Errorf("%s %q: expected no values at depth 1, got %d", name, body, len(values))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderSkipIf(t *testing.T) {
+	var elems []string
+	for i := 0; i < 100; i++ {
+		elems = append(elems, fmt.Sprintf(`{"id": %d, "tags": ["a", {"b": [1, 2]}], "s": "]}\"{["}`, i))
+	}
+	body := "[" + strings.Join(elems, ", ") + "]"
+
+	odd := func(keys []string) bool {
+		i, err := strconv.Atoi(keys[len(keys)-1])
+		assertNil(t, err)
+		return i%2 == 1
+	}
+	decoder := jstream.NewDecoder(strings.NewReader(body), 1).IndexedKeys().SkipIf(odd)
+
+	var n int
+	for mv := range decoder.Stream() {
+		assertEqual(t, elems[2*n], body[mv.Offset:mv.Offset+mv.Length])
+		assertEqual(t, strconv.Itoa(2*n), mv.Keys[0])
+		assertEqual(t, 2*n, mv.Index)
+		assertEqual(t, int64(2*n), mv.Value.(map[string]interface{})["id"])
+		n++
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 50, n)
+	assertEqual(t, len(body), decoder.GetPos())
+}
+
+func TestDecoderSkipIfObject(t *testing.T) {
+	body := `{"a": {"x": 1}, "b": [2, 3], "c": "4", "d": null}`
+	skip := func(keys []string) bool { return keys[0] == "b" || keys[0] == "d" }
+
+	for _, emitKV := range []bool{false, true} {
+		var seen []string
+		options := func(d *jstream.Decoder) *jstream.Decoder {
+			d = d.Recursive().SkipIf(func(keys []string) bool {
+				seen = append(seen, strings.Join(keys, "."))
+				return skip(keys)
+			})
+			if emitKV {
+				d = d.EmitKV()
+			}
+			return d
+		}
+		values, err := decodeAll(body, 1, options)
+		assertNil(t, err)
+
+		var got []string
+		for _, mv := range values {
+			got = append(got, body[mv.Offset:mv.Offset+mv.Length])
+		}
+		if emitKV {
+			assertEqual(t, `["x": 1 "a": {"x": 1} "c": "4"]`, fmt.Sprint(got))
+		} else {
+			assertEqual(t, `[1 {"x": 1} "4"]`, fmt.Sprint(got))
+		}
+		// the predicate is called only at the emit depth
+		assertEqual(t, "[a b c d]", fmt.Sprint(seen))
+	}
+}
+
+func TestDecoderSkipIfInvalid(t *testing.T) {
+	// skipped values are still checked to be well-formed
+	_, err := decodeAll(`[1, [2, }, 3]`, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.SkipIf(func([]string) bool { return true })
+	})
+	assertNotNil(t, err)
+}
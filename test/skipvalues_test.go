@@ -0,0 +1,79 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderSkipValues(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 2000; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, `{"id": %d, "name": "item %d", "tags": ["a", {"b": null}]}`, i, i)
+	}
+	sb.WriteString("]")
+	body := sb.String()
+
+	all, err := jstream.NewDecoder(mkReader(body), 1).ReadAll()
+	assertNil(t, err)
+
+	for _, window := range [][2]int{{0, 10}, {1500, 100}, {1995, 10}, {2000, 1}} {
+		values, err := jstream.NewDecoder(mkReader(body), 1).SkipValues(window[0]).Limit(window[1]).ReadAll()
+		assertNil(t, err)
+		expected := all[window[0]:]
+		if len(expected) > window[1] {
+			expected = expected[:window[1]]
+		}
+		assertEqual(t, len(expected), len(values))
+		for i, mv := range values {
+			assertEqual(t, fmt.Sprint(expected[i].Value), fmt.Sprint(mv.Value))
+			assertEqual(t, expected[i].Offset, mv.Offset)
+			assertEqual(t, expected[i].Length, mv.Length)
+			assertEqual(t, expected[i].Index, mv.Index)
+			assertEqual(t, fmt.Sprint(expected[i].Keys), fmt.Sprint(mv.Keys))
+		}
+	}
+
+	// members of objects, with EmitKV, and values of other documents
+	values, err := decodeAll(`{"a": 1, "b": 2, "c": 3} {"d": 4}`, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.EmitKV().SkipValues(2)
+	})
+	assertNil(t, err)
+	assertEqual(t, 2, len(values))
+	assertEqual(t, "c", values[0].Value.(jstream.KV).Key)
+	assertEqual(t, "d", values[1].Value.(jstream.KV).Key)
+
+	// values rejected by filters are not counted
+	values, err = decodeAll(`{"a": 1, "b": 2, "c": 3, "d": 4}`, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.FilterKeys("a", "c", "d").SkipValues(1)
+	})
+	assertNil(t, err)
+	assertEqual(t, "[3 4]", fmt.Sprint([]interface{}{values[0].Value, values[1].Value}))
+
+	// with Recursive, values within those skipped are not emitted
+	values, err = decodeAll(`[[1, 2], [3, 4]]`, 1, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.Recursive().SkipValues(1)
+	})
+	assertNil(t, err)
+	assertEqual(t, "[3 4 [3 4]]", fmt.Sprint([]interface{}{values[0].Value, values[1].Value, values[2].Value}))
+
+	// skipped values are not decoded
+	decode := func(skip int) float64 {
+		return testing.AllocsPerRun(5, func() {
+			decoder := jstream.NewDecoder(mkReader(body), 1).SkipValues(skip).Limit(1)
+			if _, err := decoder.ReadAll(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	skipped, first := decode(1999), decode(0)
+	if skipped > first+20 {
+		t.Errorf("skipping values allocated %v times, decoding the first %v times", skipped, first)
+	}
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestSyntaxErrorSnippet(t *testing.T) {
+	long := "[" + strings.Repeat("1, ", 30) + "x" + strings.Repeat(", 2", 30) + "]"
+	at := strings.IndexByte(long, 'x')
+
+	tests := []struct {
+		name    string
+		body    string
+		snippet string
+		caret   int
+	}{
+		{"start", `{"a": x}`, `{"a": x}`, 6},
+		{"first byte", `}`, `}`, 0},
+		{"middle", long, long[at-40 : at+41], 40},
+		{"control characters", "[1,\r\n\t x]", `[1,\r\n\t x]`, 10},
+		{"eof", `{"a": [1, 2`, `{"a": [1, 2`, 11},
+		{"eof after newline", "[1,\n", `[1,\n`, 5},
+	}
+	for _, test := range tests {
+		_, err := decodeAll(test.body, 1, nil)
+		if err == nil {
+			t.Errorf("%s: expected error", test.name)
+			continue
+		}
+		lines := strings.Split(err.Error(), "\n")
+		if len(lines) != 3 {
+			t.Errorf("%s: expected snippet in %q", test.name, err)
+			continue
+		}
+		assertEqual(t, "\t"+test.snippet, lines[1])
+		assertEqual(t, "\t"+strings.Repeat(" ", test.caret)+"^", lines[2])
+	}
+
+	// invalid UTF-8 is escaped, while valid multi-byte characters are
+	// kept, each counted as one column
+	_, err := decodeAll("[\"é\xffb\"]", 1, (*jstream.Decoder).StrictUTF8)
+	assertEqual(t, "[1,5] offset 4\n\t[\"é\\xffb\"]\n\t   ^", err.Error()[strings.Index(err.Error(), "[1,"):])
+
+	// the absolute offset of the error is reported
+	_, err = decodeAll("[1,\n 2,\n x]", 1, nil)
+	assertEqual(t, "invalid character looking for beginning of value: 'x' [3,2] offset 9", errorLine(err))
+
+	// the window is limited to the input still held just after a buffer
+	// refill
+	body := "[" + strings.Repeat(" ", 4094) + "x]"
+	_, err = decodeAll(body, 1, nil)
+	assertEqual(t, "invalid character looking for beginning of value: 'x' [1,4096] offset 4095", errorLine(err))
+	snippet := strings.Split(err.Error(), "\n")[1][1:]
+	if !strings.HasSuffix(snippet, " x]") || len(snippet) > 42 {
+		t.Errorf("unexpected snippet %q", snippet)
+	}
+
+	// an error for empty input has no snippet
+	_, err = decodeAll("", 0, (*jstream.Decoder).SingleDocument)
+	assertEqual(t, "unexpected end of JSON input : '\\x00' [1,1] offset 0", err.Error())
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestSplit(t *testing.T) {
+	const n = 10000
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteString(",\n ")
+		}
+		switch i % 3 {
+		case 0:
+			fmt.Fprintf(&sb, `{"id": %d, "text": "[{\"%d\"}]", "nested": {"a": ["]", "}"]}}`, i, i)
+		case 1:
+			fmt.Fprintf(&sb, `["\\", "\"]", %d]`, i)
+		default:
+			fmt.Fprintf(&sb, `"\"%d{"`, i)
+		}
+	}
+	sb.WriteString("]")
+	body := sb.String()
+
+	path := filepath.Join(t.TempDir(), "split.json")
+	assertNil(t, os.WriteFile(path, []byte(body), 0o644))
+	f, err := os.Open(path)
+	assertNil(t, err)
+	defer f.Close()
+
+	want, err := decodeAll(body, 1, nil)
+	assertNil(t, err)
+	segs, err := jstream.Split(f, 1)
+	assertNil(t, err)
+	assertEqual(t, n, len(segs))
+
+	for i, seg := range segs {
+		assertEqual(t, i, seg.Index)
+		assertEqual(t, want[i].Offset, seg.Offset)
+		assertEqual(t, want[i].Length, seg.Length)
+		if i%3 == 0 {
+			assertEqual(t, "id", seg.FirstKey)
+		} else {
+			assertEqual(t, "", seg.FirstKey)
+		}
+
+		values, err := jstream.NewDecoderAt(f, seg.Offset, 0).ReadAll()
+		assertNil(t, err)
+		assertEqual(t, 1, len(values))
+		if !reflect.DeepEqual(want[i].Value, values[0].Value) {
+			t.Fatalf("segment %d: expected %v, got %v", i, want[i].Value, values[0].Value)
+		}
+	}
+}
+
+func TestSplitDepth(t *testing.T) {
+	body := `{"a": [1, {}], "b": {"c": {"k": 2, "l": 3}}} [[4]] 5`
+	segs, err := jstream.Split(mkReader(body), 2)
+	assertNil(t, err)
+	var got []string
+	for _, seg := range segs {
+		got = append(got, fmt.Sprintf("%s %d %q", body[seg.Offset:seg.Offset+seg.Length], seg.Index, seg.FirstKey))
+	}
+	assertEqual(t, `1 0 ""|{} 1 ""|{"k": 2, "l": 3} -1 "k"|4 0 ""`, strings.Join(got, "|"))
+
+	// malformed input reports the segments found before the error
+	segs, err = jstream.Split(mkReader(`[1, 2, {"a": ]`), 1)
+	assertNotNil(t, err)
+	assertEqual(t, 2, len(segs))
+	_, err = jstream.Split(mkReader(`[1, "2]`), 1)
+	assertNotNil(t, err)
+}
+
+func TestDecoderCountValues(t *testing.T) {
+	multiDoc := strings.Repeat(`{ "bio": "bada bing bada boom", "id": 1, "name": "Charles", "tags": ["a\"]", {"b": [2]}] }`+"\n", 5)
+	for _, body := range []string{multiDoc, `[[1, 2], [], [3]] "s" [4]`, ``, ` `} {
+		for _, depth := range []int{0, 1, 2, 3} {
+			want, err := decodeAll(body, depth, nil)
+			assertNil(t, err)
+			n, err := jstream.NewDecoder(mkReader(body), depth).CountValues()
+			assertNil(t, err)
+			assertEqual(t, len(want), n)
+		}
+	}
+
+	// malformed input reports the values counted before the error
+	n, err := jstream.NewDecoder(mkReader(`[1, 2, {"a": }]`), 1).CountValues()
+	assertNotNil(t, err)
+	assertEqual(t, 2, n)
+	_, err = jstream.NewDecoder(mkReader(`[1, "2]`), 1).CountValues()
+	assertTrue(t, errors.Is(err, jstream.ErrUnexpectedEOF))
+
+	// nothing is allocated per value
+	body := "[" + strings.Repeat(`{"k": "v\n", "n": [1.5, true, null]}, `, 5000) + "{}]"
+	var decoders []*jstream.Decoder
+	for i := 0; i < 11; i++ {
+		decoders = append(decoders, jstream.NewDecoder(mkReader(body), 1))
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		decoders[0].CountValues()
+		decoders = decoders[1:]
+	})
+	if allocs > 10 {
+		t.Errorf("expected few allocations, got %.0f", allocs)
+	}
+	n, err = jstream.NewDecoder(mkReader(body), 1).CountValues()
+	assertNil(t, err)
+	assertEqual(t, 5001, n)
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+const statsBody = `{"a": [1, 2.5, "x", true, null], "b": {"c": {"d": [false, "y"]}}, "e": []}
+"top" 3`
+
+func TestDecoderCollectStats(t *testing.T) {
+	for _, depth := range []int{0, 1, -1} {
+		decoder := jstream.NewDecoder(strings.NewReader(statsBody), depth).CollectStats()
+		for range decoder.Stream() {
+		}
+		assertNil(t, decoder.Err())
+
+		stats := decoder.Stats()
+		assertEqual(t, 3, stats.Objects)
+		assertEqual(t, 3, stats.Arrays)
+		assertEqual(t, 3, stats.Strings)
+		assertEqual(t, 3, stats.Numbers)
+		assertEqual(t, 2, stats.Booleans)
+		assertEqual(t, 1, stats.Nulls)
+		assertEqual(t, 4, stats.MaxDepth)
+		assertEqual(t, int64(len(statsBody)), stats.Bytes)
+		assertEqual(t, 0, stats.Duplicates)
+	}
+}
+
+func TestDecoderCollectStatsFiltered(t *testing.T) {
+	// skipped values are not counted
+	decoder := jstream.NewDecoder(strings.NewReader(statsBody), 1).FilterKeys("a").CollectStats()
+	for range decoder.Stream() {
+	}
+	assertNil(t, decoder.Err())
+
+	stats := decoder.Stats()
+	assertEqual(t, 1, stats.Objects)
+	assertEqual(t, 1, stats.Arrays)
+	assertEqual(t, 2, stats.Strings)
+	assertEqual(t, 3, stats.Numbers)
+	assertEqual(t, 1, stats.Booleans)
+	assertEqual(t, 2, stats.MaxDepth)
+}
+
+func TestDecoderStatsDisabled(t *testing.T) {
+	decoder := jstream.NewDecoder(strings.NewReader(statsBody), 0)
+	for range decoder.Stream() {
+	}
+	stats := decoder.Stats()
+	assertEqual(t, 0, stats.Objects+stats.Arrays+stats.Strings+stats.Numbers)
+	assertEqual(t, int64(len(statsBody)), stats.Bytes)
+}
+
+func TestDecoderStatsFixtures(t *testing.T) {
+	simple := `[{
+	"bio": "bada bing bada boom",
+	"id": 1,
+	"name": "Charles",
+	"falseVal": false
+}]`
+	multiDoc := strings.Repeat(`{ "bio": "bada bing bada boom", "id": 2, "name": "Charles" }`+"\n", 5)
+
+	tests := []struct {
+		body  string
+		depth int
+		want  jstream.Stats
+	}{
+		{simple, 1, jstream.Stats{Documents: 1, Values: 1, Objects: 1, Arrays: 1, Strings: 2, Numbers: 1, Booleans: 1, MaxDepth: 2}},
+		{simple, -1, jstream.Stats{Documents: 1, Values: 6, Objects: 1, Arrays: 1, Strings: 2, Numbers: 1, Booleans: 1, MaxDepth: 2}},
+		{multiDoc, 0, jstream.Stats{Documents: 5, Values: 5, Objects: 5, Strings: 10, Numbers: 5, MaxDepth: 1}},
+		{multiDoc, 1, jstream.Stats{Documents: 5, Values: 15, Objects: 5, Strings: 10, Numbers: 5, MaxDepth: 1}},
+	}
+
+	for _, test := range tests {
+		decoder := jstream.NewDecoder(strings.NewReader(test.body), test.depth).CollectStats()
+		for range decoder.Stream() {
+		}
+		assertNil(t, decoder.Err())
+
+		stats := decoder.Stats()
+		test.want.Bytes = int64(len(test.body))
+		test.want.Duration = stats.Duration
+		assertEqual(t, test.want, stats)
+	}
+}
@@ -0,0 +1,60 @@
+package test
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderStopWhen(t *testing.T) {
+	frame := `{"type": "event", "n": 1}` + "\n" + `{"type": "checkpoint", "n": 2}` + "\n" + `{"type": "event"`
+	next := `, "n": 3}`
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		server.Write([]byte(frame))
+		server.Write([]byte(next))
+		server.Close()
+	}()
+
+	decoder := jstream.NewDecoder(client, 0).StopWhen(func(mv *jstream.MetaValue) bool {
+		return mv.Value.(map[string]interface{})["type"] == "checkpoint"
+	})
+	var values []*jstream.MetaValue
+	for mv := range decoder.Stream() {
+		values = append(values, mv)
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 2, len(values))
+	assertEqual(t, int64(2), values[1].Value.(map[string]interface{})["n"])
+
+	// decoding stopped at the end of the value, and the input following it
+	// remains to be read
+	end := values[1].Offset + values[1].Length
+	assertEqual(t, end, decoder.BytesConsumed())
+	rest, err := io.ReadAll(io.MultiReader(decoder.Buffered(), client))
+	assertNil(t, err)
+	assertEqual(t, frame[end:]+next, string(rest))
+
+	// as Limit, with other modes of decoding
+	body := `[{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}]`
+	stop := func(mv *jstream.MetaValue) bool { return mv.Value.(map[string]interface{})["id"] == int64(2) }
+	decoder = jstream.NewDecoder(mkReader(body), 1).StopWhen(stop)
+	values, err = decoder.ReadAll()
+	assertNil(t, err)
+	assertEqual(t, 2, len(values))
+	rest, err = io.ReadAll(decoder.Buffered())
+	assertNil(t, err)
+	assertEqual(t, `, {"id": 3}, {"id": 4}]`, string(rest))
+
+	decoder = jstream.NewDecoder(mkReader(body), 1).StopWhen(stop).Ordered()
+	var count int
+	for range decoder.StreamParallel(2) {
+		count++
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 2, count)
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+var escapeCorpus = []string{
+	`plain`,
+	`\"quoted\"`,
+	`back\\slash`,
+	`sol\/idus`,
+	`\b\f\n\r\t`,
+	`Aé€`,
+	`𝄞`,
+	`single \' quote`,
+	`\x41`,
+	`\a`,
+	`\0`,
+	`\U0041`,
+	`\u00`,
+	`\uzzzz`,
+	"raw\ttab",
+	"raw\nnewline",
+	`trailing \`,
+	`\`,
+}
+
+func TestDecoderStrictEscapes(t *testing.T) {
+	for _, value := range escapeCorpus {
+		body := `["` + value + `"]`
+
+		var expected []string
+		jsonErr := json.Unmarshal([]byte(body), &expected)
+
+		for _, strict := range []func(*jstream.Decoder) *jstream.Decoder{(*jstream.Decoder).Strict, (*jstream.Decoder).StrictEscapes} {
+			values, err := decodeStrings(mkReader(body), 1, strict)
+			if jsonErr != nil {
+				if err == nil {
+					t.Errorf("%q: expected error as from encoding/json (%s), got %q", value, jsonErr, values)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%q: unexpected error: %s", value, err)
+				continue
+			}
+			assertEqual(t, 1, len(values))
+			assertEqual(t, expected[0], values[0])
+		}
+	}
+}
+
+func TestDecoderStrictSingleQuoteEscape(t *testing.T) {
+	body := `{"a": "it\'s", "b": 1}`
+
+	// accepted by default
+	values, err := decodeStrings(mkReader(`["it\'s"]`), 1, func(d *jstream.Decoder) *jstream.Decoder { return d })
+	assertNil(t, err)
+	assertEqual(t, "it's", values[0])
+
+	decoder := jstream.NewDecoder(mkReader(body), 1).Strict()
+	for range decoder.Stream() {
+	}
+	err = decoder.Err()
+	if err == nil || !strings.Contains(err.Error(), `in string escape code \'`) {
+		t.Fatalf("expected escape error, got %v", err)
+	}
+
+	// also rejected within values skipped without decoding
+	decoder = jstream.NewDecoder(mkReader(body), 1).Strict().FilterKeys("b")
+	for range decoder.Stream() {
+	}
+	assertNotNil(t, decoder.Err())
+}
+
+func TestDecoderStrictEscapePositions(t *testing.T) {
+	tests := []struct {
+		body string
+		err  string
+	}{
+		{`"\'"`, `invalid character in string escape code \': '\'' [1,3] offset 2`},
+		{`["ok", "it\'s"]`, `invalid character in string escape code \': '\'' [1,12] offset 11`},
+		{`{"k\'": 1}`, `invalid character in string escape code \': '\'' [1,5] offset 4`},
+		{`{"a": {"b\'": 1}}`, `invalid character in string escape code \': '\'' [1,11] offset 10`},
+	}
+	for _, test := range tests {
+		// accepted by default
+		_, err := decodeAll(test.body, 0, nil)
+		assertNil(t, err)
+
+		for _, depth := range []int{0, 1, -1} {
+			_, err := decodeAll(test.body, depth, (*jstream.Decoder).StrictEscapes)
+			if errorLine(err) != test.err {
+				t.Errorf("%s at depth %d: expected error %q, got %v", test.body, depth, test.err, err)
+			}
+			_, err = decodeAll(test.body, depth, func(d *jstream.Decoder) *jstream.Decoder { return d.StrictEscapes().RawStrings() })
+			if errorLine(err) != test.err {
+				t.Errorf("%s raw at depth %d: expected error %q, got %v", test.body, depth, test.err, err)
+			}
+		}
+	}
+
+	// escapes defined by RFC 8259 remain accepted
+	values, err := decodeAll(`"\"\\\/\b\f\n\r\té"`, 0, (*jstream.Decoder).StrictEscapes)
+	assertNil(t, err)
+	assertEqual(t, "\"\\/\b\f\n\r\té", values[0].Value)
+
+	// as does \' within single quoted strings
+	values, err = decodeAll(`'it\'s'`, 0, func(d *jstream.Decoder) *jstream.Decoder { return d.StrictEscapes().Relaxed() })
+	assertNil(t, err)
+	assertEqual(t, "it's", values[0].Value)
+
+	// escapes undefined by any grammar are always rejected
+	_, err = decodeAll(`"\x41"`, 0, nil)
+	assertNotNil(t, err)
+}
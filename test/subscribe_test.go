@@ -0,0 +1,97 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xenking/jstream"
+)
+
+func subscribeBody(n int) string {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, `{"n": %d}`, i)
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+func TestDecoderSubscribeBlock(t *testing.T) {
+	const n = 50
+	decoder := jstream.NewDecoder(mkReader(subscribeBody(n)), 1)
+	fast, slow := decoder.Subscribe(0), decoder.Subscribe(2)
+
+	var (
+		wg   sync.WaitGroup
+		got  [2][]int64
+		subs = [2]<-chan *jstream.MetaValue{fast, slow}
+	)
+	for i, ch := range subs {
+		wg.Add(1)
+		go func(i int, ch <-chan *jstream.MetaValue) {
+			defer wg.Done()
+			for mv := range ch {
+				got[i] = append(got[i], mv.Value.(map[string]interface{})["n"].(int64))
+				if i == 1 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}(i, ch)
+	}
+
+	// values are delivered to the primary consumer and every subscriber
+	var count int
+	for range decoder.Stream() {
+		count++
+	}
+	wg.Wait()
+	assertNil(t, decoder.Err())
+	assertEqual(t, n, count)
+	for i := range got {
+		assertEqual(t, n, len(got[i]))
+		for j, v := range got[i] {
+			assertEqual(t, int64(j), v)
+		}
+	}
+	assertEqual(t, 0, decoder.Stats().Dropped)
+}
+
+func TestDecoderSubscribeDrop(t *testing.T) {
+	const n = 50
+	decoder := jstream.NewDecoder(mkReader(subscribeBody(n)), 1).SlowSubscribers(jstream.DropSlowSubscribers)
+	fast, slow := decoder.Subscribe(n), decoder.Subscribe(1)
+
+	// the slow subscriber is not read until decoding ends
+	assertNil(t, decoder.Run())
+	var fastCount, slowCount int
+	for range fast {
+		fastCount++
+	}
+	for mv := range slow {
+		assertEqual(t, int64(0), mv.Value.(map[string]interface{})["n"])
+		slowCount++
+	}
+	assertEqual(t, n, fastCount)
+	assertEqual(t, 1, slowCount)
+	assertEqual(t, n-1, decoder.Stats().Dropped)
+}
+
+func TestDecoderSubscribeClose(t *testing.T) {
+	// a blocked subscriber does not prevent Close
+	decoder := jstream.NewDecoder(mkReader(subscribeBody(10)), 1)
+	ch := decoder.Subscribe(0)
+	done := make(chan error)
+	go func() { done <- decoder.Run() }()
+	<-ch
+	decoder.Close()
+	assertEqual(t, jstream.ErrClosed, <-done)
+	for range ch {
+	}
+}
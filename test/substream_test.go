@@ -0,0 +1,316 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+// histogram counts array elements by their last decimal digit
+type histogram struct {
+	buckets [10]int
+	total   int
+}
+
+func (h *histogram) UnmarshalJStream(s *jstream.SubStream) error {
+	for {
+		v, err := s.NextValue()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		h.buckets[v.(int64)%10]++
+		h.total++
+	}
+}
+
+// head reads only the first n elements of a container
+type head struct {
+	n      int
+	values []interface{}
+}
+
+func (h *head) UnmarshalJStream(s *jstream.SubStream) error {
+	for len(h.values) < h.n {
+		v, err := s.NextValue()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		h.values = append(h.values, v)
+	}
+	return nil
+}
+
+// record reads object members by key, decoding nested values into a
+// StreamUnmarshaler and skipping unknown keys
+type record struct {
+	name   string
+	counts histogram
+}
+
+func (r *record) UnmarshalJStream(s *jstream.SubStream) error {
+	for {
+		tok, err := s.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case "name":
+			err = s.Decode(&r.name)
+		case "counts":
+			err = s.Decode(&r.counts)
+		default:
+			err = s.SkipValue()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func TestDecodeNextStreamUnmarshaler(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for row := 0; row < 2; row++ {
+		if row > 0 {
+			sb.WriteString(",\n")
+		}
+		sb.WriteString("[")
+		for i := 0; i < 1000; i++ {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			fmt.Fprintf(&sb, "%d", i)
+		}
+		sb.WriteString("]")
+	}
+	sb.WriteString("]")
+
+	decoder := jstream.NewDecoder(mkReader(sb.String()), 1)
+	for row := 0; row < 2; row++ {
+		var h histogram
+		if err := decoder.DecodeNext(&h); err != nil {
+			t.Fatalf("decode row %d: %s", row, err)
+		}
+		assertEqual(t, 1000, h.total)
+		for _, n := range h.buckets {
+			assertEqual(t, 100, n)
+		}
+	}
+	assertEqual(t, io.EOF, decoder.DecodeNext(&histogram{}))
+}
+
+func TestDecodeNextScoped(t *testing.T) {
+	body := `{"a": [1, 2, 3, [4, 5]], "b": "skipped", "c": {"x": 6, "y": [7], "z": 8}}
+[9, 10]`
+
+	decoder := jstream.NewDecoder(mkReader(body), 1)
+
+	first := &head{n: 2}
+	if err := decoder.DecodeNext(first); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 2, len(first.values))
+	assertEqual(t, int64(1), first.values[0])
+	assertEqual(t, int64(2), first.values[1])
+
+	// a scalar at emit depth cannot be stream-unmarshaled, but is skipped
+	if err := decoder.DecodeNext(&head{n: 1}); err == nil {
+		t.Fatal("expected error decoding scalar into StreamUnmarshaler")
+	}
+
+	second := &head{n: 2}
+	if err := decoder.DecodeNext(second); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 2, len(second.values))
+	assertEqual(t, int64(6), second.values[0])
+
+	var i1, i2 interface{}
+	assertNil(t, decoder.DecodeNext(&i1))
+	assertNil(t, decoder.DecodeNext(&i2))
+	assertEqual(t, int64(9), i1)
+	assertEqual(t, int64(10), i2)
+	assertEqual(t, io.EOF, decoder.DecodeNext(&i1))
+}
+
+func TestDecodeNextNested(t *testing.T) {
+	body := `[
+  {"name": "first", "extra": {"deep": [1, {"x": 2}]}, "counts": [1, 11, 21, 2]},
+  {"counts": [], "name": "second"}
+]`
+
+	decoder := jstream.NewDecoder(mkReader(body), 1)
+
+	var r record
+	assertNil(t, decoder.DecodeNext(&r))
+	assertEqual(t, "first", r.name)
+	assertEqual(t, 4, r.counts.total)
+	assertEqual(t, 3, r.counts.buckets[1])
+
+	r = record{}
+	assertNil(t, decoder.DecodeNext(&r))
+	assertEqual(t, "second", r.name)
+	assertEqual(t, 0, r.counts.total)
+
+	assertEqual(t, io.EOF, decoder.DecodeNext(&r))
+}
+
+func TestDecoderDecodeFull(t *testing.T) {
+	body := `{
+		"name": "root",
+		"items": [{"id": 1, "tags": ["a", "b"], "meta": {"x": null, "y": [true, false]}},
+		          {"id": 2.5, "tags": [], "meta": {}}],
+		"nested": [[[1, [2, {"deep": "é"}]]]]
+	}
+	[1, 2]`
+	var want interface{}
+	assertNil(t, json.NewDecoder(strings.NewReader(body)).Decode(&want))
+	wantJSON, err := json.Marshal(want)
+	assertNil(t, err)
+
+	// the whole value is built regardless of emit depth and filters
+	for _, depth := range []int{0, 1, 3, -1} {
+		for _, kvs := range []bool{false, true} {
+			decoder := jstream.NewDecoder(mkReader(body), depth).FilterKeys("name")
+			if kvs {
+				decoder.ObjectAsKVS()
+			}
+			v, err := decoder.DecodeFull()
+			assertNil(t, err)
+			if kvs {
+				_, ok := v.(jstream.KVS)
+				assertTrue(t, ok)
+			}
+			// compare once re-encoded, as numbers are typed differently and
+			// KVS preserve member order
+			got, err := json.Marshal(v)
+			assertNil(t, err)
+			var norm interface{}
+			assertNil(t, json.Unmarshal(got, &norm))
+			got, err = json.Marshal(norm)
+			assertNil(t, err)
+			assertEqual(t, string(wantJSON), string(got))
+
+			v, err = decoder.DecodeFull()
+			assertNil(t, err)
+			assertEqual(t, "[1 2]", fmt.Sprint(v))
+			_, err = decoder.DecodeFull()
+			assertEqual(t, io.EOF, err)
+		}
+	}
+}
+
+func TestDecoderEmitSubStreams(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`[{"name": "first", "counts": [`)
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%d", i)
+	}
+	sb.WriteString(`]}, [1, 11, 21], 7, {"name": "second", "counts": []}]`)
+	body := sb.String()
+
+	// with Stream, containers are read on the receiving goroutine
+	decoder := jstream.NewDecoder(&chunkReader{data: []byte(body), n: 100}, 1).EmitSubStreams()
+	var got []string
+	for mv := range decoder.Stream() {
+		switch v := mv.Value.(type) {
+		case *jstream.SubStream:
+			assertEqual(t, int64(0), mv.Length)
+			if mv.ValueType == jstream.Object {
+				var r record
+				assertNil(t, r.UnmarshalJStream(v))
+				got = append(got, fmt.Sprintf("%s:%d:%d", r.name, r.counts.total, r.counts.buckets[1]))
+			} else {
+				var h histogram
+				assertNil(t, h.UnmarshalJStream(v))
+				got = append(got, fmt.Sprintf("array:%d:%d", h.total, h.buckets[1]))
+			}
+		default:
+			got = append(got, fmt.Sprint(v))
+		}
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, "[first:10000:1000 array:3:3 7 second:0:0]", fmt.Sprint(got))
+
+	// elements left unread are skipped once closed, or once Walk's
+	// callback returns
+	for _, walk := range []bool{false, true} {
+		decoder = jstream.NewDecoder(mkReader(body), 1).EmitSubStreams()
+		got = got[:0]
+		read := func(mv *jstream.MetaValue) {
+			s, ok := mv.Value.(*jstream.SubStream)
+			if !ok {
+				got = append(got, fmt.Sprint(mv.Value))
+				return
+			}
+			tok, err := s.Token()
+			assertNil(t, err)
+			got = append(got, fmt.Sprint(tok))
+			if !walk {
+				assertNil(t, s.Close())
+			}
+		}
+		if walk {
+			assertNil(t, decoder.Walk(func(mv *jstream.MetaValue) error {
+				read(mv)
+				return nil
+			}))
+		} else {
+			for mv := range decoder.Stream() {
+				read(mv)
+			}
+			assertNil(t, decoder.Err())
+		}
+		assertEqual(t, "[name 0 7 name]", fmt.Sprint(got))
+	}
+}
+
+func TestDecoderEmitSubStreamsError(t *testing.T) {
+	decoder := jstream.NewDecoder(mkReader(`[[1, 2, x], 3]`), 1).EmitSubStreams()
+	var values []interface{}
+	var readErr error
+	for mv := range decoder.Stream() {
+		s := mv.Value.(*jstream.SubStream)
+		for {
+			v, err := s.NextValue()
+			if err != nil {
+				readErr = err
+				break
+			}
+			values = append(values, v)
+		}
+	}
+	assertEqual(t, "[1 2]", fmt.Sprint(values))
+	assertNotNil(t, readErr)
+	assertEqual(t, readErr.Error(), decoder.Err().Error())
+
+	// scalars, and containers below the emit depth, are decoded as usual
+	var all []*jstream.MetaValue
+	decoder = jstream.NewDecoder(mkReader(`{"a": [1, [2]]}`), 2).EmitSubStreams()
+	assertNil(t, decoder.Walk(func(mv *jstream.MetaValue) error {
+		all = append(all, mv)
+		return nil
+	}))
+	assertEqual(t, 2, len(all))
+	assertEqual(t, int64(1), all[0].Value)
+	_, ok := all[1].Value.(*jstream.SubStream)
+	assertTrue(t, ok)
+	assertEqual(t, 1, all[1].Index)
+	assertEqual(t, "[a ]", fmt.Sprint(all[1].Keys))
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderTee(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&b, "{\"id\": %d, \"s\": \"\\u00e9%d\", \"n\": [%d.5e1, -%d]}  \n", i, i, i, i)
+	}
+	body := b.String()
+
+	for _, r := range []func() io.Reader{
+		func() io.Reader { return strings.NewReader(body) },
+		func() io.Reader { return iotest.OneByteReader(strings.NewReader(body)) },
+	} {
+		for _, depth := range []int{0, 2, -1} {
+			var tee bytes.Buffer
+			decoder := jstream.NewDecoder(r(), depth).Tee(&tee)
+			err := decoder.Walk(func(mv *jstream.MetaValue) error {
+				// input not yet reached is not mirrored
+				assertTrue(t, int64(tee.Len()) <= mv.Offset+mv.Length)
+				return nil
+			})
+			assertNil(t, err)
+			assertEqual(t, body, tee.String())
+		}
+	}
+}
+
+func TestDecoderTeeError(t *testing.T) {
+	// input is mirrored through the position of a syntax error
+	body := strings.Repeat(`{"a": [1, 2, 3]} `, 500) + `{"b": x} [4]`
+	var tee bytes.Buffer
+	decoder := jstream.NewDecoder(strings.NewReader(body), 0).Tee(&tee)
+	for range decoder.Stream() {
+	}
+	assertNotNil(t, decoder.Err())
+	assertEqual(t, body[:strings.Index(body, "x")+1], tee.String())
+	assertEqual(t, int64(tee.Len()), decoder.BytesConsumed())
+}
+
+func TestDecoderTeeDecodeNext(t *testing.T) {
+	body := `[1] {"a": 2}  "three"`
+	var tee bytes.Buffer
+	decoder := jstream.NewDecoder(strings.NewReader(body), 0).Tee(&tee)
+	var v interface{}
+	assertNil(t, decoder.DecodeNext(&v))
+	assertEqual(t, `[1]`, tee.String())
+	assertNil(t, decoder.DecodeNext(&v))
+	assertEqual(t, `[1] {"a": 2}`, tee.String())
+}
+
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n += len(p); w.n > 100 {
+		return 0, errors.New("full")
+	}
+	return len(p), nil
+}
+
+func TestDecoderTeeWriteError(t *testing.T) {
+	body := strings.Repeat(`{"a": [1, 2, 3]} `, 1000)
+	decoder := jstream.NewDecoder(strings.NewReader(body), 0).Tee(&failingWriter{})
+	var n int
+	for range decoder.Stream() {
+		n++
+	}
+	assertEqual(t, 1000, n)
+	assertEqual(t, "full", decoder.Err().Error())
+}
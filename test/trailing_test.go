@@ -0,0 +1,84 @@
+package test
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderTrailingCommas(t *testing.T) {
+	tests := []struct {
+		lenient string
+		strict  string
+	}{
+		{`[1,2,3,]`, `[1,2,3]`},
+		{`{"a":1,}`, `{"a":1}`},
+		{`[ 1 , 2 , ]`, `[1, 2]`},
+		{"{\"a\": [1,\n],\n\"b\": {\"c\": {},},\n}", `{"a": [1], "b": {"c": {}}}`},
+		{`[[],[1,],{},{"x":[],},]`, `[[],[1],{},{"x":[]}]`},
+	}
+
+	modes := map[string]func(*jstream.Decoder) *jstream.Decoder{
+		"map":         (*jstream.Decoder).AllowTrailingCommas,
+		"ordered":     func(d *jstream.Decoder) *jstream.Decoder { return d.AllowTrailingCommas().ObjectAsKVS() },
+		"skip filter": func(d *jstream.Decoder) *jstream.Decoder { return d.AllowTrailingCommas().FilterKeys("a") },
+	}
+
+	for _, test := range tests {
+		for name, lenient := range modes {
+			for _, depth := range []int{0, 1, -1} {
+				strict := func(d *jstream.Decoder) *jstream.Decoder { return d }
+				if name == "ordered" {
+					strict = (*jstream.Decoder).ObjectAsKVS
+				} else if name == "skip filter" {
+					strict = func(d *jstream.Decoder) *jstream.Decoder { return d.FilterKeys("a") }
+				}
+				want, err := decodeAll(test.strict, depth, strict)
+				assertNil(t, err)
+				got, err := decodeAll(test.lenient, depth, lenient)
+				if err != nil {
+					t.Errorf("%s %s: unexpected error: %s", name, test.lenient, err)
+					continue
+				}
+				if len(got) != len(want) {
+					t.Errorf("%s %s: expected %d values, got %d", name, test.lenient, len(want), len(got))
+					continue
+				}
+				for i := range want {
+					if !reflect.DeepEqual(want[i].Value, got[i].Value) {
+						t.Errorf("%s %s: expected %v, got %v", name, test.lenient, want[i].Value, got[i].Value)
+					}
+				}
+			}
+		}
+
+		// rejected by default
+		if _, err := decodeAll(test.lenient, 0, nil); err == nil {
+			t.Errorf("%s: expected error by default", test.lenient)
+		}
+	}
+}
+
+func TestDecoderTrailingCommasRejected(t *testing.T) {
+	for _, body := range []string{`[1,,]`, `[,]`, `[,1]`, `{,}`, `{"a":1,,}`, `{,"a":1}`, `[1,,2]`} {
+		if _, err := decodeAll(body, 0, (*jstream.Decoder).AllowTrailingCommas); err == nil {
+			t.Errorf("%s: expected error", body)
+		}
+	}
+}
+
+func TestDecodeNextTrailingCommas(t *testing.T) {
+	decoder := jstream.NewDecoder(mkReader(`[{"name": "a", "counts": [1, 2,],}, [3,],]`), 1).AllowTrailingCommas()
+
+	var r record
+	assertNil(t, decoder.DecodeNext(&r))
+	assertEqual(t, "a", r.name)
+	assertEqual(t, 2, r.counts.total)
+
+	var h histogram
+	assertNil(t, decoder.DecodeNext(&h))
+	assertEqual(t, 1, h.total)
+	assertEqual(t, io.EOF, decoder.DecodeNext(&h))
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+type Person struct {
+	Bio  string
+	ID   int
+	Name string
+}
+
+func TestDecodeStream(t *testing.T) {
+	body := `[{
+	"bio": "bada bing bada boom",
+	"id": 1,
+	"name": "Charles",
+	"falseVal": false
+}, {"bio": "“quoted”", "id": "two", "name": "Bad"}, {"id": 3, "name": "Ada"}]`
+
+	decoder := jstream.NewDecoder(mkReader(body), 1)
+	var people []Person
+	var errs int
+	for r := range jstream.DecodeStream[Person](decoder) {
+		if r.Err != nil {
+			// a field error affects its own element only
+			errs++
+			assertEqual(t, int64(strings.Index(body, `{"bio": "“`)), r.Meta.Offset)
+			continue
+		}
+		_, ok := r.Meta.Value.(json.RawMessage)
+		assertTrue(t, ok)
+		people = append(people, r.Value)
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, 1, errs)
+	assertEqual(t, "[{bada bing bada boom 1 Charles} { 3 Ada}]", fmt.Sprint(people))
+}
+
+func TestDecodeStreamModes(t *testing.T) {
+	// members with EmitKV
+	decoder := jstream.NewDecoder(mkReader(`{"a": [1, 2], "b": [3]}`), 1).EmitKV()
+	var got []string
+	for r := range jstream.DecodeStream[[]int](decoder) {
+		assertNil(t, r.Err)
+		got = append(got, fmt.Sprint(r.Meta.Value.(jstream.KV).Key, r.Value))
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, "[a[1 2] b[3]]", fmt.Sprint(got))
+
+	// recursive values are converted from their decoded form
+	decoder = jstream.NewDecoder(mkReader(`[[1], [2, 3]]`), 1).Recursive()
+	got = got[:0]
+	for r := range jstream.DecodeStream[interface{}](decoder) {
+		assertNil(t, r.Err)
+		got = append(got, fmt.Sprint(r.Value))
+	}
+	assertNil(t, decoder.Err())
+	assertEqual(t, "[1 [1] 2 3 [2 3]]", fmt.Sprint(got))
+
+	// decoding errors end the stream
+	decoder = jstream.NewDecoder(mkReader(`[{"id": 1}, {"id": }]`), 1)
+	var n int
+	for range jstream.DecodeStream[Person](decoder) {
+		n++
+	}
+	assertEqual(t, 1, n)
+	assertNotNil(t, decoder.Err())
+}
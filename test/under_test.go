@@ -0,0 +1,67 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderEmitUnder(t *testing.T) {
+	body := `{"items": [1, 2], "data": {"items": [3], "n": 0}, "result": {"data": {"items": {"a": 4}}}, "x": [{"items": [5]}]}`
+
+	describe := func(values []*jstream.MetaValue) string {
+		var s []string
+		for _, mv := range values {
+			s = append(s, fmt.Sprintf("%s=%v@%d", jstream.FormatPath(mv.Keys), mv.Value, mv.Depth))
+		}
+		return fmt.Sprint(s)
+	}
+
+	for _, depth := range []int{0, 1, -1} {
+		values, err := decodeAll(body, depth, func(d *jstream.Decoder) *jstream.Decoder {
+			return d.EmitUnder("items", false)
+		})
+		assertNil(t, err)
+		assertEqual(t, "[/items/=1@2 /items/=2@2 /data/items/=3@3 /result/data/items/a=4@4 /x//items/=5@4]", describe(values))
+	}
+
+	// members of objects as KVs, with their offsets
+	values, err := decodeAll(body, 0, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.EmitUnder("items", false).EmitKV()
+	})
+	assertNil(t, err)
+	kv := values[3].Value.(jstream.KV)
+	assertEqual(t, "a", kv.Key)
+	assertEqual(t, int64(4), kv.Value)
+	assertEqual(t, `"a": 4`, body[values[3].Offset:values[3].Offset+values[3].Length])
+
+	// nested occurrences of the key
+	body = `{"items": [{"id": 1, "items": [10, {"items": [11]}]}, {"id": 2, "tags": ["t"]}], "n": [3]}`
+	values, err = decodeAll(body, 0, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.EmitUnder("items", false)
+	})
+	assertNil(t, err)
+	assertEqual(t, "[/items/=map[id:1 items:[10 map[items:[11]]]]@2 /items/=map[id:2 tags:[t]]@2]", describe(values))
+
+	values, err = decodeAll(body, 0, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.EmitUnder("items", true)
+	})
+	assertNil(t, err)
+	assertEqual(t, "[/items//items/=10@4 /items//items//items/=11@6 /items//items/=map[items:[11]]@4 "+
+		"/items/=map[id:1 items:[10 map[items:[11]]]]@2 /items/=map[id:2 tags:[t]]@2]", describe(values))
+
+	// with ObjectAsKVS and a filter on the members emitted
+	values, err = decodeAll(`{"a": {"items": {"x": 1, "y": {"z": 2}}}}`, 0, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.EmitUnder("items", false).ObjectAsKVS().FilterKeys("y")
+	})
+	assertNil(t, err)
+	assertEqual(t, "[/a/items/y=[{z 2 unknown 0}]@3]", describe(values))
+
+	// the key of a scalar has no children, and arrays have no keys
+	values, err = decodeAll(`{"items": 1, "b": ["items", {"c": "items"}]}`, 0, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.EmitUnder("items", true)
+	})
+	assertNil(t, err)
+	assertEqual(t, 0, len(values))
+}
@@ -0,0 +1,210 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/xenking/jstream"
+)
+
+var utf8Corpus = []struct {
+	name  string
+	value string // raw string literal contents
+	valid bool
+}{
+	{"ascii", "plain text", true},
+	{"two byte", "h\xc3\xa9llo w\xc3\xb6rld", true},
+	{"three byte", "\xe6\x97\xa5\xe6\x9c\xac\xe2\x82\xac", true},
+	{"four byte", "\xf0\x9f\x98\x80 \xf0\x9d\x84\x9e", true},
+	{"overlong two byte", "a\xc0\xafb", false},
+	{"overlong three byte", "a\xe0\x80\xafb", false},
+	{"overlong four byte", "a\xf0\x80\x80\xafb", false},
+	{"encoded surrogate", "a\xed\xa0\x80b", false},
+	{"beyond max rune", "a\xf4\x90\x80\x80b", false},
+	{"lone continuation", "a\x80b", false},
+	{"invalid lead", "a\xffb", false},
+	{"truncated two byte", "a\xc3", false},
+	{"truncated three byte", "a\xe2\x82", false},
+	{"truncated four byte", "a\xf0\x9f\x98b", false},
+	{"truncated before escape", "a\xe2\x82\\n", false},
+}
+
+func decodeStrings(r io.Reader, depth int, options func(*jstream.Decoder) *jstream.Decoder) ([]string, error) {
+	decoder := options(jstream.NewDecoder(r, depth))
+	var values []string
+	for mv := range decoder.Stream() {
+		values = append(values, mv.Value.(string))
+	}
+	return values, decoder.Err()
+}
+
+func TestDecoderValidateUTF8Replace(t *testing.T) {
+	replace := func(d *jstream.Decoder) *jstream.Decoder { return d.ValidateUTF8(true) }
+
+	for _, test := range utf8Corpus {
+		t.Run(test.name, func(t *testing.T) {
+			body := `["` + test.value + `"]`
+			values, err := decodeStrings(mkReader(body), 1, replace)
+			assertNil(t, err)
+
+			var expected []string
+			if err := json.Unmarshal([]byte(body), &expected); err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(t, 1, len(values))
+			assertEqual(t, expected[0], values[0])
+		})
+	}
+}
+
+func TestDecoderValidateUTF8Error(t *testing.T) {
+	validate := func(d *jstream.Decoder) *jstream.Decoder { return d.ValidateUTF8(false) }
+
+	for _, test := range utf8Corpus {
+		t.Run(test.name, func(t *testing.T) {
+			body := `["` + test.value + `"]`
+			values, err := decodeStrings(mkReader(body), 1, validate)
+			if test.valid {
+				assertNil(t, err)
+				assertEqual(t, 1, len(values))
+				assertEqual(t, test.value, values[0])
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "invalid UTF-8") {
+				t.Fatalf("expected invalid UTF-8 error, got %v", err)
+			}
+		})
+	}
+
+	// without validation, bytes are copied verbatim
+	values, err := decodeStrings(mkReader("[\"a\xc0\xafb\"]"), 1, func(d *jstream.Decoder) *jstream.Decoder { return d })
+	assertNil(t, err)
+	assertEqual(t, "a\xc0\xafb", values[0])
+}
+
+func TestDecoderValidateUTF8Boundary(t *testing.T) {
+	// place multi-byte sequences across the scanner's 4095 byte chunk
+	// boundary, and across every byte with a one byte reader
+	pad := strings.Repeat("a", 4093)
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{pad + "\xf0\x9f\x98\x80", pad + "\xf0\x9f\x98\x80"},
+		{pad[1:] + "\xe2\x82\xac", pad[1:] + "\xe2\x82\xac"},
+		{pad + "\xf0\x9f\x98", pad + "���"},
+		{pad + "\xe2\x82", pad + "��"},
+	}
+
+	replace := func(d *jstream.Decoder) *jstream.Decoder { return d.ValidateUTF8(true) }
+	for _, test := range tests {
+		body := `"` + test.value + `"`
+		for _, r := range []io.Reader{mkReader(body), iotest.OneByteReader(mkReader(body))} {
+			values, err := decodeStrings(r, 0, replace)
+			assertNil(t, err)
+			assertEqual(t, 1, len(values))
+			assertEqual(t, test.expected, values[0])
+		}
+	}
+}
+
+var surrogateCorpus = []struct {
+	name  string
+	value string // string literal contents
+	col   int    // column of the unpaired escape, or 0 if valid
+}{
+	{"pair", `a\ud834\udd1eb`, 0},
+	{"lone high", `a\ud834b`, 2},
+	{"lone high at end", `a\ud834`, 2},
+	{"lone low", `a\udd1eb`, 2},
+	{"high then non-unicode escape", `a\ud834\nb`, 2},
+	{"high then unescaped", `a\ud834Ab`, 2},
+	{"high then non-surrogate", `a\ud834\u0041b`, 2},
+	{"high then high pair", `a\ud834\ud834\udd1eb`, 2},
+	{"low then high", `a\udd1e\ud834b`, 2},
+	{"high then high", `\ud834\ud834`, 1},
+}
+
+func TestDecoderSurrogates(t *testing.T) {
+	for _, test := range surrogateCorpus {
+		t.Run(test.name, func(t *testing.T) {
+			body := `["` + test.value + `"]`
+			values, err := decodeStrings(mkReader(body), 1, func(d *jstream.Decoder) *jstream.Decoder { return d })
+			assertNil(t, err)
+
+			var expected []string
+			if err := json.Unmarshal([]byte(body), &expected); err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(t, 1, len(values))
+			assertEqual(t, expected[0], values[0])
+		})
+	}
+}
+
+func TestDecoderStrictUnicode(t *testing.T) {
+	strict := func(d *jstream.Decoder) *jstream.Decoder { return d.StrictUnicode() }
+
+	for _, test := range surrogateCorpus {
+		t.Run(test.name, func(t *testing.T) {
+			body := `["` + test.value + `"]`
+			values, err := decodeStrings(mkReader(body), 1, strict)
+			if test.col == 0 {
+				assertNil(t, err)
+				assertEqual(t, 1, len(values))
+				return
+			}
+			// the error points at the backslash of the unpaired escape
+			suffix := fmt.Sprintf(`'\\' [1,%d] offset %d`, test.col+2, test.col+1)
+			if err == nil || !strings.HasSuffix(errorLine(err), suffix) {
+				t.Fatalf("expected error ending %s, got %v", suffix, err)
+			}
+		})
+	}
+}
+
+func TestDecoderSurrogatesBoundary(t *testing.T) {
+	// place an escaped pair across the scanner's 4095 byte chunk boundary
+	// at every offset
+	for i := 0; i < 12; i++ {
+		pad := strings.Repeat("a", 4093-i)
+		body := `"` + pad + `\ud834\udd1e"`
+		expected := pad + "\U0001d11e"
+		for _, r := range []io.Reader{mkReader(body), iotest.OneByteReader(mkReader(body))} {
+			values, err := decodeStrings(r, 0, func(d *jstream.Decoder) *jstream.Decoder { return d.StrictUnicode() })
+			assertNil(t, err)
+			assertEqual(t, 1, len(values))
+			assertEqual(t, expected, values[0])
+		}
+	}
+}
+
+func TestDecoderStrictUTF8(t *testing.T) {
+	tests := []struct {
+		body   string
+		suffix string // error position context
+	}{
+		{`["ok", "a\ud834b"]`, `'\\' [1,10] offset 9`},
+		{"[\"ok\", \"a\x80b\"]", `'\x80' [1,10] offset 9`},
+		{"[\"ok\", \"a\xc3(b\"]", `'\xc3' [1,10] offset 9`},
+		{"[\"ok\", \"a\xe2\x82(\"]", `'\xe2' [1,10] offset 9`},
+	}
+
+	for _, test := range tests {
+		values, err := decodeStrings(mkReader(test.body), 1, (*jstream.Decoder).StrictUTF8)
+		assertEqual(t, 1, len(values))
+		if err == nil || !strings.HasSuffix(errorLine(err), test.suffix) {
+			t.Errorf("%q: expected error ending %s, got %v", test.body, test.suffix, err)
+		}
+	}
+
+	// valid input is unaffected
+	values, err := decodeStrings(mkReader(`["héllo", "𝄞", "日本"]`), 1, (*jstream.Decoder).StrictUTF8)
+	assertNil(t, err)
+	assertEqual(t, 3, len(values))
+	assertEqual(t, "\U0001d11e", values[1])
+}
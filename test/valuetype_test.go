@@ -0,0 +1,63 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestValueTypeNames(t *testing.T) {
+	names := map[jstream.ValueType]string{
+		jstream.Unknown: "unknown",
+		jstream.Null:    "null",
+		jstream.String:  "string",
+		jstream.Number:  "number",
+		jstream.Boolean: "boolean",
+		jstream.Array:   "array",
+		jstream.Object:  "object",
+	}
+	for v, name := range names {
+		assertEqual(t, name, v.String())
+
+		parsed, err := jstream.ParseValueType(name)
+		assertNil(t, err)
+		assertEqual(t, v, parsed)
+
+		text, err := v.MarshalText()
+		assertNil(t, err)
+		assertEqual(t, name, string(text))
+		var fromText jstream.ValueType
+		assertNil(t, fromText.UnmarshalText(text))
+		assertEqual(t, v, fromText)
+
+		data, err := json.Marshal(v)
+		assertNil(t, err)
+		assertEqual(t, `"`+name+`"`, string(data))
+		var fromJSON jstream.ValueType
+		assertNil(t, json.Unmarshal(data, &fromJSON))
+		assertEqual(t, v, fromJSON)
+	}
+
+	// names round-trip within other values, such as type filters read from
+	// configuration
+	var config struct {
+		Types map[string]jstream.ValueType `json:"types"`
+	}
+	assertNil(t, json.Unmarshal([]byte(`{"types": {"a": "array", "b": "boolean"}}`), &config))
+	assertEqual(t, jstream.Array, config.Types["a"])
+	assertEqual(t, jstream.Boolean, config.Types["b"])
+
+	// unknown names and values are rejected
+	for _, data := range []string{`"bool"`, `""`, `"Object"`, `4`, `null`} {
+		var v jstream.ValueType
+		if err := json.Unmarshal([]byte(data), &v); err == nil {
+			t.Errorf("%s: expected error, got %v", data, v)
+		}
+	}
+	_, err := jstream.ParseValueType("int")
+	assertNotNil(t, err)
+	_, err = json.Marshal(jstream.ValueType(42))
+	assertNotNil(t, err)
+	assertEqual(t, "ValueType(42)", jstream.ValueType(42).String())
+}
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/xenking/jstream"
+)
+
+func TestDecoderLenientWhitespace(t *testing.T) {
+	const (
+		nbsp = "\u00a0"
+		bom  = "\ufeff"
+	)
+	bodies := []string{
+		"[1," + nbsp + "2]",
+		"{" + nbsp + `"a"` + nbsp + ":" + nbsp + "[1, 2]" + nbsp + "}",
+		bom + "[1, 2]" + nbsp + bom + "\n",
+		"[1" + bom + ",2" + nbsp + nbsp + "]",
+	}
+	for _, body := range bodies {
+		// rejected by default
+		_, err := decodeAll(body, 0, nil)
+		assertTrue(t, errors.Is(err, jstream.ErrSyntax))
+
+		values, err := decodeAll(body, -1, (*jstream.Decoder).Lenient)
+		assertNil(t, err)
+		assertEqual(t, "2", fmt.Sprint(values[1].Value))
+	}
+
+	// between NDJSON documents, and within them
+	values, err := decodeAll("1"+nbsp+"\n[2,"+nbsp+"3]"+bom+"\n", 0, func(d *jstream.Decoder) *jstream.Decoder {
+		return d.Lenient().NDJSON()
+	})
+	assertNil(t, err)
+	assertEqual(t, 2, len(values))
+	assertNil(t, values[0].Err)
+	assertNil(t, values[1].Err)
+	assertEqual(t, "[2 3]", fmt.Sprint(values[1].Value))
+
+	// a lone lead byte is still an error
+	_, err = decodeAll("[1,\xc2 2]", 1, (*jstream.Decoder).Lenient)
+	assertEqual(t, "invalid character looking for beginning of value: '\\xc2' [1,4] offset 3", errorLine(err))
+	_, err = decodeAll("[1,\xef\xbb 2]", 1, (*jstream.Decoder).Lenient)
+	assertEqual(t, "invalid character looking for beginning of value: '\\xef' [1,4] offset 3", errorLine(err))
+}
+
+func TestDecoderStrictWhitespace(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{"[1,\u00a02]", `invalid character U+00A0 not allowed as whitespace: '\xc2' [1,4] offset 3`},
+		{"[1\u3000]", `invalid character U+3000 not allowed as whitespace: '\xe3' [1,3] offset 2`},
+		{"{\"a\":\u2003 1}", `invalid character U+2003 not allowed as whitespace: '\xe2' [1,6] offset 5`},
+		{"[1,\f2]", `invalid character U+000C not allowed as whitespace: '\f' [1,4] offset 3`},
+		{"[1\ufeff]", `invalid character U+FEFF not allowed as whitespace: '\xef' [1,3] offset 2`},
+		{"[1,\xc22]", `invalid character looking for beginning of value: '\xc2' [1,4] offset 3`},
+	}
+	for _, test := range tests {
+		for _, option := range []func(*jstream.Decoder) *jstream.Decoder{
+			(*jstream.Decoder).Strict,
+			func(d *jstream.Decoder) *jstream.Decoder { return d.Lenient().Strict() },
+		} {
+			_, err := decodeAll(test.body, 1, option)
+			assertEqual(t, test.expected, errorLine(err))
+			assertTrue(t, errors.Is(err, jstream.ErrSyntax))
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package jstream
+
+// StreamResult holds a value decoded by DecodeStream, along with the
+// MetaValue describing it
+type StreamResult[T any] struct {
+	Value T
+	// Meta describes the value as emitted by the Decoder; its Value holds
+	// the original bytes of the value as a json.RawMessage, or with EmitKV
+	// a KV of the member's key and bytes
+	Meta MetaValue
+	// Err is set if the value could not be unmarshaled into a T; decoding
+	// continues with the next value regardless. Errors decoding the input
+	// itself end the stream, and are reported by the Decoder's Err.
+	Err error
+}
+
+// DecodeStream begins decoding from d, returning a channel delivering each
+// value at the configured emit depth decoded into a T, as by DecodeEach.
+// Unlike DecodeEach, a value failing to unmarshal is delivered with its
+// error; to stop at the first, call Close on d. It may not be combined
+// with Stream or Walk.
+func DecodeStream[T any](d *Decoder) <-chan StreamResult[T] {
+	results := make(chan StreamResult[T], cap(d.metaCh))
+	go func() {
+		decodeEach(d, func(mv *MetaValue, v T, err error) error {
+			select {
+			case results <- StreamResult[T]{Value: v, Meta: *mv, Err: err}:
+				return nil
+			case <-d.done:
+				return d.abortErr
+			}
+		})
+		close(results)
+	}()
+	return results
+}
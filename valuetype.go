@@ -0,0 +1,72 @@
+package jstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+var valueTypeNames = [...]string{
+	Unknown: "unknown",
+	Null:    "null",
+	String:  "string",
+	Number:  "number",
+	Boolean: "boolean",
+	Array:   "array",
+	Object:  "object",
+}
+
+// String returns the name of the type, such as "string" or "object"
+func (v ValueType) String() string {
+	if v < 0 || int(v) >= len(valueTypeNames) {
+		return "ValueType(" + strconv.Itoa(int(v)) + ")"
+	}
+	return valueTypeNames[v]
+}
+
+// ParseValueType returns the ValueType named s, as by String
+func ParseValueType(s string) (ValueType, error) {
+	for v, name := range valueTypeNames {
+		if name == s {
+			return ValueType(v), nil
+		}
+	}
+	return Unknown, fmt.Errorf("jstream: unknown value type %q", s)
+}
+
+// MarshalText encodes the type as its name
+func (v ValueType) MarshalText() ([]byte, error) {
+	if v < 0 || int(v) >= len(valueTypeNames) {
+		return nil, fmt.Errorf("jstream: invalid value type %d", int(v))
+	}
+	return []byte(valueTypeNames[v]), nil
+}
+
+// UnmarshalText decodes a type from its name, failing for names other
+// than those returned by String
+func (v *ValueType) UnmarshalText(text []byte) error {
+	t, err := ParseValueType(string(text))
+	if err != nil {
+		return err
+	}
+	*v = t
+	return nil
+}
+
+// MarshalJSON encodes the type as a JSON string of its name
+func (v ValueType) MarshalJSON() ([]byte, error) {
+	text, err := v.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON decodes a type from a JSON string of its name
+func (v *ValueType) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("jstream: value type must be a string: %w", err)
+	}
+	return v.UnmarshalText([]byte(s))
+}